@@ -0,0 +1,257 @@
+package config
+
+import (
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/Laisky/go-utils/v2/log"
+	"github.com/Laisky/zap"
+	"github.com/pkg/errors"
+)
+
+// deprecatedKey key renamed or removed
+type deprecatedKey struct {
+	key string
+	// replacement new key, empty means key is removed without replacement
+	replacement string
+	message     string
+}
+
+// RegisterAlias register oldKey as deprecated alias of newKey
+//
+// oldKey in loaded settings is moved to newKey, unless newKey is also set.
+// `Get*`, `Set`, `IsSet` and `UnmarshalKey` with oldKey read newKey instead.
+// a warning is logged once for every deprecated key.
+func (s *config) RegisterAlias(oldKey, newKey string) error {
+	return s.RegisterDeprecated(oldKey, newKey, "")
+}
+
+// RegisterDeprecated register key as deprecated
+//
+// key is mapped to replacement like `RegisterAlias`,
+// set replacement to empty if key is removed without replacement.
+// message is logged with the warning.
+//
+// in strict mode (`SetStrict`), loading settings that contain deprecated key
+// returns error.
+func (s *config) RegisterDeprecated(key, replacement, message string) error {
+	key, replacement = strings.ToLower(key), strings.ToLower(replacement)
+	if key == "" {
+		return errors.New("deprecated key is empty")
+	}
+	if key == replacement {
+		return errors.Errorf("key `%s` can not be alias of itself", key)
+	}
+
+	defer s.notifyChanged()
+	s.Lock()
+	defer s.Unlock()
+
+	// copy-on-write, the old map is shared with snapshots
+	deprecated := make(map[string]deprecatedKey, len(s.deprecated)+1)
+	for k, dk := range s.deprecated {
+		deprecated[k] = dk
+	}
+	deprecated[key] = deprecatedKey{key: key, replacement: replacement, message: message}
+	old := s.deprecated
+	s.deprecated = deprecated
+
+	// migrate settings already loaded
+	groups := s.groups
+	for _, layer := range []Layer{LayerFile, LayerRemote} {
+		groups[layer] = make([]*layerGroup, 0, len(s.groups[layer]))
+		for _, group := range s.groups[layer] {
+			migrated := &layerGroup{name: group.name, reload: group.reload}
+			for _, src := range group.sources {
+				src, _ = s.migrateSource(src)
+				migrated.sources = append(migrated.sources, src)
+			}
+
+			groups[layer] = append(groups[layer], migrated)
+		}
+	}
+
+	snap, err := s.buildSnapshot(groups)
+	if err != nil {
+		s.deprecated = old
+		return err
+	}
+
+	s.groups = groups
+	s.publish(snap)
+	return nil
+}
+
+// warnDeprecated log warning once for every deprecated key
+func warnDeprecated(warned *sync.Map, dk deprecatedKey, source string) {
+	if _, ok := warned.LoadOrStore(dk.key, true); ok {
+		return
+	}
+
+	log.Shared.Warn("settings key is deprecated",
+		zap.String("key", dk.key),
+		zap.String("replacement", dk.replacement),
+		zap.String("source", source),
+		zap.String("message", dk.message))
+}
+
+// resolveKey map deprecated key to its replacement,
+// the longest deprecated key matches first, like `a.b` before `a`
+func (s *snapshot) resolveKey(key string) string {
+	if len(s.deprecated) == 0 {
+		return key
+	}
+
+	lkey := strings.ToLower(key)
+	for old := lkey; old != ""; {
+		if dk, ok := s.deprecated[old]; ok && dk.replacement != "" {
+			warnDeprecated(s.deprecatedWarned, dk, "Get")
+			return dk.replacement + lkey[len(old):]
+		}
+
+		i := strings.LastIndex(old, ".")
+		if i < 0 {
+			break
+		}
+		old = old[:i]
+	}
+
+	return key
+}
+
+// migrateSource move deprecated keys in src to their replacements,
+// src is copied if any deprecated key found. must be called with lock held.
+func (s *config) migrateSource(src layerSource) (migrated layerSource, found []string) {
+	if len(s.deprecated) == 0 {
+		return src, nil
+	}
+
+	// longer keys first, like `a.b` is migrated before `a`
+	olds := make([]string, 0, len(s.deprecated))
+	for old := range s.deprecated {
+		olds = append(olds, old)
+	}
+	sort.Slice(olds, func(i, j int) bool {
+		if len(olds[i]) != len(olds[j]) {
+			return len(olds[i]) > len(olds[j])
+		}
+
+		return olds[i] < olds[j]
+	})
+
+	var copied bool
+	for _, old := range olds {
+		dk := s.deprecated[old]
+		oldPath := strings.Split(old, ".")
+		val, ok := lookupSettings(src.settings, oldPath)
+		if !ok {
+			continue
+		}
+
+		found = append(found, old)
+		warnDeprecated(&s.deprecatedWarned, dk, src.name)
+		if !copied {
+			src.settings = copySettings(src.settings)
+			src.positions = copyPositions(src.positions)
+			copied = true
+		}
+
+		deleteSettings(src.settings, oldPath)
+		if dk.replacement == "" {
+			continue
+		}
+
+		newPath := strings.Split(dk.replacement, ".")
+		if _, ok := lookupSettings(src.settings, newPath); ok {
+			// replacement is also set, old key is ignored
+			continue
+		}
+
+		putSettings(src.settings, newPath, val)
+		for k, pos := range src.positions {
+			switch {
+			case k == old:
+				src.positions[dk.replacement] = pos
+			case strings.HasPrefix(k, old+"."):
+				src.positions[dk.replacement+k[len(old):]] = pos
+			}
+		}
+	}
+
+	return src, found
+}
+
+// lookupSettings find value in nested settings by path
+func lookupSettings(settings map[string]interface{}, path []string) (interface{}, bool) {
+	var cur interface{} = settings
+	for _, k := range path {
+		m, ok := cur.(map[string]interface{})
+		if !ok {
+			return nil, false
+		}
+
+		if cur, ok = m[k]; !ok {
+			return nil, false
+		}
+	}
+
+	return cur, true
+}
+
+// deleteSettings delete value in nested settings by path,
+// parents become empty are deleted too.
+func deleteSettings(settings map[string]interface{}, path []string) {
+	if len(path) == 1 {
+		delete(settings, path[0])
+		return
+	}
+
+	sub, ok := settings[path[0]].(map[string]interface{})
+	if !ok {
+		return
+	}
+
+	deleteSettings(sub, path[1:])
+	if len(sub) == 0 {
+		delete(settings, path[0])
+	}
+}
+
+// putSettings set value in nested settings by path, create parents if not exist
+func putSettings(settings map[string]interface{}, path []string, val interface{}) {
+	for _, k := range path[:len(path)-1] {
+		sub, ok := settings[k].(map[string]interface{})
+		if !ok {
+			sub = map[string]interface{}{}
+			settings[k] = sub
+		}
+
+		settings = sub
+	}
+
+	settings[path[len(path)-1]] = val
+}
+
+// copySettings deep copy nested maps in settings
+func copySettings(settings map[string]interface{}) map[string]interface{} {
+	copied := make(map[string]interface{}, len(settings))
+	for k, v := range settings {
+		if sub, ok := v.(map[string]interface{}); ok {
+			v = copySettings(sub)
+		}
+
+		copied[k] = v
+	}
+
+	return copied
+}
+
+func copyPositions(positions keyPositions) keyPositions {
+	copied := make(keyPositions, len(positions))
+	for k, pos := range positions {
+		copied[k] = pos
+	}
+
+	return copied
+}
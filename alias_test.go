@@ -0,0 +1,103 @@
+package config
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	gutils "github.com/Laisky/go-utils/v2"
+	"github.com/stretchr/testify/require"
+)
+
+func TestConfig_RegisterAlias(t *testing.T) {
+	dir := t.TempDir()
+	fpath := filepath.Join(dir, "settings.yml")
+	require.NoError(t, os.WriteFile(fpath, []byte(gutils.Dedent(`
+		db:
+		  addr: localhost
+		  opts:
+		    timeout: 3
+		legacy: 1
+		name: old
+		app:
+		  name: new
+	`)), 0644))
+
+	cfg := New()
+	require.NoError(t, cfg.RegisterAlias("db.addr", "database.host"))
+	require.NoError(t, cfg.RegisterAlias("db.opts", "database.options"))
+	require.NoError(t, cfg.RegisterAlias("name", "app.name"))
+	require.NoError(t, cfg.RegisterDeprecated("legacy", "", "not used anymore"))
+	require.NoError(t, cfg.LoadFromFile(fpath))
+
+	t.Run("migrated on load", func(t *testing.T) {
+		require.Equal(t, "localhost", cfg.GetString("database.host"))
+		require.Equal(t, 3, cfg.GetInt("database.options.timeout"))
+		require.False(t, cfg.IsSet("db"))
+		require.False(t, cfg.IsSet("legacy"))
+
+		// new key wins
+		require.Equal(t, "new", cfg.GetString("app.name"))
+
+		pos, ok := cfg.Origin("database.host")
+		require.True(t, ok)
+		require.Equal(t, Position{File: fpath, Line: 2, Column: 3}, pos)
+	})
+
+	t.Run("get by old key", func(t *testing.T) {
+		require.Equal(t, "localhost", cfg.GetString("db.addr"))
+		require.Equal(t, 3, cfg.GetInt("DB.Opts.Timeout"))
+		require.True(t, cfg.IsSet("db.addr"))
+
+		var opts struct {
+			Timeout int `mapstructure:"timeout"`
+		}
+		require.NoError(t, cfg.UnmarshalKeyStrict("db.opts", &opts))
+		require.Equal(t, 3, opts.Timeout)
+
+		cfg.Set("db.addr", "remote")
+		require.Equal(t, "remote", cfg.GetString("database.host"))
+	})
+
+	t.Run("register after load", func(t *testing.T) {
+		cfg := New()
+		require.NoError(t, cfg.LoadFromFile(fpath))
+		require.Equal(t, "localhost", cfg.GetString("db.addr"))
+
+		require.NoError(t, cfg.RegisterAlias("db.addr", "database.host"))
+		require.Equal(t, "localhost", cfg.GetString("database.host"))
+	})
+
+	t.Run("strict", func(t *testing.T) {
+		cfg := New()
+		cfg.SetStrict(true)
+		require.NoError(t, cfg.RegisterAlias("db.addr", "database.host"))
+		require.NoError(t, cfg.RegisterDeprecated("legacy", "", ""))
+
+		err := cfg.LoadFromFile(fpath)
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "deprecated keys in `"+fpath+"`")
+
+		require.NoError(t, cfg.ReadConfig(bytes.NewReader([]byte(`database: {host: localhost}`)), "yaml"))
+	})
+
+	t.Run("longest match", func(t *testing.T) {
+		cfg := New()
+		require.NoError(t, cfg.RegisterAlias("db", "storage"))
+		require.NoError(t, cfg.RegisterAlias("db.addr", "database.host"))
+		require.NoError(t, cfg.LoadFromFile(fpath))
+
+		for i := 0; i < 10; i++ {
+			require.Equal(t, "localhost", cfg.GetString("database.host"))
+			require.Equal(t, "localhost", cfg.GetString("db.addr"))
+			require.Equal(t, 3, cfg.GetInt("db.opts.timeout"))
+			require.Equal(t, 3, cfg.GetInt("storage.opts.timeout"))
+		}
+	})
+
+	t.Run("invalid", func(t *testing.T) {
+		require.Error(t, New().RegisterAlias("", "a"))
+		require.Error(t, New().RegisterAlias("a", "A"))
+	})
+}
@@ -0,0 +1,250 @@
+package config
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/Laisky/go-utils/v2/encrypt"
+	"github.com/Laisky/go-utils/v2/log"
+	"github.com/stretchr/testify/require"
+)
+
+// benchmarks of reads and reloads, run by `make bench`,
+// compare with the baseline in `testdata/bench_baseline.txt` by `make bench-compare`.
+
+// quietLog disable info logs during benchmark
+func quietLog(b *testing.B) {
+	require.NoError(b, log.Shared.ChangeLevel(log.LevelError))
+	b.Cleanup(func() {
+		_ = log.Shared.ChangeLevel(log.LevelInfo)
+	})
+}
+
+// genYAML generate yaml with sections*keys keys, like `s0.k0: v0`
+func genYAML(sections, keys int) []byte {
+	buf := new(bytes.Buffer)
+	for i := 0; i < sections; i++ {
+		fmt.Fprintf(buf, "s%d:\n", i)
+		for j := 0; j < keys; j++ {
+			fmt.Fprintf(buf, "  k%d: v%d\n", j, j)
+		}
+	}
+
+	return buf.Bytes()
+}
+
+func writeBenchFile(b *testing.B, fpath string, cnt []byte) string {
+	require.NoError(b, os.WriteFile(fpath, cnt, 0644))
+	return fpath
+}
+
+func newBenchConfig(b *testing.B, sections, keys int) (Config, string) {
+	quietLog(b)
+	fpath := writeBenchFile(b, filepath.Join(b.TempDir(), "settings.yml"), genYAML(sections, keys))
+	cfg := New()
+	require.NoError(b, cfg.LoadFromFile(fpath))
+	return cfg, fpath
+}
+
+func BenchmarkConfig_GetString(b *testing.B) {
+	cfg, _ := newBenchConfig(b, 10, 10)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if cfg.GetString("s5.k5") != "v5" {
+			b.Fatal("unexpected value")
+		}
+	}
+}
+
+func BenchmarkConfig_GetStringParallel(b *testing.B) {
+	cfg, _ := newBenchConfig(b, 10, 10)
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			if cfg.GetString("s5.k5") != "v5" {
+				b.Error("unexpected value")
+				return
+			}
+		}
+	})
+}
+
+func BenchmarkConfig_IsSetParallel(b *testing.B) {
+	cfg, _ := newBenchConfig(b, 10, 10)
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			if !cfg.IsSet("s5.k5") {
+				b.Error("unexpected value")
+				return
+			}
+		}
+	})
+}
+
+// BenchmarkConfig_GetStringDuringReload parallel reads while file reloaded continuously
+func BenchmarkConfig_GetStringDuringReload(b *testing.B) {
+	cfg, _ := newBenchConfig(b, 10, 10)
+	ctx, cancel := context.WithCancel(context.Background())
+	reloaded := make(chan int)
+	go func() {
+		var n int
+		defer func() { reloaded <- n }()
+		for ctx.Err() == nil {
+			if err := cfg.ReloadLayer(LayerFile); err != nil {
+				b.Error(err)
+				return
+			}
+			n++
+		}
+	}()
+
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			if cfg.GetString("s5.k5") != "v5" {
+				b.Error("unexpected value")
+				return
+			}
+		}
+	})
+	b.StopTimer()
+
+	cancel()
+	b.ReportMetric(float64(<-reloaded)/float64(b.N), "reloads/op")
+}
+
+func BenchmarkConfig_SnapshotParallel(b *testing.B) {
+	cfg, _ := newBenchConfig(b, 10, 10)
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			snap := cfg.Snapshot()
+			if snap.GetString("s5.k5") != "v5" || snap.GetString("s5.k6") != "v6" {
+				b.Error("unexpected value")
+				return
+			}
+		}
+	})
+}
+
+func BenchmarkKey_GetParallel(b *testing.B) {
+	cfg, _ := newBenchConfig(b, 10, 10)
+	key := NewKey[string](cfg, "s5.k5")
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			if v, err := key.Get(); err != nil || v != "v5" {
+				b.Error("unexpected value")
+				return
+			}
+		}
+	})
+}
+
+func BenchmarkConfig_Set(b *testing.B) {
+	for _, keys := range []int{100, 10000} {
+		b.Run(fmt.Sprintf("keys=%d", keys), func(b *testing.B) {
+			cfg, _ := newBenchConfig(b, keys/100, 100)
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				cfg.Set("s0.k0", i)
+			}
+		})
+	}
+}
+
+func BenchmarkConfig_UnmarshalKey(b *testing.B) {
+	cfg, _ := newBenchConfig(b, 10, 10)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		var section map[string]string
+		if err := cfg.UnmarshalKey("s5", &section); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkConfig_LoadFromFile(b *testing.B) {
+	for _, keys := range []int{100, 10000} {
+		b.Run(fmt.Sprintf("keys=%d", keys), func(b *testing.B) {
+			quietLog(b)
+			fpath := writeBenchFile(b, filepath.Join(b.TempDir(), "settings.yml"), genYAML(keys/100, 100))
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if err := New().LoadFromFile(fpath); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+// BenchmarkConfig_LoadFromFileInclude include chain like `0.yml -> 1.yml -> ... -> 9.yml`
+func BenchmarkConfig_LoadFromFileInclude(b *testing.B) {
+	quietLog(b)
+	dir := b.TempDir()
+	const depth = 10
+	for i := 0; i < depth; i++ {
+		cnt := genYAML(1, 100)
+		cnt = bytes.ReplaceAll(cnt, []byte("s0:"), []byte(fmt.Sprintf("s%d:", i)))
+		if i < depth-1 {
+			cnt = append([]byte(fmt.Sprintf("include: %d.yml\n", i+1)), cnt...)
+		}
+
+		writeBenchFile(b, filepath.Join(dir, fmt.Sprintf("%d.yml", i)), cnt)
+	}
+
+	entry := filepath.Join(dir, "0.yml")
+	cfg := New()
+	require.NoError(b, cfg.LoadFromFile(entry, WithEnableInclude()))
+	require.Equal(b, "v1", cfg.GetString(fmt.Sprintf("s%d.k1", depth-1)))
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if err := New().LoadFromFile(entry, WithEnableInclude()); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkConfig_LoadFromFileEncrypted(b *testing.B) {
+	quietLog(b)
+	secret := []byte("secret")
+	encrypted, err := encrypt.EncryptByAes(secret, genYAML(10, 100))
+	require.NoError(b, err)
+	fpath := writeBenchFile(b, filepath.Join(b.TempDir(), "settings.yml.enc"), encrypted)
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if err := New().LoadFromFile(fpath, WithAesEncrypt(secret)); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// BenchmarkConfig_MergeConfigParallel merge config while reading in parallel
+func BenchmarkConfig_MergeConfigParallel(b *testing.B) {
+	cfg, _ := newBenchConfig(b, 10, 10)
+	patch := []byte("s0: {k0: merged}\n")
+
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		var i int
+		for pb.Next() {
+			if i++; i%100 == 0 {
+				if err := cfg.MergeConfig(bytes.NewReader(patch), "yaml"); err != nil {
+					b.Error(err)
+					return
+				}
+				continue
+			}
+
+			_ = cfg.GetString("s5.k5")
+		}
+	})
+}
@@ -0,0 +1,233 @@
+package config
+
+import (
+	"reflect"
+	"sync"
+	"sync/atomic"
+
+	"github.com/Laisky/go-utils/v2/log"
+	"github.com/Laisky/zap"
+	"github.com/pkg/errors"
+)
+
+// Validator struct bound by `Bind` can implement this interface
+// to validate settings before published
+type Validator interface {
+	Validate() error
+}
+
+// WithBindKey unmarshal settings under key, for `Bind`
+func WithBindKey(key string) Option {
+	return func(opt *option) error {
+		opt.bindKey = key
+		return nil
+	}
+}
+
+// WithValidator validate settings before published, for `Bind`
+//
+// obj is a pointer of the same type as the one passed to `Bind`.
+func WithValidator(validate func(obj interface{}) error) Option {
+	return func(opt *option) error {
+		if validate == nil {
+			return errors.New("validator is nil")
+		}
+
+		opt.validator = validate
+		return nil
+	}
+}
+
+// Binding struct kept up to date with settings, created by `Bind`
+type Binding struct {
+	cfg *config
+	opt *option
+	typ reflect.Type
+	// defaults copy of the struct passed to `Bind` before first unmarshaled,
+	// every reload starts from it, so fields absent from settings keep defaults.
+	defaults reflect.Value
+
+	mu sync.Mutex
+	// rev revision of settings last unmarshaled
+	rev uint64
+	val atomic.Value
+}
+
+// Bind unmarshal settings into ptr, and unmarshal again once settings changed,
+// like file reloaded by watcher or remote updated.
+//
+// ptr must be a pointer to struct, its fields are kept as defaults
+// for keys absent from settings, on every reload. ptr is filled at once,
+// but later changes are published as new copies, use `Binding.Load`
+// to get the latest one.
+//
+// settings are validated by `Validator` and `WithValidator` before published,
+// invalid changes are logged and discarded, the previous one is kept.
+//
+//	binding, err := cfg.Bind(&Settings{}, config.WithBindKey("app"))
+//	settings := binding.Load().(*Settings)
+func (s *config) Bind(ptr interface{}, opts ...Option) (*Binding, error) {
+	opt, err := new(option).fillDefault().applyOptfs(opts...)
+	if err != nil {
+		return nil, errors.Wrap(err, "apply options")
+	}
+
+	typ := reflect.TypeOf(ptr)
+	if typ == nil || typ.Kind() != reflect.Ptr || typ.Elem().Kind() != reflect.Struct {
+		return nil, errors.Errorf("ptr should be a pointer to struct, got %T", ptr)
+	}
+
+	snap := s.load()
+	b := &Binding{
+		cfg:      s,
+		opt:      opt,
+		typ:      typ.Elem(),
+		defaults: deepCopy(reflect.ValueOf(ptr).Elem()),
+		rev:      snap.rev,
+	}
+	if err = b.decode(snap, ptr); err != nil {
+		return nil, err
+	}
+	b.val.Store(ptr)
+
+	s.Lock()
+	s.bindings = append(s.bindings, b)
+	s.Unlock()
+
+	// settings may changed before registered
+	if err = b.reload(); err != nil {
+		log.Shared.Error("reload bound settings, keep the previous one",
+			zap.String("type", b.typ.String()),
+			zap.Error(err))
+	}
+
+	return b, nil
+}
+
+// Load get the latest settings, the pointer of the same type passed to `Bind`.
+//
+// returned object is shared, do not modify it.
+func (b *Binding) Load() interface{} {
+	return b.val.Load()
+}
+
+// Close stop updating
+func (b *Binding) Close() {
+	b.cfg.Lock()
+	defer b.cfg.Unlock()
+
+	for i, binding := range b.cfg.bindings {
+		if binding == b {
+			b.cfg.bindings = append(b.cfg.bindings[:i], b.cfg.bindings[i+1:]...)
+			return
+		}
+	}
+}
+
+// decode unmarshal settings in snap into obj and validate it
+func (b *Binding) decode(snap *snapshot, obj interface{}) error {
+	if err := snap.unmarshal(b.opt.bindKey, obj, false); err != nil {
+		return errors.Wrap(err, "unmarshal settings")
+	}
+
+	if v, ok := obj.(Validator); ok {
+		if err := v.Validate(); err != nil {
+			return errors.Wrap(err, "validate settings")
+		}
+	}
+
+	if b.opt.validator != nil {
+		if err := b.opt.validator(obj); err != nil {
+			return errors.Wrap(err, "validate settings")
+		}
+	}
+
+	return nil
+}
+
+// reload unmarshal again if settings changed
+func (b *Binding) reload() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	snap := b.cfg.load()
+	if snap.rev == b.rev {
+		return nil
+	}
+	b.rev = snap.rev
+
+	obj := reflect.New(b.typ)
+	obj.Elem().Set(deepCopy(b.defaults))
+	if err := b.decode(snap, obj.Interface()); err != nil {
+		return err
+	}
+
+	b.val.Store(obj.Interface())
+	return nil
+}
+
+// deepCopy copy v recursively, so that unmarshaling into the copy
+// never writes into maps, slices or pointers shared with v
+func deepCopy(v reflect.Value) reflect.Value {
+	cp := reflect.New(v.Type()).Elem()
+	switch v.Kind() {
+	case reflect.Ptr:
+		if !v.IsNil() {
+			ptr := reflect.New(v.Type().Elem())
+			ptr.Elem().Set(deepCopy(v.Elem()))
+			cp.Set(ptr)
+		}
+	case reflect.Interface:
+		if !v.IsNil() {
+			cp.Set(deepCopy(v.Elem()))
+		}
+	case reflect.Struct:
+		// unexported fields are copied shallowly
+		cp.Set(v)
+		for i := 0; i < v.NumField(); i++ {
+			if cp.Field(i).CanSet() {
+				cp.Field(i).Set(deepCopy(v.Field(i)))
+			}
+		}
+	case reflect.Map:
+		if !v.IsNil() {
+			m := reflect.MakeMapWithSize(v.Type(), v.Len())
+			for iter := v.MapRange(); iter.Next(); {
+				m.SetMapIndex(deepCopy(iter.Key()), deepCopy(iter.Value()))
+			}
+			cp.Set(m)
+		}
+	case reflect.Slice:
+		if !v.IsNil() {
+			sl := reflect.MakeSlice(v.Type(), v.Len(), v.Len())
+			for i := 0; i < v.Len(); i++ {
+				sl.Index(i).Set(deepCopy(v.Index(i)))
+			}
+			cp.Set(sl)
+		}
+	case reflect.Array:
+		for i := 0; i < v.Len(); i++ {
+			cp.Index(i).Set(deepCopy(v.Index(i)))
+		}
+	default:
+		cp.Set(v)
+	}
+
+	return cp
+}
+
+// notifyChanged update all bindings,
+// must be called without lock held.
+func (s *config) notifyChanged() {
+	s.RLock()
+	bindings := append([]*Binding{}, s.bindings...)
+	s.RUnlock()
+
+	for _, b := range bindings {
+		if err := b.reload(); err != nil {
+			log.Shared.Error("reload bound settings, keep the previous one",
+				zap.String("type", b.typ.String()),
+				zap.Error(err))
+		}
+	}
+}
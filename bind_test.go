@@ -0,0 +1,185 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	gutils "github.com/Laisky/go-utils/v2"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+)
+
+type bindTestDB struct {
+	Host string `mapstructure:"host"`
+	Port int    `mapstructure:"port"`
+}
+
+func (db *bindTestDB) Validate() error {
+	if db.Port <= 0 {
+		return errors.Errorf("invalid port %d", db.Port)
+	}
+
+	return nil
+}
+
+type bindTestSettings struct {
+	Name string     `mapstructure:"name"`
+	DB   bindTestDB `mapstructure:"db"`
+}
+
+func TestConfig_Bind(t *testing.T) {
+	fpath := filepath.Join(t.TempDir(), "settings.yml")
+	write := func(cnt string) {
+		require.NoError(t, os.WriteFile(fpath, []byte(gutils.Dedent(cnt)), 0644))
+	}
+	write(`
+		name: app
+		db:
+		  host: localhost
+		  port: 3306
+	`)
+
+	cfg := New()
+	require.NoError(t, cfg.LoadFromFile(fpath))
+
+	st := new(bindTestSettings)
+	all, err := cfg.Bind(st)
+	require.NoError(t, err)
+	require.Same(t, st, all.Load())
+	require.Equal(t, "app", st.Name)
+
+	db, err := cfg.Bind(new(bindTestDB), WithBindKey("db"))
+	require.NoError(t, err)
+	require.Equal(t, 3306, db.Load().(*bindTestDB).Port)
+
+	named, err := cfg.Bind(new(bindTestSettings), WithValidator(func(obj interface{}) error {
+		if obj.(*bindTestSettings).Name == "" {
+			return errors.New("name is empty")
+		}
+
+		return nil
+	}))
+	require.NoError(t, err)
+
+	t.Run("reload", func(t *testing.T) {
+		write(`
+			name: app2
+			db:
+			  host: remote
+			  port: 3307
+		`)
+		require.NoError(t, cfg.ReloadLayer(LayerFile))
+
+		require.Equal(t, "app2", all.Load().(*bindTestSettings).Name)
+		require.Equal(t, "remote", db.Load().(*bindTestDB).Host)
+		require.Equal(t, "app2", named.Load().(*bindTestSettings).Name)
+
+		// published as new copy
+		require.Equal(t, "app", st.Name)
+
+		cfg.Set("db.port", 3308)
+		require.Equal(t, 3308, db.Load().(*bindTestDB).Port)
+	})
+
+	t.Run("invalid change discarded", func(t *testing.T) {
+		cfg.Set("db.port", 0)
+		require.Equal(t, 3308, db.Load().(*bindTestDB).Port)
+		require.Equal(t, 0, all.Load().(*bindTestSettings).DB.Port)
+
+		cfg.Set("name", "")
+		require.Equal(t, "app2", named.Load().(*bindTestSettings).Name)
+
+		cfg.Set("db.port", 3309)
+		require.Equal(t, 3309, db.Load().(*bindTestDB).Port)
+	})
+
+	t.Run("close", func(t *testing.T) {
+		db.Close()
+		cfg.Set("db.port", 3310)
+		require.Equal(t, 3309, db.Load().(*bindTestDB).Port)
+	})
+
+	t.Run("invalid", func(t *testing.T) {
+		_, err := cfg.Bind(bindTestSettings{})
+		require.Error(t, err)
+		_, err = cfg.Bind(nil)
+		require.Error(t, err)
+		_, err = cfg.Bind(new(bindTestDB), WithBindKey("name"))
+		require.Error(t, err)
+		_, err = cfg.Bind(new(bindTestDB), WithValidator(nil))
+		require.Error(t, err)
+	})
+}
+
+type bindTestDefaults struct {
+	Name   string            `mapstructure:"name"`
+	DB     bindTestDB        `mapstructure:"db"`
+	Labels map[string]string `mapstructure:"labels"`
+}
+
+func TestConfig_BindDefaults(t *testing.T) {
+	fpath := filepath.Join(t.TempDir(), "settings.yml")
+	write := func(cnt string) {
+		require.NoError(t, os.WriteFile(fpath, []byte(gutils.Dedent(cnt)), 0644))
+	}
+	write(`
+		db:
+		  host: localhost
+		labels:
+		  env: test
+	`)
+
+	cfg := New()
+	require.NoError(t, cfg.LoadFromFile(fpath))
+
+	st := &bindTestDefaults{
+		Name:   "default",
+		DB:     bindTestDB{Port: 5432},
+		Labels: map[string]string{"team": "infra"},
+	}
+	binding, err := cfg.Bind(st)
+	require.NoError(t, err)
+	require.Equal(t, "default", st.Name)
+	require.Equal(t, 5432, st.DB.Port)
+	require.Equal(t, "localhost", st.DB.Host)
+
+	write(`
+		db:
+		  host: remote
+		labels:
+		  env: prod
+	`)
+	require.NoError(t, cfg.ReloadLayer(LayerFile))
+
+	got := binding.Load().(*bindTestDefaults)
+	require.Equal(t, "remote", got.DB.Host)
+	require.Equal(t, "default", got.Name)
+	require.Equal(t, 5432, got.DB.Port)
+	require.Equal(t, map[string]string{"team": "infra", "env": "prod"}, got.Labels)
+
+	// published copies do not share maps with each other
+	require.Equal(t, map[string]string{"team": "infra", "env": "test"}, st.Labels)
+
+	cfg.Set("name", "app")
+	require.Equal(t, "app", binding.Load().(*bindTestDefaults).Name)
+	require.Equal(t, "prod", binding.Load().(*bindTestDefaults).Labels["env"])
+	require.Equal(t, "prod", got.Labels["env"])
+}
+
+func TestConfig_BindWatch(t *testing.T) {
+	fpath := filepath.Join(t.TempDir(), "settings.yml")
+	require.NoError(t, os.WriteFile(fpath, []byte("db: {host: localhost, port: 3306}\n"), 0644))
+
+	cfg := New()
+	require.NoError(t, cfg.LoadFromFile(fpath, WithWatchFileModified(nil)))
+
+	db, err := cfg.Bind(new(bindTestDB), WithBindKey("db"))
+	require.NoError(t, err)
+
+	require.NoError(t, os.WriteFile(fpath, []byte("db: {host: remote, port: 3307}\n"), 0644))
+	require.Eventually(t, func() bool {
+		return db.Load().(*bindTestDB).Port == 3307
+	}, 5*time.Second, 10*time.Millisecond)
+}
@@ -0,0 +1,201 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	gutils "github.com/Laisky/go-utils/v2"
+	"github.com/Laisky/go-utils/v2/log"
+	"github.com/Laisky/zap"
+	"github.com/fsnotify/fsnotify"
+	"github.com/pkg/errors"
+)
+
+// confDirName sub directory to put extra config files
+const confDirName = "conf.d"
+
+// WithMergeAllFiles merge all supported files in directory, for `LoadFromDir`
+//
+// files in dir are merged in lexical order, then files in `conf.d/` subdir,
+// latter files override former ones. different formats (yaml/toml/json...)
+// can be mixed, encrypted files are detected by suffix.
+// hidden files, and encrypted files without `WithAesEncrypt`, are ignored.
+//
+// with `WithWatchFileModified`, dir is reloaded when any file created,
+// modified or removed.
+func WithMergeAllFiles() Option {
+	return func(opt *option) error {
+		opt.mergeAllFiles = true
+		return nil
+	}
+}
+
+// isSupportedConfigFile whether file is in format supported by viper,
+// encrypted file is supported only if aes key is set
+func isSupportedConfigFile(opt *option, fname string) bool {
+	if strings.HasPrefix(filepath.Base(fname), ".") ||
+		isEncryptedWithoutKey(opt, fname) {
+		return false
+	}
+
+	return isSupportedFormat(configFileType(opt, fname))
+}
+
+// isEncryptedWithoutKey whether file has encrypted suffix but aes key not set
+func isEncryptedWithoutKey(opt *option, fname string) bool {
+	return opt.encryptedSuffix != "" &&
+		strings.HasSuffix(fname, opt.encryptedSuffix) &&
+		!isSettingsFileEncrypted(opt, fname)
+}
+
+// listConfigFiles list all supported files in dir and its `conf.d/`, in merging order
+func listConfigFiles(opt *option, dirPath string) ([]string, error) {
+	var files []string
+	for _, dir := range []string{dirPath, opt.joinPath(dirPath, confDirName)} {
+		entries, err := opt.readDir(dir)
+		if err != nil {
+			if os.IsNotExist(err) && dir != dirPath {
+				// conf.d is optional
+				continue
+			}
+
+			return nil, errors.Wrapf(err, "read dir `%s`", dir)
+		}
+
+		var names []string
+		for _, entry := range entries {
+			if !entry.IsDir() && isEncryptedWithoutKey(opt, entry.Name()) {
+				log.Shared.Warn("skip encrypted file without aes key",
+					zap.String("file", opt.joinPath(dir, entry.Name())))
+			}
+			if entry.IsDir() || !isSupportedConfigFile(opt, entry.Name()) {
+				continue
+			}
+
+			names = append(names, entry.Name())
+		}
+
+		sort.Strings(names)
+		for _, name := range names {
+			files = append(files, opt.joinPath(dir, name))
+		}
+	}
+
+	return files, nil
+}
+
+// readMergedDir read all config files in dir
+func readMergedDir(opt *option, dirPath string) ([]layerSource, error) {
+	files, err := listConfigFiles(opt, dirPath)
+	if err != nil {
+		return nil, err
+	}
+
+	sources := make([]layerSource, 0, len(files))
+	for _, fpath := range files {
+		src, err := readConfigFile(opt, fpath)
+		if err != nil {
+			return nil, err
+		}
+
+		sources = append(sources, src)
+	}
+
+	return sources, nil
+}
+
+// loadMergedDir merge all config files in dir
+func (s *config) loadMergedDir(opt *option, dirPath string) error {
+	sources, err := readMergedDir(opt, dirPath)
+	if err != nil {
+		return err
+	}
+
+	if err = s.setLayerGroup(LayerFile, &layerGroup{
+		name:    dirPath,
+		sources: sources,
+		reload: func() ([]layerSource, error) {
+			return readMergedDir(opt, dirPath)
+		},
+	}); err != nil {
+		return errors.Wrapf(err, "load settings from dir `%s`", dirPath)
+	}
+
+	files := make([]string, 0, len(sources))
+	for _, src := range sources {
+		files = append(files, src.name)
+	}
+
+	log.Shared.Info("load configs from dir",
+		zap.String("dir", dirPath),
+		zap.Strings("config_files", files))
+	return nil
+}
+
+// watchMergedDir reload when any config file in dir or `conf.d/`
+// is created, modified or removed
+func (s *config) watchMergedDir(opt *option, dirPath string) {
+	s.watchOnce("dir:"+dirPath, func() {
+		watcher, err := fsnotify.NewWatcher()
+		if err != nil {
+			log.Shared.Error("new dir watcher", zap.Error(err))
+			return
+		}
+
+		confDir := filepath.Join(dirPath, confDirName)
+		for _, dir := range []string{dirPath, confDir} {
+			if err = watcher.Add(dir); err != nil {
+				if dir == confDir && os.IsNotExist(err) {
+					continue
+				}
+
+				log.Shared.Error("watch dir error", zap.Error(err), zap.String("dir", dir))
+				gutils.SilentClose(watcher)
+				return
+			}
+		}
+
+		go func() {
+			defer gutils.SilentClose(watcher)
+			for {
+				select {
+				case e, ok := <-watcher.Events:
+					if !ok {
+						return
+					}
+
+					if e.Name == confDir && e.Op&fsnotify.Create != 0 {
+						// conf.d created after started
+						if err := watcher.Add(confDir); err != nil {
+							log.Shared.Error("watch dir error", zap.Error(err), zap.String("dir", confDir))
+						}
+					}
+
+					if e.Op == fsnotify.Chmod ||
+						(e.Name != confDir && !isSupportedConfigFile(opt, e.Name)) {
+						continue
+					}
+
+					if err := s.loadMergedDir(opt, dirPath); err != nil {
+						log.Shared.Error("dir watcher auto reload settings", zap.Error(err))
+						continue
+					}
+
+					if opt.watchModifyCallback != nil {
+						opt.watchModifyCallback(e)
+					}
+				case err, ok := <-watcher.Errors:
+					if !ok {
+						return
+					}
+
+					log.Shared.Error("dir watcher", zap.Error(err))
+				}
+			}
+		}()
+
+		log.Shared.Debug("watching config dir", zap.String("dir", dirPath))
+	})
+}
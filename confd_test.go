@@ -0,0 +1,108 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	gutils "github.com/Laisky/go-utils/v2"
+	"github.com/Laisky/go-utils/v2/encrypt"
+	"github.com/fsnotify/fsnotify"
+	"github.com/stretchr/testify/require"
+)
+
+func TestListConfigFiles(t *testing.T) {
+	dir := t.TempDir()
+	for _, f := range []string{
+		"b.yml", "a.toml", "c.json", "d.yml.enc", "README.md", ".hidden.yml",
+		"conf.d/01.yml", "conf.d/00.toml", "conf.d/unknown",
+	} {
+		require.NoError(t, os.MkdirAll(filepath.Dir(filepath.Join(dir, f)), 0755))
+		require.NoError(t, os.WriteFile(filepath.Join(dir, f), nil, 0644))
+	}
+
+	opt, err := new(option).fillDefault().applyOptfs()
+	require.NoError(t, err)
+	files, err := listConfigFiles(opt, dir)
+	require.NoError(t, err)
+	require.Equal(t, []string{
+		filepath.Join(dir, "a.toml"),
+		filepath.Join(dir, "b.yml"),
+		filepath.Join(dir, "c.json"),
+		filepath.Join(dir, "conf.d", "00.toml"),
+		filepath.Join(dir, "conf.d", "01.yml"),
+	}, files)
+
+	t.Run("encrypted", func(t *testing.T) {
+		opt, err := new(option).fillDefault().applyOptfs(WithAesEncrypt([]byte("secret")))
+		require.NoError(t, err)
+		files, err := listConfigFiles(opt, dir)
+		require.NoError(t, err)
+		require.Contains(t, files, filepath.Join(dir, "d.yml.enc"))
+	})
+
+	t.Run("without conf.d", func(t *testing.T) {
+		dir := t.TempDir()
+		require.NoError(t, os.WriteFile(filepath.Join(dir, "a.yml"), nil, 0644))
+		files, err := listConfigFiles(opt, dir)
+		require.NoError(t, err)
+		require.Equal(t, []string{filepath.Join(dir, "a.yml")}, files)
+	})
+}
+
+func TestConfig_LoadFromDir_mergeAllFiles(t *testing.T) {
+	dir := t.TempDir()
+	secret := []byte("secret")
+	confDir := filepath.Join(dir, confDirName)
+	require.NoError(t, os.Mkdir(confDir, 0755))
+
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "00-base.yml"), []byte(gutils.Dedent(`
+		name: base
+		db:
+		  host: localhost
+		  port: 3306
+	`)), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "10-db.toml"), []byte(gutils.Dedent(`
+		[db]
+		host = "toml"
+	`)), 0644))
+	encrypted, err := encrypt.EncryptByAes(secret, []byte(`{"db": {"password": "p@ss"}}`))
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "20-secret.json.enc"), encrypted, 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(confDir, "override.yml"), []byte("name: conf.d\n"), 0644))
+
+	cfg := New()
+	reloaded := make(chan struct{}, 10)
+	err = cfg.LoadFromDir(dir,
+		WithMergeAllFiles(),
+		WithAesEncrypt(secret),
+		WithWatchFileModified(func(e fsnotify.Event) {
+			reloaded <- struct{}{}
+		}),
+	)
+	require.NoError(t, err)
+
+	require.Equal(t, "conf.d", cfg.GetString("name"))
+	require.Equal(t, "toml", cfg.GetString("db.host"))
+	require.Equal(t, 3306, cfg.GetInt("db.port"))
+	require.Equal(t, "p@ss", cfg.GetString("db.password"))
+
+	t.Run("new file", func(t *testing.T) {
+		require.NoError(t, os.WriteFile(filepath.Join(confDir, "zz.json"), []byte(`{"db": {"port": 3307}}`), 0644))
+
+		select {
+		case <-reloaded:
+		case <-time.After(3 * time.Second):
+			t.Fatal("settings not reloaded")
+		}
+
+		time.Sleep(100 * time.Millisecond)
+		require.Equal(t, 3307, cfg.GetInt("db.port"))
+	})
+
+	t.Run("conflict options", func(t *testing.T) {
+		err := New().LoadFromDir(dir, WithMergeAllFiles(), WithKeyPerFile())
+		require.Error(t, err)
+	})
+}
@@ -4,7 +4,8 @@ import (
 	"bytes"
 	"context"
 	"io"
-	"os"
+	"io/fs"
+	"net/http"
 	"path/filepath"
 	"strings"
 	"sync"
@@ -12,13 +13,12 @@ import (
 	"time"
 
 	gutils "github.com/Laisky/go-utils/v2"
-	"github.com/Laisky/go-utils/v2/encrypt"
 	"github.com/Laisky/go-utils/v2/log"
 	zap "github.com/Laisky/zap"
 	"github.com/fsnotify/fsnotify"
 	"github.com/pkg/errors"
+	"github.com/spf13/cast"
 	"github.com/spf13/pflag"
-	"github.com/spf13/viper"
 )
 
 // Config to load configurations from file
@@ -27,12 +27,24 @@ import (
 //
 // support encrypted file with AES
 //
-// support `include: xxx.toml` to include other file
+// support `include: xxx.toml` to include other file,
+// use `WithMergeStrategy` to merge lists and `!reset` or null to delete included keys
+//
+// support profiles like `settings.prod.yml` by `WithProfile`
+//
+// support formats of viper, and jsonc, hcl2, cue with constraints validated on load,
+// and nested dotenv keys like `DB__HOST`
+//
+// support save settings back to file by `Save` and edit files by `EditFile`,
+// comments are preserved
 //
 // support watch file changes and auto reload
 //
 // goroutine-safe viper
 //
+// layered settings, default < file < remote < env < flag < override,
+// use `Explain` to find out where the value comes from
+//
 // Example
 //
 //	  import gconfig "github.com/Laisky/go-config"
@@ -48,7 +60,38 @@ import (
 //
 // More informations can be found at godoc samples
 type Config interface {
+	Reader
 	BindPFlags(p *pflag.FlagSet) error
+	Sub(key string) Config
+	Snapshot() Reader
+	Bind(ptr interface{}, opts ...Option) (*Binding, error)
+	Set(key string, val interface{})
+	SetStrict(strict bool)
+	RegisterAlias(oldKey, newKey string) error
+	RegisterDeprecated(key, replacement, message string) error
+	RegisterMigration(from int, migration Migration) error
+	MigrateFile(fpath string, opts ...Option) (from, to int, err error)
+	RunMigrateCommand(out io.Writer, args []string, opts ...Option) error
+	Save(fpath string, opts ...Option) error
+	SaveAs(fpath string, opts ...Option) error
+	ReadConfig(in io.Reader, format string) error
+	MergeConfig(in io.Reader, format string) error
+	LoadFromDir(dirPath string, opts ...Option) error
+	LoadFromFile(entryFile string, opts ...Option) (err error)
+	LoadDefaultsFromFile(entryFile string, opts ...Option) error
+	loadConfigFiles(opt *option, entryFile string) (cfgFiles []string, sources []layerSource, err error)
+	LoadFromConfigServer(url, app, profile, label string) (err error)
+	LoadFromConfigServerWithRawYaml(url, app, profile, label, key string) (err error)
+	LoadFromRemote(ctx context.Context, provider RemoteProvider, opts ...Option) error
+	LoadFromURL(ctx context.Context, entryURL string, opts ...Option) error
+	LoadFromEnv(prefix string) error
+	SetDefault(key string, val interface{})
+	ReloadLayer(layer Layer) error
+	LoadSettings()
+}
+
+// Reader read-only accessors of settings
+type Reader interface {
 	Get(key string) interface{}
 	GetString(key string) string
 	GetStringSlice(key string) []string
@@ -56,20 +99,29 @@ type Config interface {
 	GetInt(key string) int
 	GetInt64(key string) int64
 	GetDuration(key string) time.Duration
-	Set(key string, val interface{})
+	GetFloat64(key string) float64
+	GetUint(key string) uint
+	GetUint32(key string) uint32
+	GetUint64(key string) uint64
+	GetTime(key string) time.Time
+	GetIntSlice(key string) []int
+	GetSizeInBytes(key string) uint
+	GetStringMap(key string) map[string]interface{}
+	GetStringMapString(key string) map[string]string
+	AllKeys() []string
+	AllSettings() map[string]interface{}
+	InConfig(key string) bool
 	IsSet(key string) bool
 	Unmarshal(obj interface{}) error
 	UnmarshalKey(key string, obj interface{}) error
-	GetStringMap(key string) map[string]interface{}
-	GetStringMapString(key string) map[string]string
-	ReadConfig(in io.Reader) error
-	MergeConfig(in io.Reader) error
-	LoadFromDir(dirPath string, opts ...Option) error
-	LoadFromFile(entryFile string, opts ...Option) (err error)
-	loadConfigFiles(opt *option, cfgFiles []string) (err error)
-	LoadFromConfigServer(url, app, profile, label string) (err error)
-	LoadFromConfigServerWithRawYaml(url, app, profile, label, key string) (err error)
-	LoadSettings()
+	UnmarshalStrict(obj interface{}) error
+	UnmarshalKeyStrict(key string, obj interface{}) error
+	Explain(key string) (*Explanation, error)
+	Origin(key string) (Position, bool)
+	Namespace(prefix string) Reader
+	revision() uint64
+	// lookup get value and whether key is set, in the same snapshot
+	lookup(key string) (interface{}, bool)
 }
 
 // AtomicFieldBool is a bool field which is goroutine-safe
@@ -95,12 +147,50 @@ func (a *AtomicFieldBool) SetFalse() {
 const defaultConfigFileName = "settings.yml"
 
 // config type of project settings
+//
+// settings are organized in layers, see `Layer`.
+// a new snapshot is rebuilt from all layers and published once any layer changed,
+// so reads are lock-free.
 type config struct {
+	// RWMutex protects all fields below, readers should read from snap
 	sync.RWMutex
 
-	v *viper.Viper
-
-	watchOnce sync.Once
+	// snap latest *snapshot, published by `rebuild`
+	snap atomic.Value
+
+	// groups sources of file and remote layers
+	groups    [LayerOverride + 1][]*layerGroup
+	defaults  []keyValue
+	overrides []keyValue
+	flagsets  []*pflag.FlagSet
+	envPrefix string
+	// envEnabled load settings from env
+	envEnabled bool
+	// remoteCnt counter to name remote groups
+	remoteCnt int
+	// strict reject unknown keys and deprecated keys
+	strict bool
+	// deprecated deprecated keys, registered by `RegisterDeprecated`,
+	// copy-on-write since shared with snapshots
+	deprecated map[string]deprecatedKey
+	// deprecatedWarned deprecated keys already warned
+	deprecatedWarned sync.Map
+	// migrations settings migrations, key is the version to migrate from
+	migrations map[int]Migration
+	// bindings structs kept up to date by `Bind`
+	bindings []*Binding
+
+	// patched keys of defaults and overrides, see `patchKey`.
+	// patchedRead is the copy of patched shared with snapshots,
+	// it only grows, so can be read without lock.
+	patched     map[string]patchedKey
+	patchedRead sync.Map
+
+	// watching sources already watched, to start only one watcher per source
+	watching sync.Map
+	// ctx lives as long as config, used by background jobs
+	// like remote reloading and keeping alive
+	ctx context.Context
 }
 
 // Shared is the settings for this project
@@ -118,138 +208,305 @@ var S = Shared
 
 // New new settings
 func New() Config {
-	return &config{
-		v: viper.New(),
-	}
+	return newConfig()
+}
+
+func newConfig() *config {
+	s := &config{ctx: context.Background()}
+	// rebuild never fails without any settings
+	_ = s.rebuild()
+	return s
 }
 
 // BindPFlags bind pflags to settings
 func (s *config) BindPFlags(p *pflag.FlagSet) error {
-	return s.v.BindPFlags(p)
+	defer s.notifyChanged()
+	s.Lock()
+	defer s.Unlock()
+
+	s.flagsets = append(s.flagsets, p)
+	return s.rebuild()
 }
 
 // Get get setting by key
 func (s *config) Get(key string) interface{} {
-	s.RLock()
-	defer s.RUnlock()
-
-	return s.v.Get(key)
+	return s.load().Get(key)
 }
 
 // GetString get setting by key
 func (s *config) GetString(key string) string {
-	s.RLock()
-	defer s.RUnlock()
-
-	return s.v.GetString(key)
+	return s.load().GetString(key)
 }
 
 // GetStringSlice get setting by key
 func (s *config) GetStringSlice(key string) []string {
-	s.RLock()
-	defer s.RUnlock()
-
-	return s.v.GetStringSlice(key)
+	return s.load().GetStringSlice(key)
 }
 
 // GetBool get setting by key
 func (s *config) GetBool(key string) bool {
-	s.RLock()
-	defer s.RUnlock()
-
-	return s.v.GetBool(key)
+	return s.load().GetBool(key)
 }
 
 // GetInt get setting by key
 func (s *config) GetInt(key string) int {
-	s.RLock()
-	defer s.RUnlock()
-
-	return s.v.GetInt(key)
+	return s.load().GetInt(key)
 }
 
 // GetInt64 get setting by key
 func (s *config) GetInt64(key string) int64 {
-	s.RLock()
-	defer s.RUnlock()
-
-	return s.v.GetInt64(key)
+	return s.load().GetInt64(key)
 }
 
 // GetDuration get setting by key
 func (s *config) GetDuration(key string) time.Duration {
-	s.RLock()
-	defer s.RUnlock()
+	return s.load().GetDuration(key)
+}
+
+// GetFloat64 get setting by key
+func (s *config) GetFloat64(key string) float64 {
+	return s.load().GetFloat64(key)
+}
+
+// GetUint get setting by key
+func (s *config) GetUint(key string) uint {
+	return s.load().GetUint(key)
+}
+
+// GetUint32 get setting by key
+func (s *config) GetUint32(key string) uint32 {
+	return s.load().GetUint32(key)
+}
+
+// GetUint64 get setting by key
+func (s *config) GetUint64(key string) uint64 {
+	return s.load().GetUint64(key)
+}
+
+// GetTime get setting by key
+func (s *config) GetTime(key string) time.Time {
+	return s.load().GetTime(key)
+}
+
+// GetIntSlice get setting by key
+func (s *config) GetIntSlice(key string) []int {
+	return s.load().GetIntSlice(key)
+}
+
+// GetSizeInBytes get size setting by key, like `10mb` or `1 GB`
+func (s *config) GetSizeInBytes(key string) uint {
+	return s.load().GetSizeInBytes(key)
+}
+
+// AllKeys get all keys of settings, nested keys are joined by `.`
+func (s *config) AllKeys() []string {
+	return s.load().AllKeys()
+}
+
+// AllSettings get all settings as nested map
+func (s *config) AllSettings() map[string]interface{} {
+	return s.load().AllSettings()
+}
+
+// InConfig check whether key is set by file or remote settings
+func (s *config) InConfig(key string) bool {
+	return s.load().InConfig(key)
+}
+
+// Sub return a new goroutine-safe config contains settings under key,
+// return nil if key is not a map.
+//
+// settings are copied, changes of the origin config are not
+// reflected in returned config.
+func (s *config) Sub(key string) Config {
+	snap := s.load()
+	key = strings.ToLower(snap.resolveKey(key))
+	v := snap.mergedViper()
+	if _, err := cast.ToStringMapE(v.Get(key)); err != nil {
+		return nil
+	}
+
+	prefix := key + "."
+	kvs := map[string]interface{}{}
+	for _, k := range v.AllKeys() {
+		if strings.HasPrefix(k, prefix) {
+			kvs[strings.TrimPrefix(k, prefix)] = v.Get(k)
+		}
+	}
+
+	name := "Sub(" + key + ")"
+	sub := newConfig()
+	sub.strict = snap.strict
+	// rebuild never fails on settings already merged by parent
+	_ = sub.setGroup(LayerFile, &layerGroup{
+		name:    name,
+		sources: []layerSource{{name: name, settings: unflattenKeys(kvs)}},
+	})
 
-	return s.v.GetDuration(key)
+	return sub
 }
 
-// Set set setting by key
+// Set set setting by key, has the highest priority
+//
+// the merged settings are not rebuilt by Set,
+// overridden keys are read from a viper that only contains
+// settings by Set, which is built once in every snapshot.
 func (s *config) Set(key string, val interface{}) {
+	defer s.notifyChanged()
 	s.Lock()
 	defer s.Unlock()
 
-	s.v.Set(key, val)
+	key = s.load().resolveKey(key)
+	s.overrides = setKeyValue(s.overrides, key, val)
+	s.patchKey(key)
+	s.republish()
 }
 
 // IsSet check whether exists
 func (s *config) IsSet(key string) bool {
-	s.Lock()
-	defer s.Unlock()
-
-	return s.v.IsSet(key)
+	return s.load().IsSet(key)
 }
 
 // Unmarshal unmarshals the config into a Struct. Make sure that the tags
 // on the fields of the structure are properly set.
+//
+// positions of invalid keys are included in error.
 func (s *config) Unmarshal(obj interface{}) error {
-	s.RLock()
-	defer s.RUnlock()
-
-	return s.v.Unmarshal(obj)
+	return s.load().Unmarshal(obj)
 }
 
 // UnmarshalKey takes a single key and unmarshals it into a Struct.
+//
+// positions of invalid keys are included in error.
 func (s *config) UnmarshalKey(key string, obj interface{}) error {
-	s.RLock()
-	defer s.RUnlock()
-
-	return s.v.UnmarshalKey(key, obj)
+	return s.load().UnmarshalKey(key, obj)
 }
 
 // GetStringMap return map contains interface
 func (s *config) GetStringMap(key string) map[string]interface{} {
-	s.RLock()
-	defer s.RUnlock()
-
-	return s.v.GetStringMap(key)
+	return s.load().GetStringMap(key)
 }
 
 // GetStringMapString return map contains strings
 func (s *config) GetStringMapString(key string) map[string]string {
-	s.RLock()
-	defer s.RUnlock()
-
-	return s.v.GetStringMapString(key)
+	return s.load().GetStringMapString(key)
 }
 
-func (s *config) ReadConfig(in io.Reader) error {
+// readerSourceName name of settings loaded by `ReadConfig` and `MergeConfig`
+const readerSourceName = "io.Reader"
+
+// ReadConfig replace all settings in file layer by settings read from in
+//
+// format like `yaml` or `json`, detected from content if empty.
+func (s *config) ReadConfig(in io.Reader, format string) error {
+	src, err := readSource(in, format)
+	if err != nil {
+		return err
+	}
+
+	defer s.notifyChanged()
 	s.Lock()
 	defer s.Unlock()
 
-	return s.v.ReadConfig(in)
+	s.groups[LayerFile] = nil
+	return s.setGroup(LayerFile, &layerGroup{
+		name:    readerSourceName,
+		sources: []layerSource{src},
+	})
 }
 
-func (s *config) MergeConfig(in io.Reader) error {
+// MergeConfig merge settings read from in into file layer
+//
+// format like `yaml` or `json`, detected from content if empty.
+func (s *config) MergeConfig(in io.Reader, format string) error {
+	src, err := readSource(in, format)
+	if err != nil {
+		return err
+	}
+
+	defer s.notifyChanged()
 	s.Lock()
 	defer s.Unlock()
 
-	return s.v.MergeConfig(in)
+	group := &layerGroup{name: readerSourceName}
+	for _, g := range s.groups[LayerFile] {
+		if g.name == readerSourceName {
+			group.sources = append(group.sources, g.sources...)
+		}
+	}
+	group.sources = append(group.sources, src)
+
+	return s.setGroup(LayerFile, group)
+}
+
+// readSource read settings from in, format is detected from content if empty
+func readSource(in io.Reader, format string) (layerSource, error) {
+	cnt, err := io.ReadAll(in)
+	if err != nil {
+		return layerSource{}, errors.Wrap(err, "read config")
+	}
+
+	if format = strings.ToLower(format); format == "" {
+		if format = sniffFormat(cnt); format == "" {
+			return layerSource{}, errors.New("can not detect format of config")
+		}
+	}
+	if !isSupportedFormat(format) {
+		return layerSource{}, errors.Errorf("unsupported format `%s`", format)
+	}
+
+	settings, err := parseSettings(format, readerSourceName, bytes.NewReader(cnt))
+	if err != nil {
+		return layerSource{}, errors.Wrapf(err, "load %s config", format)
+	}
+
+	return layerSource{
+		name:      readerSourceName,
+		settings:  settings,
+		positions: parsePositions(format, readerSourceName, cnt),
+		format:    format,
+	}, nil
 }
 
 // LoadFromDir load settings from dir, default fname is `settings.yml`
+//
+// enable `WithKeyPerFile` to load every file in dir as a key,
+// enable `WithMergeAllFiles` to merge all config files in dir and `conf.d/`.
 func (s *config) LoadFromDir(dirPath string, opts ...Option) error {
-	fpath := filepath.Join(dirPath, defaultConfigFileName)
+	opt, err := new(option).fillDefault().applyOptfs(opts...)
+	if err != nil {
+		return errors.Wrap(err, "apply options")
+	}
+	if err = opt.checkFS(); err != nil {
+		return err
+	}
+
+	switch {
+	case opt.keyPerFile && opt.mergeAllFiles:
+		return errors.New("can not enable both `WithKeyPerFile` and `WithMergeAllFiles`")
+	case opt.mergeAllFiles:
+		if err = s.loadMergedDir(opt, dirPath); err != nil {
+			return err
+		}
+
+		if opt.watchModify {
+			s.watchMergedDir(opt, dirPath)
+		}
+
+		return nil
+	case opt.keyPerFile:
+		if err = s.loadKeyPerFileDir(opt, dirPath); err != nil {
+			return err
+		}
+
+		if opt.watchModify {
+			s.watchKeyPerFileDir(opt, dirPath)
+		}
+
+		return nil
+	}
+
+	fpath := opt.joinPath(dirPath, defaultConfigFileName)
 	return s.LoadFromFile(fpath, opts...)
 }
 
@@ -261,6 +518,34 @@ type option struct {
 	// watchModify automate update when file modified
 	watchModify         bool
 	watchModifyCallback func(fsnotify.Event)
+	// keyPerFile load every file in dir as a key
+	keyPerFile bool
+	// keyPerFileSeps separators of nested key in file name
+	keyPerFileSeps []string
+	// mergeAllFiles merge all config files in dir
+	mergeAllFiles bool
+	// watchRemote automate update when remote settings changed
+	watchRemote         bool
+	watchRemoteCallback func()
+	// bindKey key to unmarshal by `Bind`
+	bindKey   string
+	validator func(obj interface{}) error
+	// mergeStrategies how to merge lists of keys between file and its includes
+	mergeStrategies map[string]MergeStrategy
+	// profile active profiles separated by `,`
+	profile string
+	// profileKey key to read active profiles from, including the entry file
+	profileKey string
+	// fsys read files from fs instead of disk
+	fsys fs.FS
+	// format format of files without supported extension
+	format string
+	// httpClient, checksums, pollInterval for `LoadFromURL`
+	httpClient   *http.Client
+	checksums    map[string]string
+	pollInterval time.Duration
+	// saveOverridesOnly only save settings set by `Set`
+	saveOverridesOnly bool
 }
 
 const (
@@ -269,6 +554,7 @@ const (
 
 func (o *option) fillDefault() *option {
 	o.encryptedSuffix = defaultEncryptSuffix
+	o.keyPerFileSeps = []string{keyPerFileNestedSep, "."}
 	return o
 }
 
@@ -341,8 +627,17 @@ func isSettingsFileEncrypted(opt *option, fname string) bool {
 	return false
 }
 
+// watchOnce run start only for the first watch of source
+func (s *config) watchOnce(source string, start func()) {
+	if _, loaded := s.watching.LoadOrStore(source, struct{}{}); loaded {
+		return
+	}
+
+	start()
+}
+
 func (s *config) watch(opt *option, entryFile string, files []string, opts ...Option) {
-	s.watchOnce.Do(func() {
+	s.watchOnce("file:"+entryFile, func() {
 		if err := gutils.WatchFileChanging(context.Background(), files, func(e fsnotify.Event) {
 			if err := s.LoadFromFile(entryFile, opts...); err != nil {
 				log.Shared.Error("file watcher auto reload settings", zap.Error(err))
@@ -366,101 +661,192 @@ func (s *config) LoadFromFile(entryFile string, opts ...Option) (err error) {
 		return errors.Wrap(err, "apply options")
 	}
 
+	if err = opt.checkFS(); err != nil {
+		return err
+	}
+
 	logger := log.Shared.With(
 		zap.String("file", entryFile),
 		zap.Bool("include", opt.enableInclude),
 	)
 
-	curFpath := entryFile
-	cfgDir := filepath.Dir(entryFile)
-	cfgFiles := []string{entryFile}
-	var fp *os.File
+	cfgFiles, err := s.loadFileGroup(LayerFile, opt, entryFile)
+	if err != nil {
+		return err
+	}
 
-RECUR_INCLUDE_LOOP:
-	for {
-		if fp, err = os.Open(curFpath); err != nil {
-			return errors.Wrapf(err, "open config file `%s`", curFpath)
+	if opt.watchModify {
+		s.watch(opt, entryFile, cfgFiles, opts...)
+	}
+
+	logger.Info("load configs", zap.Strings("config_files", cfgFiles))
+	return nil
+}
+
+// LoadDefaultsFromFile load settings from file as defaults, beneath all other layers,
+// like embedded default settings by `WithFS`.
+//
+// files are loaded like `LoadFromFile`, but can not be watched.
+func (s *config) LoadDefaultsFromFile(entryFile string, opts ...Option) error {
+	opt, err := new(option).fillDefault().applyOptfs(opts...)
+	if err != nil {
+		return errors.Wrap(err, "apply options")
+	}
+	if opt.watchModify {
+		return errors.New("can not watch defaults file")
+	}
+
+	cfgFiles, err := s.loadFileGroup(LayerDefault, opt, entryFile)
+	if err != nil {
+		return err
+	}
+
+	log.Shared.Info("load default configs",
+		zap.String("file", entryFile),
+		zap.Strings("config_files", cfgFiles))
+	return nil
+}
+
+// loadFileGroup load entryFile as a group of layer
+func (s *config) loadFileGroup(layer Layer, opt *option, entryFile string) (cfgFiles []string, err error) {
+	cfgFiles, sources, err := s.loadConfigFiles(opt, entryFile)
+	if err != nil {
+		return nil, err
+	}
+
+	defer s.notifyChanged()
+	s.Lock()
+	defer s.Unlock()
+
+	return cfgFiles, s.setGroup(layer, &layerGroup{
+		name:    entryFile,
+		sources: sources,
+		reload: func() ([]layerSource, error) {
+			_, sources, err := s.loadConfigFiles(opt, entryFile)
+			return sources, err
+		},
+	})
+}
+
+// loadConfigFiles read entryFile, files included by it and profile files,
+// every file is read and parsed only once.
+//
+// return all files read, and sources in ascending priority
+// migrated to the latest version.
+func (s *config) loadConfigFiles(opt *option, entryFile string) (cfgFiles []string, sources []layerSource, err error) {
+	if cfgFiles, sources, err = readIncludeChain(opt, entryFile); err != nil {
+		return nil, nil, err
+	}
+
+	for _, profile := range s.activeProfiles(opt, sources) {
+		fpaths, err := profileFiles(opt, entryFile, profile)
+		if err != nil {
+			return nil, nil, err
 		}
-		defer gutils.SilentClose(fp)
 
-		s.v.SetConfigType(strings.TrimLeft(filepath.Ext(strings.TrimSuffix(curFpath, opt.encryptedSuffix)), "."))
-		if isSettingsFileEncrypted(opt, curFpath) {
-			decrptReader, err := encrypt.NewAesReaderWrapper(fp, opt.aesKey)
+		for _, fpath := range fpaths {
+			files, srcs, err := readIncludeChain(opt, fpath)
 			if err != nil {
-				return err
+				return nil, nil, errors.Wrapf(err, "load profile `%s`", profile)
 			}
 
-			if err = s.ReadConfig(decrptReader); err != nil {
-				return errors.Wrapf(err, "load encrypted config from file `%s`", curFpath)
-			}
-		} else {
-			if err = s.ReadConfig(fp); err != nil {
-				return errors.Wrapf(err, "load config from file `%s`", curFpath)
-			}
+			cfgFiles = append(cfgFiles, files...)
+			sources = append(sources, srcs...)
 		}
+	}
+
+	if err = s.prepareSources(opt, sources); err != nil {
+		return nil, nil, err
+	}
+
+	return cfgFiles, sources, nil
+}
+
+// prepareSources migrate sources of a file and its includes to the latest version,
+// then merge them by `mergeSources`. sources are in ascending priority.
+func (s *config) prepareSources(opt *option, sources []layerSource) (err error) {
+	for i := range sources {
+		sources[i].raw = copySettings(sources[i].settings)
+		if sources[i], err = s.migrateFileSource(sources[i]); err != nil {
+			return err
+		}
+	}
+
+	mergeSources(opt, sources)
+	return nil
+}
+
+// readIncludeChain read entryFile and all files included by it,
+// return cfgFiles in the order of include, and sources in ascending
+// priority (the reverse of cfgFiles)
+func readIncludeChain(opt *option, entryFile string) (cfgFiles []string, sources []layerSource, err error) {
+	curFpath := entryFile
+	cfgDir := opt.dirPath(entryFile)
 
-		_ = fp.Close()
-		if curFpath = s.GetString(settingsIncludeKey); curFpath == "" {
+RECUR_INCLUDE_LOOP:
+	for curFpath != "" {
+		cfgFiles = append(cfgFiles, curFpath)
+		src, err := readConfigFile(opt, curFpath)
+		if err != nil {
+			return nil, nil, err
+		}
+		sources = append(sources, src)
+
+		include, _ := src.settings[settingsIncludeKey].(string)
+		if include == "" {
 			break
 		}
 
-		curFpath = filepath.Join(cfgDir, curFpath)
+		curFpath = opt.joinPath(cfgDir, include)
 		for _, f := range cfgFiles {
 			if f == curFpath {
 				break RECUR_INCLUDE_LOOP
 			}
 		}
-
-		cfgFiles = append(cfgFiles, curFpath)
 	}
 
-	if err = s.loadConfigFiles(opt, cfgFiles); err != nil {
-		return err
+	// included files have lower priority
+	for i, j := 0, len(sources)-1; i < j; i, j = i+1, j-1 {
+		sources[i], sources[j] = sources[j], sources[i]
 	}
 
-	if opt.watchModify {
-		s.watch(opt, entryFile, cfgFiles, opts...)
-	}
+	return cfgFiles, sources, nil
+}
 
-	logger.Info("load configs", zap.Strings("config_files", cfgFiles))
-	return nil
+// configFileType get config type from file's extension
+func configFileType(opt *option, fpath string) string {
+	return strings.TrimLeft(filepath.Ext(strings.TrimSuffix(fpath, opt.encryptedSuffix)), ".")
 }
 
-func (s *config) loadConfigFiles(opt *option, cfgFiles []string) (err error) {
-	var (
-		filePath string
-		fp       *os.File
-	)
-	for i := len(cfgFiles) - 1; i >= 0; i-- {
-		if err = func() error {
-			filePath = cfgFiles[i]
-			if fp, err = os.Open(filePath); err != nil {
-				return errors.Wrapf(err, "open config file `%s`", filePath)
-			}
-			defer gutils.SilentClose(fp)
-
-			if isSettingsFileEncrypted(opt, filePath) {
-				encryptedFp, err := encrypt.NewAesReaderWrapper(fp, opt.aesKey)
-				if err != nil {
-					return err
-				}
-
-				if err = s.MergeConfig(encryptedFp); err != nil {
-					return errors.Wrapf(err, "merge encrypted config file `%s`", filePath)
-				}
-			} else {
-				if err = s.MergeConfig(fp); err != nil {
-					return errors.Wrapf(err, "merge config file `%s`", filePath)
-				}
-			}
+// readConfigFile read settings from file, decrypt if encrypted
+func readConfigFile(opt *option, filePath string) (layerSource, error) {
+	cnt, err := readSettingsFile(opt, filePath)
+	if err != nil {
+		return layerSource{}, err
+	}
 
-			return nil
-		}(); err != nil {
-			return err
+	cfgType, err := detectFormat(opt, filePath, cnt)
+	if err != nil {
+		return layerSource{}, err
+	}
+
+	settings, err := parseSettings(cfgType, filePath, bytes.NewReader(cnt))
+	if err != nil {
+		if isSettingsFileEncrypted(opt, filePath) {
+			return layerSource{}, errors.Wrapf(err, "load encrypted config from file `%s`", filePath)
 		}
+
+		return layerSource{}, errors.Wrapf(err, "load config from file `%s`", filePath)
 	}
 
-	return nil
+	return layerSource{
+		name:      filePath,
+		settings:  settings,
+		positions: parsePositions(cfgType, filePath, cnt),
+		resets:    parseResetKeys(cfgType, cnt),
+		format:    cfgType,
+		encrypted: isSettingsFileEncrypted(opt, filePath),
+	}, nil
 }
 
 // LoadFromConfigServer load configs from config-server,
@@ -477,9 +863,25 @@ func (s *config) LoadFromConfigServer(url, app, profile, label string) (err erro
 	if err = srv.Fetch(); err != nil {
 		return errors.Wrap(err, "try to fetch remote config got error")
 	}
-	srv.Map(s.v.Set)
 
-	return nil
+	kvs := map[string]interface{}{}
+	srv.Map(func(key string, val interface{}) {
+		kvs[key] = val
+	})
+	settings, err := normalizeSettings(unflattenKeys(kvs))
+	if err != nil {
+		return err
+	}
+
+	defer s.notifyChanged()
+	s.Lock()
+	defer s.Unlock()
+
+	name := strings.Join([]string{url, app, profile, label}, "/")
+	return s.setGroup(LayerRemote, &layerGroup{
+		name:    name,
+		sources: []layerSource{{name: name, settings: settings}},
+	})
 }
 
 // LoadFromConfigServerWithRawYaml load configs from config-server
@@ -503,21 +905,27 @@ func (s *config) LoadFromConfigServerWithRawYaml(url, app, profile, label, key s
 		return errors.Errorf("can not load raw cfg with key `%s`", key)
 	}
 	log.Shared.Debug("load raw cfg", zap.String("raw", raw))
-	s.v.SetConfigType("yaml")
-	if err = s.v.ReadConfig(bytes.NewReader([]byte(raw))); err != nil {
+	settings, err := parseSettings("yaml", key, strings.NewReader(raw))
+	if err != nil {
 		return errors.Wrap(err, "try to load config file got error")
 	}
 
-	return nil
+	defer s.notifyChanged()
+	s.Lock()
+	defer s.Unlock()
+
+	name := strings.Join([]string{url, app, profile, label}, "/") + "#" + key
+	return s.setGroup(LayerRemote, &layerGroup{
+		name:    name,
+		sources: []layerSource{{name: name, settings: settings}},
+	})
 }
 
-// LoadSettings load settings file
+// LoadSettings read all loaded settings files again, panic if failed
+//
+// Deprecated: use `ReloadLayer(LayerFile)` instead, which returns error.
 func (s *config) LoadSettings() {
-	s.RLock()
-	defer s.RUnlock()
-
-	err := s.v.ReadInConfig() // Find and read the config file
-	if err != nil {           // Handle errors reading the config file
+	if err := s.ReloadLayer(LayerFile); err != nil {
 		panic(errors.Errorf("fatal error config file: %s", err))
 	}
 }
@@ -381,3 +381,121 @@ func TestAtomicFieldBool(t *testing.T) {
 		require.NoError(t, pool.Wait())
 	})
 }
+
+func TestConfigAccessors(t *testing.T) {
+	cfg := New()
+	loadYAML(t, cfg, gutils.Dedent(`
+		float: 3.5
+		uint: 42
+		time: 2022-12-01T10:00:00Z
+		ints: [1, 2, 3]
+		size: 10mb
+		db:
+		  host: localhost
+		  port: 3306
+		  opts:
+		    timeout: 3s
+		name: app
+	`))
+	cfg.SetDefault("db.user", "root")
+
+	require.Equal(t, 3.5, cfg.GetFloat64("float"))
+	require.Equal(t, uint(42), cfg.GetUint("uint"))
+	require.Equal(t, uint32(42), cfg.GetUint32("uint"))
+	require.Equal(t, uint64(42), cfg.GetUint64("uint"))
+	require.True(t, cfg.GetTime("time").Equal(time.Date(2022, 12, 1, 10, 0, 0, 0, time.UTC)))
+	require.Equal(t, []int{1, 2, 3}, cfg.GetIntSlice("ints"))
+	require.Equal(t, uint(10<<20), cfg.GetSizeInBytes("size"))
+
+	require.Contains(t, cfg.AllKeys(), "db.opts.timeout")
+	require.Contains(t, cfg.AllKeys(), "db.user")
+	require.Equal(t, "localhost", cfg.AllSettings()["db"].(map[string]interface{})["host"])
+
+	require.True(t, cfg.InConfig("db.host"))
+	require.False(t, cfg.InConfig("db.user"))
+
+	t.Run("sub", func(t *testing.T) {
+		require.Nil(t, cfg.Sub("name"))
+		require.Nil(t, cfg.Sub("not-exists"))
+
+		sub := cfg.Sub("db")
+		require.NotNil(t, sub)
+		require.Equal(t, "localhost", sub.GetString("host"))
+		require.Equal(t, 3306, sub.GetInt("port"))
+		require.Equal(t, "root", sub.GetString("user"))
+		require.Equal(t, 3*time.Second, sub.GetDuration("opts.timeout"))
+		require.Equal(t, 3*time.Second, sub.Sub("opts").GetDuration("timeout"))
+
+		// sub is independent from parent
+		sub.Set("host", "remote")
+		require.Equal(t, "localhost", cfg.GetString("db.host"))
+		cfg.Set("db.port", 3307)
+		require.Equal(t, 3306, sub.GetInt("port"))
+
+		var db struct {
+			Host string `mapstructure:"host"`
+		}
+		require.NoError(t, sub.Unmarshal(&db))
+		require.Equal(t, "remote", db.Host)
+	})
+}
+
+func TestConfig_loadConfigFiles(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"settings.yml": "include: b.yml\nname: a\n",
+		"b.yml":        "include: c.yml\nname: b\nb: 1\n",
+		"c.yml":        "include: settings.yml\nname: c\nc: 1\n",
+	}
+	for fname, cnt := range files {
+		require.NoError(t, os.WriteFile(filepath.Join(dir, fname), []byte(cnt), 0600))
+	}
+
+	entry := filepath.Join(dir, "settings.yml")
+	cfg := newConfig()
+	cfgFiles, sources, err := cfg.loadConfigFiles(new(option).fillDefault(), entry)
+	require.NoError(t, err)
+	require.Equal(t, []string{
+		entry,
+		filepath.Join(dir, "b.yml"),
+		filepath.Join(dir, "c.yml"),
+	}, cfgFiles)
+
+	require.Len(t, sources, 3)
+	for i, src := range sources {
+		require.Equal(t, cfgFiles[len(cfgFiles)-1-i], src.name)
+	}
+
+	require.NoError(t, cfg.LoadFromFile(entry))
+	require.Equal(t, "a", cfg.GetString("name"))
+	require.Equal(t, 1, cfg.GetInt("b"))
+	require.Equal(t, 1, cfg.GetInt("c"))
+
+	t.Run("missing include", func(t *testing.T) {
+		require.NoError(t, os.WriteFile(filepath.Join(dir, "c.yml"), []byte("include: d.yml\n"), 0600))
+		_, _, err := cfg.loadConfigFiles(new(option).fillDefault(), entry)
+		require.ErrorContains(t, err, "d.yml")
+	})
+}
+
+func TestConfig_LoadSettings(t *testing.T) {
+	dir := t.TempDir()
+	fpath := filepath.Join(dir, "settings.yml")
+	require.NoError(t, os.WriteFile(fpath, []byte("name: a\n"), 0644))
+
+	cfg := New()
+	require.NoError(t, cfg.LoadFromFile(fpath))
+	snap := cfg.Snapshot()
+
+	require.NoError(t, os.WriteFile(fpath, []byte("name: b\n"), 0644))
+	cfg.LoadSettings()
+	require.Equal(t, "b", cfg.GetString("name"))
+	require.Equal(t, "a", snap.GetString("name"))
+
+	// survives rebuild
+	cfg.Set("other", 1)
+	require.Equal(t, "b", cfg.GetString("name"))
+
+	require.NoError(t, os.Remove(fpath))
+	require.Panics(t, cfg.LoadSettings)
+}
@@ -0,0 +1,218 @@
+package config
+
+import (
+	"io"
+	"path/filepath"
+	"strings"
+
+	gutils "github.com/Laisky/go-utils/v2"
+	"github.com/Laisky/go-utils/v2/encrypt"
+	"github.com/Laisky/go-utils/v2/log"
+	"github.com/Laisky/zap"
+	"github.com/fsnotify/fsnotify"
+	"github.com/pkg/errors"
+)
+
+const (
+	// keyPerFileNestedSep file name `db__host` means key `db.host`
+	keyPerFileNestedSep = "__"
+	// kubernetesDataDir kubernetes rotates mounted files by replacing this symlink
+	kubernetesDataDir = "..data"
+)
+
+// WithKeyPerFile treat every file in directory as a key, for `LoadFromDir`
+//
+// this is how kubernetes mounts ConfigMap and Secret.
+// file name is the key, file content is the value,
+// `__` and `.` in file name means nested key, like `db__host` -> `db.host`,
+// use `WithKeyPerFileSeparator` to keep `.` in key, like `tls.crt`.
+// trailing newlines of content are trimmed.
+//
+// hidden files (like kubernetes' `..data`) are ignored,
+// encrypted files are decrypted and the suffix is removed from key.
+func WithKeyPerFile() Option {
+	return func(opt *option) error {
+		opt.keyPerFile = true
+		return nil
+	}
+}
+
+// WithKeyPerFileSeparator only sep in file name means nested key, for `WithKeyPerFile`
+//
+// other characters including `.` are kept in key,
+// like `tls.crt` is the key `tls.crt` rather than `crt` under `tls`.
+// empty sep disables nested key.
+func WithKeyPerFileSeparator(sep string) Option {
+	return func(opt *option) error {
+		opt.keyPerFileSeps = nil
+		if sep != "" {
+			opt.keyPerFileSeps = []string{sep}
+		}
+
+		return nil
+	}
+}
+
+// keyPerFileKey convert file name to path of settings key
+func keyPerFileKey(opt *option, fname string) []string {
+	if isSettingsFileEncrypted(opt, fname) {
+		fname = strings.TrimSuffix(fname, opt.encryptedSuffix)
+	}
+
+	path := []string{strings.ToLower(fname)}
+	for _, sep := range opt.keyPerFileSeps {
+		var splitted []string
+		for _, k := range path {
+			splitted = append(splitted, strings.Split(k, sep)...)
+		}
+
+		path = splitted
+	}
+
+	return path
+}
+
+// readKeyPerFileDir read all files in dir, every file is a source
+func readKeyPerFileDir(opt *option, dirPath string) ([]layerSource, error) {
+	entries, err := opt.readDir(dirPath)
+	if err != nil {
+		return nil, errors.Wrapf(err, "read dir `%s`", dirPath)
+	}
+
+	var sources []layerSource
+	for _, entry := range entries {
+		if strings.HasPrefix(entry.Name(), ".") {
+			continue
+		}
+
+		fpath := opt.joinPath(dirPath, entry.Name())
+		// follow symlinks, kubernetes mounts keys as symlinks to `..data/{key}`
+		fi, err := opt.stat(fpath)
+		if err != nil {
+			return nil, errors.Wrapf(err, "stat `%s`", fpath)
+		}
+		if fi.IsDir() {
+			continue
+		}
+
+		cnt, err := readSettingsFile(opt, fpath)
+		if err != nil {
+			return nil, err
+		}
+
+		settings := map[string]interface{}{}
+		putSettings(settings, keyPerFileKey(opt, entry.Name()), strings.TrimRight(string(cnt), "\r\n"))
+		if settings, err = normalizeSettings(settings); err != nil {
+			return nil, errors.Wrapf(err, "load file `%s`", fpath)
+		}
+
+		sources = append(sources, layerSource{
+			name:      fpath,
+			settings:  settings,
+			encrypted: isSettingsFileEncrypted(opt, fpath),
+		})
+	}
+
+	return sources, nil
+}
+
+// readSettingsFile read file content, decrypt if encrypted
+func readSettingsFile(opt *option, fpath string) ([]byte, error) {
+	fp, err := opt.open(fpath)
+	if err != nil {
+		return nil, errors.Wrapf(err, "open file `%s`", fpath)
+	}
+	defer gutils.SilentClose(fp)
+
+	var reader io.Reader = fp
+	if isSettingsFileEncrypted(opt, fpath) {
+		if reader, err = encrypt.NewAesReaderWrapper(fp, opt.aesKey); err != nil {
+			return nil, errors.Wrapf(err, "decrypt file `%s`", fpath)
+		}
+	}
+
+	cnt, err := io.ReadAll(reader)
+	if err != nil {
+		return nil, errors.Wrapf(err, "read file `%s`", fpath)
+	}
+
+	return cnt, nil
+}
+
+// loadKeyPerFileDir load settings from key-per-file directory
+func (s *config) loadKeyPerFileDir(opt *option, dirPath string) error {
+	sources, err := readKeyPerFileDir(opt, dirPath)
+	if err != nil {
+		return err
+	}
+
+	if err = s.setLayerGroup(LayerFile, &layerGroup{
+		name:    dirPath,
+		sources: sources,
+		reload: func() ([]layerSource, error) {
+			return readKeyPerFileDir(opt, dirPath)
+		},
+	}); err != nil {
+		return errors.Wrapf(err, "load settings from dir `%s`", dirPath)
+	}
+
+	log.Shared.Info("load configs from key-per-file dir",
+		zap.String("dir", dirPath),
+		zap.Int("keys", len(sources)))
+	return nil
+}
+
+// watchKeyPerFileDir reload when any file in dir changed,
+// including kubernetes' atomic `..data` symlink rotation.
+func (s *config) watchKeyPerFileDir(opt *option, dirPath string) {
+	s.watchOnce("keyPerFileDir:"+dirPath, func() {
+		watcher, err := fsnotify.NewWatcher()
+		if err != nil {
+			log.Shared.Error("new dir watcher", zap.Error(err))
+			return
+		}
+
+		if err = watcher.Add(dirPath); err != nil {
+			log.Shared.Error("watch dir error", zap.Error(err), zap.String("dir", dirPath))
+			gutils.SilentClose(watcher)
+			return
+		}
+
+		go func() {
+			defer gutils.SilentClose(watcher)
+			for {
+				select {
+				case e, ok := <-watcher.Events:
+					if !ok {
+						return
+					}
+
+					name := filepath.Base(e.Name)
+					if strings.HasPrefix(name, ".") && name != kubernetesDataDir {
+						continue
+					}
+					if e.Op == fsnotify.Chmod {
+						continue
+					}
+
+					if err := s.loadKeyPerFileDir(opt, dirPath); err != nil {
+						log.Shared.Error("dir watcher auto reload settings", zap.Error(err))
+						continue
+					}
+
+					if opt.watchModifyCallback != nil {
+						opt.watchModifyCallback(e)
+					}
+				case err, ok := <-watcher.Errors:
+					if !ok {
+						return
+					}
+
+					log.Shared.Error("dir watcher", zap.Error(err))
+				}
+			}
+		}()
+
+		log.Shared.Debug("watching config dir", zap.String("dir", dirPath))
+	})
+}
@@ -0,0 +1,154 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/Laisky/go-utils/v2/encrypt"
+	"github.com/fsnotify/fsnotify"
+	"github.com/stretchr/testify/require"
+)
+
+// mockConfigMapDir create dir like kubernetes mounted ConfigMap
+//
+//	dir/
+//	  ..2022_01_01/
+//	    key
+//	  ..data -> ..2022_01_01
+//	  key -> ..data/key
+func mockConfigMapDir(t *testing.T, dir, version string, kvs map[string]string) {
+	dataDir := filepath.Join(dir, version)
+	require.NoError(t, os.Mkdir(dataDir, 0755))
+	for k, v := range kvs {
+		require.NoError(t, os.WriteFile(filepath.Join(dataDir, k), []byte(v), 0644))
+		if _, err := os.Lstat(filepath.Join(dir, k)); os.IsNotExist(err) {
+			require.NoError(t, os.Symlink(filepath.Join(kubernetesDataDir, k), filepath.Join(dir, k)))
+		}
+	}
+
+	// atomically rotate `..data`
+	tmpLink := filepath.Join(dir, "..data_tmp")
+	require.NoError(t, os.Symlink(version, tmpLink))
+	require.NoError(t, os.Rename(tmpLink, filepath.Join(dir, kubernetesDataDir)))
+}
+
+func TestKeyPerFileKey(t *testing.T) {
+	opt, err := new(option).fillDefault().applyOptfs(WithAesEncrypt([]byte("secret")))
+	require.NoError(t, err)
+
+	require.Equal(t, []string{"db", "host"}, keyPerFileKey(opt, "db__host"))
+	require.Equal(t, []string{"db", "host"}, keyPerFileKey(opt, "db.host"))
+	require.Equal(t, []string{"db", "password"}, keyPerFileKey(opt, "db__password.enc"))
+	require.Equal(t, []string{"port"}, keyPerFileKey(opt, "port"))
+
+	opt, err = new(option).fillDefault().applyOptfs(WithKeyPerFileSeparator("__"))
+	require.NoError(t, err)
+	require.Equal(t, []string{"tls", "ca.crt"}, keyPerFileKey(opt, "tls__ca.crt"))
+	require.Equal(t, []string{"tls.crt"}, keyPerFileKey(opt, "tls.crt"))
+
+	opt, err = new(option).fillDefault().applyOptfs(WithKeyPerFileSeparator(""))
+	require.NoError(t, err)
+	require.Equal(t, []string{"db__host"}, keyPerFileKey(opt, "db__host"))
+}
+
+func TestConfig_LoadFromDir_keyPerFile(t *testing.T) {
+	dir := t.TempDir()
+	secret := []byte("secret")
+	encrypted, err := encrypt.EncryptByAes(secret, []byte("p@ss\n"))
+	require.NoError(t, err)
+
+	mockConfigMapDir(t, dir, "..2022_01_01", map[string]string{
+		"db__host":         "localhost\n",
+		"db.port":          "3306",
+		"name":             "app",
+		"db__password.enc": string(encrypted),
+	})
+	require.NoError(t, os.Mkdir(filepath.Join(dir, "subdir"), 0755))
+
+	cfg := New()
+	reloaded := make(chan struct{}, 10)
+	err = cfg.LoadFromDir(dir,
+		WithKeyPerFile(),
+		WithAesEncrypt(secret),
+		WithWatchFileModified(func(e fsnotify.Event) {
+			reloaded <- struct{}{}
+		}),
+	)
+	require.NoError(t, err)
+
+	require.Equal(t, "localhost", cfg.GetString("db.host"))
+	require.Equal(t, 3306, cfg.GetInt("db.port"))
+	require.Equal(t, "p@ss", cfg.GetString("db.password"))
+	require.Equal(t, "app", cfg.GetString("name"))
+	require.False(t, cfg.IsSet("subdir"))
+	require.False(t, cfg.IsSet("..data"))
+
+	t.Run("rotate", func(t *testing.T) {
+		mockConfigMapDir(t, dir, "..2022_01_02", map[string]string{
+			"db__host":         "remote",
+			"db.port":          "3307",
+			"name":             "app",
+			"db__password.enc": string(encrypted),
+		})
+
+		select {
+		case <-reloaded:
+		case <-time.After(3 * time.Second):
+			t.Fatal("settings not reloaded")
+		}
+
+		// wait for the rest events
+		time.Sleep(100 * time.Millisecond)
+		require.Equal(t, "remote", cfg.GetString("db.host"))
+		require.Equal(t, 3307, cfg.GetInt("db.port"))
+	})
+
+	t.Run("watch another dir", func(t *testing.T) {
+		another := t.TempDir()
+		mockConfigMapDir(t, another, "..2022_01_01", map[string]string{
+			"name": "another",
+		})
+
+		anotherReloaded := make(chan struct{}, 10)
+		require.NoError(t, cfg.LoadFromDir(another,
+			WithKeyPerFile(),
+			WithWatchFileModified(func(e fsnotify.Event) {
+				anotherReloaded <- struct{}{}
+			}),
+		))
+		require.Equal(t, "another", cfg.GetString("name"))
+
+		mockConfigMapDir(t, another, "..2022_01_02", map[string]string{
+			"name": "another-v2",
+		})
+
+		select {
+		case <-anotherReloaded:
+		case <-time.After(3 * time.Second):
+			t.Fatal("second watcher not started")
+		}
+
+		time.Sleep(100 * time.Millisecond)
+		require.Equal(t, "another-v2", cfg.GetString("name"))
+	})
+
+	t.Run("separator", func(t *testing.T) {
+		dir := t.TempDir()
+		mockConfigMapDir(t, dir, "..2022_01_01", map[string]string{
+			"tls.crt":     "cert",
+			"tls__ca.crt": "ca",
+		})
+
+		cfg := New()
+		require.NoError(t, cfg.LoadFromDir(dir, WithKeyPerFile(), WithKeyPerFileSeparator("__")))
+		require.Equal(t, "cert", cfg.GetString("tls.crt"))
+		require.Equal(t, "ca", cfg.GetString("tls.ca.crt"))
+	})
+
+	t.Run("not exists", func(t *testing.T) {
+		err := New().LoadFromDir(filepath.Join(dir, "notexists"), WithKeyPerFile())
+		require.Error(t, err)
+	})
+}
@@ -3,14 +3,17 @@ package config
 
 import (
 	"fmt"
+	"math"
 	"net/http"
 	"strconv"
 	"strings"
+	"time"
 
 	gutils "github.com/Laisky/go-utils/v2"
 	"github.com/Laisky/go-utils/v2/log"
 	"github.com/Laisky/zap"
 	"github.com/pkg/errors"
+	"github.com/spf13/cast"
 )
 
 var httpClient *http.Client
@@ -87,77 +90,257 @@ func (c *SpringConfigServer) Get(name string) (interface{}, bool) {
 	return nil, false
 }
 
+// ErrKeyNotFound key does not exist in any property source,
+// returned by accessors with `E` suffix
+var ErrKeyNotFound = errors.New("key not found")
+
 // GetString get `string` from the localcache of config-server
+//
+// non-string scalars are formatted as string.
 func (c *SpringConfigServer) GetString(name string) (string, bool) {
-	if val, ok := c.Get(name); ok {
-		return val.(string), true
+	val, err := c.GetStringE(name)
+	return val, err == nil
+}
+
+// GetStringE get `string` from the localcache of config-server
+func (c *SpringConfigServer) GetStringE(name string) (string, error) {
+	itf, ok := c.Get(name)
+	if !ok {
+		return "", errors.Wrapf(ErrKeyNotFound, "key `%s`", name)
+	}
+
+	val, err := cast.ToStringE(itf)
+	if err != nil {
+		return "", errors.Wrapf(err, "convert `%s` to string", name)
 	}
 
-	return "", false
+	return val, nil
 }
 
 // GetInt get `int` from the localcache of config-server
 func (c *SpringConfigServer) GetInt(name string) (val int, ok bool) {
-	var (
-		itf interface{}
-		err error
-	)
-	if itf, ok = c.Get(name); ok {
-		switch v := itf.(type) {
-		case int:
-			val = v
-		case int64:
-			val = int(v)
-		case string:
-			if val, err = strconv.Atoi(v); err != nil {
-				log.Shared.Error("cannot parse string to int64",
-					zap.String("name", name),
-					zap.String("val", fmt.Sprint(v)))
-				return val, false
-			}
-		default:
-			log.Shared.Error("unknown type",
-				zap.String("name", name),
-				zap.String("val", fmt.Sprint(v)))
-			return val, false
+	val, err := c.GetIntE(name)
+	return val, err == nil
+}
+
+// GetIntE get `int` from the localcache of config-server
+//
+// returns an error if the value overflows `int` on this platform.
+func (c *SpringConfigServer) GetIntE(name string) (int, error) {
+	v, err := c.GetInt64E(name)
+	if err != nil {
+		return 0, err
+	}
+
+	if v < math.MinInt || v > math.MaxInt {
+		return 0, errors.Errorf("convert `%s` to int: %d overflows int", name, v)
+	}
+
+	return int(v), nil
+}
+
+// GetInt64E get `int64` from the localcache of config-server
+//
+// accepts integers, integral floats (JSON numbers) and numeric strings.
+func (c *SpringConfigServer) GetInt64E(name string) (int64, error) {
+	itf, ok := c.Get(name)
+	if !ok {
+		return 0, errors.Wrapf(ErrKeyNotFound, "key `%s`", name)
+	}
+
+	switch v := itf.(type) {
+	case float64:
+		return floatToInt64(name, v)
+	case float32:
+		return floatToInt64(name, float64(v))
+	case string:
+		val, err := strconv.ParseInt(strings.TrimSpace(v), 10, 64)
+		if err != nil {
+			return 0, errors.Wrapf(err, "convert `%s` to int64", name)
 		}
 
-		return
+		return val, nil
 	}
 
-	return
+	val, err := cast.ToInt64E(itf)
+	if err != nil {
+		return 0, errors.Wrapf(err, "convert `%s` to int64", name)
+	}
+
+	return val, nil
+}
+
+// floatToInt64 convert integral float in range of int64
+func floatToInt64(name string, v float64) (int64, error) {
+	if v != math.Trunc(v) {
+		return 0, errors.Errorf("convert `%s` to int64: %v is not an integer", name, v)
+	}
+
+	// float64(math.MaxInt64) is 2^63, which overflows int64
+	if v < math.MinInt64 || v >= math.MaxInt64 {
+		return 0, errors.Errorf("convert `%s` to int64: %v overflows int64", name, v)
+	}
+
+	return int64(v), nil
+}
+
+// GetFloat64E get `float64` from the localcache of config-server
+func (c *SpringConfigServer) GetFloat64E(name string) (float64, error) {
+	itf, ok := c.Get(name)
+	if !ok {
+		return 0, errors.Wrapf(ErrKeyNotFound, "key `%s`", name)
+	}
+
+	if v, ok := itf.(string); ok {
+		itf = strings.TrimSpace(v)
+	}
+
+	val, err := cast.ToFloat64E(itf)
+	if err != nil {
+		return 0, errors.Wrapf(err, "convert `%s` to float64", name)
+	}
+
+	return val, nil
 }
 
 // GetBool get `bool` from the localcache of config-server
 func (c *SpringConfigServer) GetBool(name string) (val bool, ok bool) {
-	var (
-		itf interface{}
-		err error
-	)
-	if itf, ok = c.Get(name); ok {
-		switch v := itf.(type) {
-		case int:
-			val = v != 0
-		case int64:
-			val = v != 0
-		case string:
-			if val, err = strconv.ParseBool(v); err != nil {
-				log.Shared.Error("cannot parse string to bool",
-					zap.String("name", name),
-					zap.String("val", fmt.Sprint(v)))
-				return val, false
+	val, err := c.GetBoolE(name)
+	return val, err == nil
+}
+
+// GetBoolE get `bool` from the localcache of config-server
+//
+// numbers are true when non-zero, strings are parsed by `strconv.ParseBool`.
+func (c *SpringConfigServer) GetBoolE(name string) (bool, error) {
+	itf, ok := c.Get(name)
+	if !ok {
+		return false, errors.Wrapf(ErrKeyNotFound, "key `%s`", name)
+	}
+
+	switch v := itf.(type) {
+	case string:
+		itf = strings.TrimSpace(v)
+	case float64:
+		return v != 0, nil
+	case float32:
+		return v != 0, nil
+	case int64:
+		return v != 0, nil
+	}
+
+	val, err := cast.ToBoolE(itf)
+	if err != nil {
+		return false, errors.Wrapf(err, "convert `%s` to bool", name)
+	}
+
+	return val, nil
+}
+
+// GetDurationE get `time.Duration` from the localcache of config-server
+//
+// follows the same rules as `Config.GetDuration`:
+// strings are parsed by `time.ParseDuration`, bare numbers are nanoseconds.
+func (c *SpringConfigServer) GetDurationE(name string) (time.Duration, error) {
+	itf, ok := c.Get(name)
+	if !ok {
+		return 0, errors.Wrapf(ErrKeyNotFound, "key `%s`", name)
+	}
+
+	if v, ok := itf.(string); ok {
+		itf = strings.TrimSpace(v)
+	}
+
+	val, err := cast.ToDurationE(itf)
+	if err != nil {
+		return 0, errors.Wrapf(err, "convert `%s` to duration", name)
+	}
+
+	return val, nil
+}
+
+// GetStringSliceE get `[]string` from the localcache of config-server
+//
+// supports JSON arrays, comma separated strings,
+// and spring's flattened lists like `name[0]`, `name[1]`.
+//
+// unlike `Config.GetStringSlice` which splits strings by whitespace,
+// strings are split by `,` and trimmed, as spring does for list properties.
+func (c *SpringConfigServer) GetStringSliceE(name string) ([]string, error) {
+	itf, ok := c.Get(name)
+	if !ok {
+		if vals, ok := c.getIndexedList(name); ok {
+			itf = vals
+		} else {
+			return nil, errors.Wrapf(ErrKeyNotFound, "key `%s`", name)
+		}
+	}
+
+	if v, ok := itf.(string); ok {
+		if strings.TrimSpace(v) == "" {
+			return []string{}, nil
+		}
+
+		vals := strings.Split(v, ",")
+		for i := range vals {
+			vals[i] = strings.TrimSpace(vals[i])
+		}
+
+		return vals, nil
+	}
+
+	val, err := cast.ToStringSliceE(itf)
+	if err != nil {
+		return nil, errors.Wrapf(err, "convert `%s` to []string", name)
+	}
+
+	return val, nil
+}
+
+// GetStringMapE get `map[string]interface{}` from the localcache of config-server
+//
+// supports JSON objects and spring's flattened keys like `name.key`.
+func (c *SpringConfigServer) GetStringMapE(name string) (map[string]interface{}, error) {
+	if itf, ok := c.Get(name); ok {
+		val, err := cast.ToStringMapE(itf)
+		if err != nil {
+			return nil, errors.Wrapf(err, "convert `%s` to map", name)
+		}
+
+		return val, nil
+	}
+
+	prefix := name + "."
+	val := map[string]interface{}{}
+	// iterate in reverse so that former sources take precedence
+	for i := len(c.RemoteCfg.Sources) - 1; i >= 0; i-- {
+		for key, v := range c.RemoteCfg.Sources[i].Source {
+			if strings.HasPrefix(key, prefix) {
+				val[strings.TrimPrefix(key, prefix)] = v
 			}
-		default:
-			log.Shared.Error("unknown type",
-				zap.String("name", name),
-				zap.String("val", fmt.Sprint(v)))
-			return val, false
+		}
+	}
+
+	if len(val) == 0 {
+		return nil, errors.Wrapf(ErrKeyNotFound, "key `%s`", name)
+	}
+
+	return val, nil
+}
+
+// getIndexedList collect spring's flattened list items `name[0]`, `name[1]`...
+func (c *SpringConfigServer) getIndexedList(name string) ([]interface{}, bool) {
+	var vals []interface{}
+	for i := 0; ; i++ {
+		v, ok := c.Get(fmt.Sprintf("%s[%d]", name, i))
+		if !ok {
+			break
 		}
 
-		return
+		vals = append(vals, v)
 	}
 
-	return
+	return vals, len(vals) != 0
 }
 
 // Map interate `set(k, v)`
@@ -5,12 +5,15 @@ import (
 	"fmt"
 	"net"
 	"net/http"
+	"net/http/httptest"
+	"strconv"
 	"testing"
 	"time"
 
 	gutils "github.com/Laisky/go-utils/v2"
 	"github.com/Laisky/go-utils/v2/log"
 	"github.com/Laisky/zap"
+	"github.com/stretchr/testify/require"
 )
 
 func ExampleSpringConfigServer() {
@@ -26,6 +29,9 @@ func ExampleSpringConfigServer() {
 	c.GetString("management.context-path")
 	c.GetBool("endpoints.health.sensitive")
 	c.GetInt("spring.cloud.config.retry")
+	c.GetFloat64E("sampling.ratio")
+	c.GetDurationE("http.timeout")
+	c.GetStringSliceE("kafka.brokers")
 }
 
 var fakeConfigSrvData = map[string]interface{}{
@@ -141,3 +147,180 @@ func TestConfigSrv(t *testing.T) {
 		t.Fatal("`key3` should equal to `true`")
 	}
 }
+
+func TestSpringConfigServerTypedAccessors(t *testing.T) {
+	data := map[string]interface{}{
+		"name":     "app",
+		"profiles": []string{"profile"},
+		"label":    "label",
+		"version":  "12345",
+		"propertySources": []map[string]interface{}{
+			{
+				"name": "override",
+				"source": map[string]interface{}{
+					"num":           3,
+					"map.a":         "override",
+					"brokers[0]":    "k1:9092",
+					"brokers[1]":    "k2:9092",
+					"float":         1.5,
+					"float_str":     " 2.25 ",
+					"duration":      "3s",
+					"duration_num":  1000,
+					"bool_num":      1,
+					"bool_str":      "false",
+					"csv":           "a, b,c",
+					"list":          []string{"x", "y"},
+					"obj":           map[string]interface{}{"k": "v"},
+					"bad_int":       "abc",
+					"fraction":      1.2,
+					"str_from_num":  42,
+					"int64_str":     "9007199254740993",
+					"empty_csv":     "",
+					"bad_duration":  "forever",
+					"bad_bool":      "maybe",
+					"int_from_json": 7,
+					"huge_float":    1e19,
+					"tiny_float":    -1e300,
+				},
+			},
+			{
+				"name": "base",
+				"source": map[string]interface{}{
+					"num":   1,
+					"map.a": "base",
+					"map.b": 2,
+				},
+			},
+		},
+	}
+
+	srv := httptest.NewServer(http.HandlerFunc(fakeHandler(data)))
+	defer srv.Close()
+
+	c := NewSpringConfigServer(srv.URL, "app", "profile", "label")
+	require.NoError(t, c.Fetch())
+
+	t.Run("int", func(t *testing.T) {
+		v, ok := c.GetInt("num")
+		require.True(t, ok)
+		require.Equal(t, 3, v)
+
+		v64, err := c.GetInt64E("int_from_json")
+		require.NoError(t, err)
+		require.Equal(t, int64(7), v64)
+
+		v64, err = c.GetInt64E("int64_str")
+		require.NoError(t, err)
+		require.Equal(t, int64(9007199254740993), v64)
+
+		vi, err := c.GetIntE("int64_str")
+		if strconv.IntSize == 32 {
+			require.Error(t, err)
+		} else {
+			require.NoError(t, err)
+			require.Equal(t, int64(9007199254740993), int64(vi))
+		}
+
+		_, err = c.GetInt64E("fraction")
+		require.Error(t, err)
+		_, err = c.GetInt64E("huge_float")
+		require.ErrorContains(t, err, "overflows int64")
+		_, err = c.GetInt64E("tiny_float")
+		require.ErrorContains(t, err, "overflows int64")
+		_, err = c.GetInt64E("bad_int")
+		require.Error(t, err)
+		_, ok = c.GetInt("bad_int")
+		require.False(t, ok)
+		_, err = c.GetIntE("not_exists")
+		require.ErrorIs(t, err, ErrKeyNotFound)
+	})
+
+	t.Run("float", func(t *testing.T) {
+		v, err := c.GetFloat64E("float")
+		require.NoError(t, err)
+		require.Equal(t, 1.5, v)
+
+		v, err = c.GetFloat64E("float_str")
+		require.NoError(t, err)
+		require.Equal(t, 2.25, v)
+
+		v, err = c.GetFloat64E("num")
+		require.NoError(t, err)
+		require.Equal(t, float64(3), v)
+	})
+
+	t.Run("bool", func(t *testing.T) {
+		v, ok := c.GetBool("bool_num")
+		require.True(t, ok)
+		require.True(t, v)
+
+		v, err := c.GetBoolE("bool_str")
+		require.NoError(t, err)
+		require.False(t, v)
+
+		_, err = c.GetBoolE("bad_bool")
+		require.Error(t, err)
+	})
+
+	t.Run("string", func(t *testing.T) {
+		v, ok := c.GetString("str_from_num")
+		require.True(t, ok)
+		require.Equal(t, "42", v)
+
+		_, ok = c.GetString("obj")
+		require.False(t, ok)
+
+		_, err := c.GetStringE("not_exists")
+		require.ErrorIs(t, err, ErrKeyNotFound)
+	})
+
+	t.Run("duration", func(t *testing.T) {
+		v, err := c.GetDurationE("duration")
+		require.NoError(t, err)
+		require.Equal(t, 3*time.Second, v)
+
+		v, err = c.GetDurationE("duration_num")
+		require.NoError(t, err)
+		require.Equal(t, 1000*time.Nanosecond, v)
+
+		_, err = c.GetDurationE("bad_duration")
+		require.Error(t, err)
+	})
+
+	t.Run("string slice", func(t *testing.T) {
+		v, err := c.GetStringSliceE("list")
+		require.NoError(t, err)
+		require.Equal(t, []string{"x", "y"}, v)
+
+		v, err = c.GetStringSliceE("csv")
+		require.NoError(t, err)
+		require.Equal(t, []string{"a", "b", "c"}, v)
+
+		v, err = c.GetStringSliceE("brokers")
+		require.NoError(t, err)
+		require.Equal(t, []string{"k1:9092", "k2:9092"}, v)
+
+		v, err = c.GetStringSliceE("empty_csv")
+		require.NoError(t, err)
+		require.Len(t, v, 0)
+
+		_, err = c.GetStringSliceE("not_exists")
+		require.ErrorIs(t, err, ErrKeyNotFound)
+	})
+
+	t.Run("string map", func(t *testing.T) {
+		v, err := c.GetStringMapE("obj")
+		require.NoError(t, err)
+		require.Equal(t, map[string]interface{}{"k": "v"}, v)
+
+		v, err = c.GetStringMapE("map")
+		require.NoError(t, err)
+		require.Equal(t, "override", v["a"])
+		require.Equal(t, float64(2), v["b"])
+
+		_, err = c.GetStringMapE("num")
+		require.Error(t, err)
+		_, err = c.GetStringMapE("not_exists")
+		require.ErrorIs(t, err, ErrKeyNotFound)
+	})
+}
@@ -0,0 +1,75 @@
+package config
+
+import (
+	"cuelang.org/go/cue"
+	"cuelang.org/go/cue/cuecontext"
+	cueerrors "cuelang.org/go/cue/errors"
+	"github.com/pkg/errors"
+)
+
+// compileCUE compile cue of file fpath and validate its constraints,
+// all values must be concrete.
+func compileCUE(fpath string, cnt []byte) (cue.Value, error) {
+	val := cuecontext.New().CompileBytes(cnt, cue.Filename(fpath))
+	if err := val.Err(); err != nil {
+		return cue.Value{}, errors.Errorf("compile cue: %s", cueerrors.Details(err, nil))
+	}
+
+	if err := val.Validate(cue.Concrete(true)); err != nil {
+		return cue.Value{}, errors.Errorf("validate cue: %s", cueerrors.Details(err, nil))
+	}
+
+	return val, nil
+}
+
+// decodeCUE decode cue into settings,
+// constraint violations and incomplete values are returned as error.
+//
+// definitions like `#DB` and hidden fields like `_tmp` are not settings,
+// use them to declare schemas, like `#DB: {port: int & >0}` and `db: #DB & {port: 3306}`.
+func decodeCUE(fpath string, cnt []byte) (map[string]interface{}, error) {
+	val, err := compileCUE(fpath, cnt)
+	if err != nil {
+		return nil, err
+	}
+
+	settings := map[string]interface{}{}
+	if err = val.Decode(&settings); err != nil {
+		return nil, errors.Errorf("decode cue: %s", cueerrors.Details(err, nil))
+	}
+
+	return settings, nil
+}
+
+// walkCUE find positions of fields
+func (ps keyPositions) walkCUE(fpath string, cnt []byte) error {
+	val, err := compileCUE(fpath, cnt)
+	if err != nil {
+		return err
+	}
+
+	var walk func(prefix string, val cue.Value) error
+	walk = func(prefix string, val cue.Value) error {
+		it, err := val.Fields()
+		if err != nil {
+			return err
+		}
+
+		for it.Next() {
+			key := joinKey(prefix, it.Selector().Unquoted())
+			if pos := it.Value().Pos(); pos.IsValid() {
+				ps[key] = Position{File: fpath, Line: pos.Line(), Column: pos.Column()}
+			}
+
+			if it.Value().IncompleteKind() == cue.StructKind {
+				if err := walk(key, it.Value()); err != nil {
+					return err
+				}
+			}
+		}
+
+		return nil
+	}
+
+	return walk("", val)
+}
@@ -0,0 +1,69 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestDecodeCUE(t *testing.T) {
+	cnt := []byte(`
+#DB: {
+	host: string
+	port: int & >0 & <65536 | *3306
+}
+
+name:  "app"
+ratio: 0.5
+debug: true
+tags: ["a", "b"]
+db: #DB & {
+	host: "localhost"
+}
+_hidden: "x"
+`)
+
+	settings, err := decodeCUE("settings.cue", cnt)
+	require.NoError(t, err)
+	require.Equal(t, "app", settings["name"])
+	require.Equal(t, 0.5, settings["ratio"])
+	require.Equal(t, true, settings["debug"])
+	require.Equal(t, []interface{}{"a", "b"}, settings["tags"])
+	db := settings["db"].(map[string]interface{})
+	require.Equal(t, "localhost", db["host"])
+	require.EqualValues(t, 3306, db["port"])
+	require.NotContains(t, settings, "#DB")
+	require.NotContains(t, settings, "_hidden")
+
+	positions := parsePositions("cue", "settings.cue", cnt)
+	require.Equal(t, Position{File: "settings.cue", Line: 7, Column: 1}, positions["name"])
+	require.Equal(t, 12, positions["db.host"].Line)
+
+	// constraint violation
+	_, err = decodeCUE("db.cue", []byte("port: int & >1024\nport: 80\n"))
+	require.ErrorContains(t, err, "invalid value 80")
+	require.ErrorContains(t, err, "db.cue:")
+	// incomplete value
+	_, err = decodeCUE("settings.cue", []byte("port: int\n"))
+	require.Error(t, err)
+	_, err = decodeCUE("settings.cue", []byte("port: "))
+	require.Error(t, err)
+}
+
+func TestLoadFromFile_cue(t *testing.T) {
+	dir := t.TempDir()
+	fpath := filepath.Join(dir, "settings.cue")
+	require.NoError(t, os.WriteFile(fpath, []byte("port: int & >1024\nport: 8080\n"), 0600))
+
+	cfg := New()
+	require.NoError(t, cfg.LoadFromFile(fpath))
+	require.Equal(t, 8080, cfg.GetInt("port"))
+
+	require.NoError(t, os.WriteFile(fpath, []byte("port: int & >1024\nport: 80\n"), 0600))
+	err := cfg.LoadFromFile(fpath)
+	require.ErrorContains(t, err, "invalid value 80")
+	require.ErrorContains(t, err, fpath+":")
+	require.Equal(t, 8080, cfg.GetInt("port"))
+}
@@ -0,0 +1,311 @@
+package config
+
+import (
+	"bytes"
+	"strings"
+
+	"github.com/Laisky/go-utils/v2/log"
+	"github.com/Laisky/zap"
+	"github.com/pelletier/go-toml"
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v3"
+)
+
+// Document settings file and files included by it, edited by `EditFile`
+//
+// keys are edited in the file where they are defined,
+// comments and key order of yaml and toml are preserved.
+type Document struct {
+	// files in descending priority, entry file first
+	files []*documentFile
+}
+
+// documentFile content of settings file, decrypted
+type documentFile struct {
+	path     string
+	format   string
+	cnt      []byte
+	settings map[string]interface{}
+	modified bool
+}
+
+// EditFile edit settings file and files included by it by edit,
+// modified files are written atomically after edit succeeded,
+// encrypted file is encrypted again by `WithAesEncrypt`.
+//
+// Example
+//
+//	err := gconfig.EditFile("/etc/app/settings.yml", func(doc *gconfig.Document) error {
+//		return doc.Set("db.port", 5432)
+//	})
+func EditFile(fpath string, edit func(doc *Document) error, opts ...Option) error {
+	opt, err := new(option).fillDefault().applyOptfs(opts...)
+	if err != nil {
+		return errors.Wrap(err, "apply options")
+	}
+	if opt.fsys != nil {
+		return errors.New("can not write files in fs")
+	}
+
+	cfgFiles, _, err := readIncludeChain(opt, fpath)
+	if err != nil {
+		return err
+	}
+
+	doc := new(Document)
+	for _, f := range cfgFiles {
+		file := &documentFile{path: f}
+		if file.cnt, err = readSettingsFile(opt, f); err != nil {
+			return err
+		}
+		if file.format, err = detectFormat(opt, f, file.cnt); err != nil {
+			return err
+		}
+		if file.settings, err = parseSettings(file.format, f, bytes.NewReader(file.cnt)); err != nil {
+			return errors.Wrapf(err, "load config from file `%s`", f)
+		}
+
+		doc.files = append(doc.files, file)
+	}
+
+	if err = edit(doc); err != nil {
+		return err
+	}
+
+	for _, file := range doc.files {
+		if !file.modified {
+			continue
+		}
+
+		if err = writeSettingsFile(opt, file.path, file.cnt); err != nil {
+			return err
+		}
+
+		log.Shared.Info("edit settings file", zap.String("file", file.path))
+	}
+
+	return nil
+}
+
+// Files files of document, entry file first
+func (d *Document) Files() []string {
+	files := make([]string, 0, len(d.files))
+	for _, file := range d.files {
+		files = append(files, file.path)
+	}
+
+	return files
+}
+
+// lookup find the file where key is defined
+func (d *Document) lookup(key string) (file *documentFile, val interface{}, ok bool) {
+	path := strings.Split(strings.ToLower(key), ".")
+	for _, file := range d.files {
+		if val, ok := lookupSettings(file.settings, path); ok {
+			return file, val, true
+		}
+	}
+
+	return nil, nil, false
+}
+
+// Get get value of key in the file where it is defined
+func (d *Document) Get(key string) (interface{}, bool) {
+	_, val, ok := d.lookup(key)
+	return val, ok
+}
+
+// File get the file where key is defined
+func (d *Document) File(key string) (string, bool) {
+	file, _, ok := d.lookup(key)
+	if !ok {
+		return "", false
+	}
+
+	return file.path, true
+}
+
+// Set set value of key in the file where it is defined.
+//
+// new key is set in the file where its nearest parent is defined,
+// or the entry file if no parent defined.
+func (d *Document) Set(key string, val interface{}) error {
+	path := strings.Split(strings.ToLower(key), ".")
+
+	target := d.files[0]
+FIND_PARENT_LOOP:
+	for i := len(path); i > 0; i-- {
+		for _, file := range d.files {
+			if _, ok := lookupSettings(file.settings, path[:i]); ok {
+				target = file
+				break FIND_PARENT_LOOP
+			}
+		}
+	}
+
+	settings := map[string]interface{}{}
+	putSettings(settings, path, val)
+	cnt, err := patchSettingsFile(target.format, target.path, target.cnt, settings)
+	if err != nil {
+		return errors.Wrapf(err, "set `%s` in `%s`", key, target.path)
+	}
+
+	return target.update(cnt)
+}
+
+// Delete delete key from all files where it is defined,
+// do nothing if key not defined.
+func (d *Document) Delete(key string) error {
+	path := strings.Split(strings.ToLower(key), ".")
+	for _, file := range d.files {
+		if _, ok := lookupSettings(file.settings, path); !ok {
+			continue
+		}
+
+		expected := copySettings(file.settings)
+		deleteSettings(expected, path)
+
+		var del func(cnt []byte) ([]byte, error)
+		switch file.format {
+		case "yaml", "yml":
+			del = func(cnt []byte) ([]byte, error) { return deleteYAMLKey(cnt, path) }
+		case "toml":
+			del = func(cnt []byte) ([]byte, error) { return deleteTOMLKey(cnt, path) }
+		}
+
+		cnt, err := rewriteSettingsFile(file.format, file.path, file.cnt, expected, del)
+		if err != nil {
+			return errors.Wrapf(err, "delete `%s` in `%s`", key, file.path)
+		}
+
+		if err = file.update(cnt); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// update replace content of file
+func (f *documentFile) update(cnt []byte) (err error) {
+	if f.settings, err = parseSettings(f.format, f.path, bytes.NewReader(cnt)); err != nil {
+		return errors.Wrapf(err, "load config from file `%s`", f.path)
+	}
+
+	f.cnt = cnt
+	f.modified = true
+	return nil
+}
+
+// deleteYAMLKey delete key-value at path from yaml document,
+// lines of key-value are removed, parent without other keys is removed too.
+func deleteYAMLKey(cnt []byte, path []string) ([]byte, error) {
+	p, err := newYAMLPatcher(cnt)
+	if err != nil {
+		return nil, err
+	}
+	if p.root == nil {
+		return nil, errors.Errorf("`%s` not found", strings.Join(path, "."))
+	}
+
+	// entry of path in every level
+	type entry struct {
+		node     *yaml.Node
+		idx, end int
+	}
+	var entries []entry
+	node, end := p.root, len(cnt)
+	for i, k := range path {
+		if node.Kind != yaml.MappingNode || node.Style&yaml.FlowStyle != 0 {
+			return nil, errors.Errorf("`%s` is not a block mapping", strings.Join(path[:i], "."))
+		}
+
+		idx := yamlKeyIndex(node, k)
+		if idx < 0 {
+			return nil, errors.Errorf("`%s` not found", strings.Join(path[:i+1], "."))
+		}
+
+		entries = append(entries, entry{node: node, idx: idx, end: end})
+		end = p.entryEnd(node, idx, end)
+		node = node.Content[idx+1]
+	}
+
+	// like `deleteSettings`, remove parents without other keys
+	e := entries[len(entries)-1]
+	for i := len(entries) - 1; i > 0 && len(entries[i].node.Content) == 2; i-- {
+		e = entries[i-1]
+	}
+
+	keyNode := e.node.Content[e.idx]
+	off, ok := p.offsetOf(keyNode.Line, keyNode.Column)
+	if !ok {
+		return nil, errors.Errorf("unknown position of `%s`", strings.Join(path, "."))
+	}
+
+	lineBegin := p.lineStart[keyNode.Line-1]
+	if len(bytes.TrimSpace(cnt[lineBegin:off])) != 0 {
+		return nil, errors.Errorf("`%s` is not the only key in line", strings.Join(path, "."))
+	}
+
+	p.edits = append(p.edits, textEdit{start: lineBegin, end: p.trimEnd(off, p.entryEnd(e.node, e.idx, e.end))})
+	return applyEdits(cnt, p.edits), nil
+}
+
+// deleteTOMLKey delete key-value at path from toml document,
+// the whole line of key-value is removed.
+func deleteTOMLKey(cnt []byte, path []string) ([]byte, error) {
+	p, err := newTOMLPatcher(cnt)
+	if err != nil {
+		return nil, err
+	}
+
+	tree := p.tree
+	var keyPath []string
+	for i, k := range path {
+		fileKey := ""
+		for _, key := range tree.Keys() {
+			if strings.EqualFold(key, k) {
+				fileKey = key
+				break
+			}
+		}
+		if fileKey == "" {
+			return nil, errors.Errorf("`%s` not found", strings.Join(path[:i+1], "."))
+		}
+
+		keyPath = append(keyPath, fileKey)
+		if i == len(path)-1 {
+			break
+		}
+
+		sub, ok := tree.GetPath([]string{fileKey}).(*toml.Tree)
+		if !ok {
+			return nil, errors.Errorf("`%s` is not a table", strings.Join(path[:i+1], "."))
+		}
+		tree = sub
+	}
+
+	pos := tree.GetPositionPath(keyPath[len(keyPath)-1:])
+	off, ok := p.offset(pos)
+	if !ok {
+		return nil, errors.Errorf("unknown position of `%s`", strings.Join(path, "."))
+	}
+
+	lineBegin := p.lineStart[pos.Line-1]
+	if len(bytes.TrimSpace(cnt[lineBegin:off])) != 0 {
+		return nil, errors.Errorf("`%s` is not the only key in line", strings.Join(path, "."))
+	}
+
+	_, end, err := p.valueRange(keyPath, pos)
+	if err != nil {
+		return nil, err
+	}
+	if i := bytes.IndexByte(cnt[end:], '\n'); i >= 0 {
+		end += i + 1
+	} else {
+		end = len(cnt)
+	}
+
+	edited := append(append([]byte{}, cnt[:lineBegin]...), cnt[end:]...)
+	return edited, nil
+}
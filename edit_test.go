@@ -0,0 +1,178 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/Laisky/go-utils/v2/encrypt"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEditFile(t *testing.T) {
+	dir := t.TempDir()
+	secret := []byte("01234567890123456789012345678901")
+	entry := filepath.Join(dir, "settings.yml")
+	base := filepath.Join(dir, "base.yml.enc")
+	baseCnt := []byte(`# shared settings
+db:
+  host: localhost   # db host
+  port: 3306
+
+password: "123"
+`)
+	entryCnt := []byte(`include: base.yml.enc
+
+# app name
+name: app
+db:
+  port: 5432        # override
+  pool:
+    size: 10
+
+tags:
+  - a
+`)
+
+	encrypted, err := encrypt.EncryptByAes(secret, baseCnt)
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(base, encrypted, 0644))
+	require.NoError(t, os.WriteFile(entry, entryCnt, 0644))
+
+	t.Run("edit failed", func(t *testing.T) {
+		err := EditFile(entry, func(doc *Document) error {
+			require.NoError(t, doc.Set("name", "changed"))
+			return errors.New("failed")
+		}, WithAesEncrypt(secret))
+		require.Error(t, err)
+
+		cnt, err := os.ReadFile(entry)
+		require.NoError(t, err)
+		require.Equal(t, string(entryCnt), string(cnt))
+	})
+
+	t.Run("without aes key", func(t *testing.T) {
+		require.Error(t, EditFile(entry, func(doc *Document) error { return nil }))
+	})
+
+	err = EditFile(entry, func(doc *Document) error {
+		require.Equal(t, []string{entry, base}, doc.Files())
+
+		val, ok := doc.Get("db.port")
+		require.True(t, ok)
+		require.Equal(t, 5432, val)
+		fpath, ok := doc.File("db.port")
+		require.True(t, ok)
+		require.Equal(t, entry, fpath)
+		fpath, ok = doc.File("db.host")
+		require.True(t, ok)
+		require.Equal(t, base, fpath)
+		_, ok = doc.File("not_exists")
+		require.False(t, ok)
+
+		require.NoError(t, doc.Set("db.port", 6432))
+		require.NoError(t, doc.Set("db.host", "db.local"))
+		require.NoError(t, doc.Set("log.level", "debug"))
+		require.NoError(t, doc.Delete("password"))
+		require.NoError(t, doc.Delete("db.pool.size"))
+		require.NoError(t, doc.Set("tags", []string{"b", "c"}))
+		require.NoError(t, doc.Delete("not_exists"))
+
+		val, ok = doc.Get("db.host")
+		require.True(t, ok)
+		require.Equal(t, "db.local", val)
+		return nil
+	}, WithAesEncrypt(secret))
+	require.NoError(t, err)
+
+	cnt, err := os.ReadFile(entry)
+	require.NoError(t, err)
+	require.Equal(t, `include: base.yml.enc
+
+# app name
+name: app
+db:
+  port: 6432        # override
+
+tags: [b, c]
+log:
+  level: debug
+`, string(cnt))
+
+	cnt, err = os.ReadFile(base)
+	require.NoError(t, err)
+	require.NotContains(t, string(cnt), "db")
+	cnt, err = encrypt.DecryptByAes(secret, cnt)
+	require.NoError(t, err)
+	require.Equal(t, `# shared settings
+db:
+  host: db.local   # db host
+  port: 3306
+
+`, string(cnt))
+
+	cfg := New()
+	require.NoError(t, cfg.LoadFromFile(entry, WithAesEncrypt(secret)))
+	require.Equal(t, "db.local", cfg.GetString("db.host"))
+	require.Equal(t, 6432, cfg.GetInt("db.port"))
+	require.Equal(t, "debug", cfg.GetString("log.level"))
+	require.False(t, cfg.IsSet("password"))
+}
+
+func TestEditFile_toml(t *testing.T) {
+	fpath := filepath.Join(t.TempDir(), "settings.toml")
+	require.NoError(t, os.WriteFile(fpath, []byte(`# app settings
+name = "app"
+debug = true # remove me
+
+[db]
+# db port
+port = 3306
+tags = [
+  "a",
+]
+`), 0644))
+
+	err := EditFile(fpath, func(doc *Document) error {
+		if err := doc.Set("db.port", 5432); err != nil {
+			return err
+		}
+		if err := doc.Delete("debug"); err != nil {
+			return err
+		}
+
+		return doc.Delete("db.tags")
+	})
+	require.NoError(t, err)
+
+	cnt, err := os.ReadFile(fpath)
+	require.NoError(t, err)
+	require.Equal(t, `# app settings
+name = "app"
+
+[db]
+# db port
+port = 5432
+`, string(cnt))
+}
+
+func TestEditFile_preserveFailed(t *testing.T) {
+	fpath := filepath.Join(t.TempDir(), "settings.jsonc")
+	origin := []byte("{\n  // app name\n  \"name\": \"app\",\n}\n")
+	require.NoError(t, os.WriteFile(fpath, origin, 0644))
+
+	err := EditFile(fpath, func(doc *Document) error {
+		return doc.Set("name", "changed")
+	})
+	require.ErrorContains(t, err, "can not preserve comments")
+
+	err = EditFile(fpath, func(doc *Document) error {
+		return doc.Delete("name")
+	})
+	require.ErrorContains(t, err, "can not preserve comments")
+
+	cnt, err := os.ReadFile(fpath)
+	require.NoError(t, err)
+	require.Equal(t, origin, cnt)
+}
@@ -0,0 +1,131 @@
+package config
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"regexp"
+	"strings"
+
+	"github.com/pelletier/go-toml"
+	"github.com/pkg/errors"
+	"github.com/spf13/viper"
+	"gopkg.in/yaml.v3"
+)
+
+// WithFormat format of settings files without supported extension,
+// like `/etc/app/config`. must be one of `viper.SupportedExts`, `jsonc`, `hcl2` or `cue`.
+//
+// if not set, format is detected from content, see `sniffFormat`.
+func WithFormat(format string) Option {
+	return func(opt *option) error {
+		format = strings.ToLower(strings.TrimPrefix(format, "."))
+		if !isSupportedFormat(format) {
+			return errors.Errorf("unsupported format `%s`", format)
+		}
+
+		opt.format = format
+		return nil
+	}
+}
+
+// settingsDecoders formats not supported by viper
+var settingsDecoders = map[string]func(fpath string, cnt []byte) (map[string]interface{}, error){
+	// jsonc json with comments and trailing commas
+	"jsonc": decodeJSONC,
+	// hcl2 hcl2 native syntax, `hcl` is hcl1 supported by viper
+	"hcl2": decodeHCL2,
+	// cue cue with constraints validated on load
+	"cue": decodeCUE,
+}
+
+// isSupportedFormat whether format is supported by viper or `settingsDecoders`
+func isSupportedFormat(format string) bool {
+	if _, ok := settingsDecoders[format]; ok {
+		return true
+	}
+
+	for _, supported := range viper.SupportedExts {
+		if format == supported {
+			return true
+		}
+	}
+
+	return false
+}
+
+// detectFormat get format of file, by extension, then `WithFormat`, then content
+func detectFormat(opt *option, fpath string, cnt []byte) (string, error) {
+	ext := configFileType(opt, fpath)
+	if isSupportedFormat(ext) {
+		return ext, nil
+	}
+
+	if opt.format != "" {
+		return opt.format, nil
+	}
+
+	if format := sniffFormat(cnt); format != "" {
+		return format, nil
+	}
+
+	return "", errors.Errorf("can not detect format of `%s`, set it by `WithFormat`", fpath)
+}
+
+var (
+	utf8BOM = []byte("\xef\xbb\xbf")
+	// dotenvLineRegexp line like `export KEY=value`
+	dotenvLineRegexp = regexp.MustCompile(`^(export\s+)?[A-Za-z_][A-Za-z0-9_.]*\s*=`)
+)
+
+// sniffFormat detect format of settings by content,
+// json, jsonc, toml, yaml and dotenv are detected in order.
+// return empty if not detected.
+func sniffFormat(cnt []byte) string {
+	cnt = bytes.TrimSpace(bytes.TrimPrefix(cnt, utf8BOM))
+	if len(cnt) == 0 {
+		return "yaml"
+	}
+
+	if cnt[0] == '{' {
+		switch {
+		case json.Valid(cnt):
+			return "json"
+		case json.Valid(blankJSONC(cnt)):
+			return "jsonc"
+		}
+	}
+
+	// yaml like `a: 1` is invalid toml, toml like `a = 1` is not a yaml map
+	if _, err := toml.LoadBytes(cnt); err == nil {
+		return "toml"
+	}
+
+	var settings map[string]interface{}
+	if err := yaml.Unmarshal(cnt, &settings); err == nil {
+		return "yaml"
+	}
+
+	if isDotenv(cnt) {
+		return "dotenv"
+	}
+
+	return ""
+}
+
+// isDotenv whether every line is comment or `KEY=value`
+func isDotenv(cnt []byte) bool {
+	scanner := bufio.NewScanner(bytes.NewReader(cnt))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		if !dotenvLineRegexp.MatchString(line) {
+			return false
+		}
+	}
+
+	return scanner.Err() == nil
+}
@@ -0,0 +1,132 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/Laisky/go-utils/v2/encrypt"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSniffFormat(t *testing.T) {
+	for cnt, format := range map[string]string{
+		"":                              "yaml",
+		`{"a": {"b": 1}}`:               "json",
+		"\xef\xbb\xbf{\"a\": 1}":        "json",
+		"a = 1\n[db]\nhost = \"local\"": "toml",
+		"a: 1\ndb:\n  host: local\n":    "yaml",
+		"# comment\nA=1\nexport B=c d":  "dotenv",
+		"just some text":                "",
+		"{\"a\": 1, // comment\n}":      "jsonc",
+		"{not json":                     "",
+	} {
+		require.Equal(t, format, sniffFormat([]byte(cnt)), cnt)
+	}
+}
+
+func TestWithFormat(t *testing.T) {
+	_, err := new(option).applyOptfs(WithFormat("txt"))
+	require.Error(t, err)
+
+	opt, err := new(option).fillDefault().applyOptfs(WithFormat(".YAML"))
+	require.NoError(t, err)
+	require.Equal(t, "yaml", opt.format)
+
+	format, err := detectFormat(opt, "settings.json", []byte(`{}`))
+	require.NoError(t, err)
+	require.Equal(t, "json", format, "extension takes precedence")
+
+	format, err = detectFormat(opt, "config", []byte(`{}`))
+	require.NoError(t, err)
+	require.Equal(t, "yaml", format)
+
+	_, err = detectFormat(new(option).fillDefault(), "config", []byte("just some text"))
+	require.ErrorContains(t, err, "WithFormat")
+
+	format, err = detectFormat(opt, "settings.cue", []byte("name: \"app\"\n"))
+	require.NoError(t, err)
+	require.Equal(t, "cue", format)
+}
+
+func TestLoadFromFile_format(t *testing.T) {
+	dir := t.TempDir()
+	fpath := filepath.Join(dir, "config")
+	require.NoError(t, os.WriteFile(fpath, []byte("include: base\nname: app\n"), 0600))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "base"), []byte("[db]\nport = 3306\n"), 0600))
+
+	cfg := New()
+	require.NoError(t, cfg.LoadFromFile(fpath))
+	require.Equal(t, "app", cfg.GetString("name"))
+	require.Equal(t, 3306, cfg.GetInt("db.port"))
+
+	pos, ok := cfg.Origin("db.port")
+	require.True(t, ok)
+	require.Equal(t, 2, pos.Line)
+
+	require.NoError(t, os.WriteFile(fpath, []byte("name=dotenv\n"), 0600))
+	require.NoError(t, cfg.LoadFromFile(fpath, WithFormat("dotenv")))
+	require.Equal(t, "dotenv", cfg.GetString("name"))
+}
+
+func TestConfig_ReadConfig_format(t *testing.T) {
+	cfg := New()
+	require.NoError(t, cfg.ReadConfig(strings.NewReader(`{"name": "json"}`), ""))
+	require.Equal(t, "json", cfg.GetString("name"))
+
+	require.NoError(t, cfg.MergeConfig(strings.NewReader("port = 1"), "toml"))
+	require.Equal(t, "json", cfg.GetString("name"))
+	require.Equal(t, 1, cfg.GetInt("port"))
+
+	pos, ok := cfg.Origin("port")
+	require.True(t, ok)
+	require.Equal(t, readerSourceName, pos.File)
+	require.Equal(t, 1, pos.Line)
+
+	require.Error(t, cfg.MergeConfig(strings.NewReader("just some text"), ""))
+	require.Error(t, cfg.MergeConfig(strings.NewReader("a: 1"), "txt"))
+	require.Equal(t, 1, cfg.GetInt("port"))
+}
+
+func TestLoadFromFile_extraFormats(t *testing.T) {
+	secret := []byte("secret")
+	dir := t.TempDir()
+	encrypted, err := encrypt.EncryptByAes(secret, []byte("DB__PASSWORD=p@ss\nINCLUDE=base.hcl2\n"))
+	require.NoError(t, err)
+
+	for fname, cnt := range map[string][]byte{
+		"settings.jsonc": []byte(`{
+			// app settings
+			"include": "secret.env.enc",
+			"name": "app",
+		}`),
+		"secret.env.enc": encrypted,
+		"base.hcl2":      []byte("include = \"common.cue\"\ndb {\n  host = \"localhost\"\n  password = \"base\"\n}\n"),
+		"common.cue":     []byte("#Log: {level: \"debug\" | \"info\"}\nlog: #Log & {level: \"debug\"}\n"),
+	} {
+		require.NoError(t, os.WriteFile(filepath.Join(dir, fname), cnt, 0600))
+	}
+
+	cfg := New()
+	require.NoError(t, cfg.LoadFromFile(filepath.Join(dir, "settings.jsonc"), WithAesEncrypt(secret)))
+	require.Equal(t, "app", cfg.GetString("name"))
+	require.Equal(t, "p@ss", cfg.GetString("db.password"))
+	require.Equal(t, "localhost", cfg.GetString("db.host"))
+
+	pos, ok := cfg.Origin("db.host")
+	require.True(t, ok)
+	require.Equal(t, filepath.Join(dir, "base.hcl2"), pos.File)
+	require.Equal(t, 3, pos.Line)
+
+	require.Equal(t, "debug", cfg.GetString("log.level"))
+	require.False(t, cfg.IsSet("#log"))
+	pos, ok = cfg.Origin("log.level")
+	require.True(t, ok)
+	require.Equal(t, filepath.Join(dir, "common.cue"), pos.File)
+	require.Equal(t, 2, pos.Line)
+
+	cfg = New()
+	require.NoError(t, cfg.LoadFromDir(dir, WithMergeAllFiles(), WithAesEncrypt(secret)))
+	require.Equal(t, "localhost", cfg.GetString("db.host"))
+}
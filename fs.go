@@ -0,0 +1,86 @@
+package config
+
+import (
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+
+	"github.com/pkg/errors"
+)
+
+// WithFS read settings files from fsys instead of disk,
+// like `embed.FS` or `fstest.MapFS`.
+//
+// paths are slash-separated and relative to the root of fsys,
+// like `configs/settings.yml`. can not be used with `WithWatchFileModified`.
+//
+//	//go:embed settings.yml
+//	var defaults embed.FS
+//
+//	cfg.LoadDefaultsFromFile("settings.yml", config.WithFS(defaults))
+//	cfg.LoadFromFile("/etc/app/settings.yml")
+func WithFS(fsys fs.FS) Option {
+	return func(opt *option) error {
+		if fsys == nil {
+			return errors.New("fs is nil")
+		}
+
+		opt.fsys = fsys
+		return nil
+	}
+}
+
+// checkFS options not supported by fs
+func (o *option) checkFS() error {
+	if o.fsys != nil && o.watchModify {
+		return errors.New("can not watch files in fs")
+	}
+
+	return nil
+}
+
+// open open file from fs or disk
+func (o *option) open(fpath string) (fs.File, error) {
+	if o.fsys != nil {
+		return o.fsys.Open(fpath)
+	}
+
+	return os.Open(fpath)
+}
+
+// stat stat file from fs or disk, symlinks are followed
+func (o *option) stat(fpath string) (fs.FileInfo, error) {
+	if o.fsys != nil {
+		return fs.Stat(o.fsys, fpath)
+	}
+
+	return os.Stat(fpath)
+}
+
+// readDir read dir from fs or disk
+func (o *option) readDir(dir string) ([]fs.DirEntry, error) {
+	if o.fsys != nil {
+		return fs.ReadDir(o.fsys, dir)
+	}
+
+	return os.ReadDir(dir)
+}
+
+// joinPath join path elements, slash-separated in fs
+func (o *option) joinPath(elem ...string) string {
+	if o.fsys != nil {
+		return path.Join(elem...)
+	}
+
+	return filepath.Join(elem...)
+}
+
+// dirPath parent dir of fpath, slash-separated in fs
+func (o *option) dirPath(fpath string) string {
+	if o.fsys != nil {
+		return path.Dir(fpath)
+	}
+
+	return filepath.Dir(fpath)
+}
@@ -0,0 +1,116 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"testing/fstest"
+
+	"github.com/Laisky/go-utils/v2/encrypt"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWithFS(t *testing.T) {
+	secret := []byte("secret")
+	encrypted, err := encrypt.EncryptByAes(secret, []byte("db:\n  password: p@ss\n"))
+	require.NoError(t, err)
+
+	fsys := fstest.MapFS{
+		"configs/settings.yml":           {Data: []byte("include: base.yml\nname: app\n")},
+		"configs/base.yml":               {Data: []byte("include: secret.yml.enc\nname: base\ndb:\n  host: localhost\n")},
+		"configs/secret.yml.enc":         {Data: encrypted},
+		"configs/settings.prod.yml":      {Data: []byte("db:\n  host: prod\n")},
+		"configs/conf.d/00-a.yml":        {Data: []byte("a: 1\n")},
+		"configs/keys/db__host":          {Data: []byte("keyperfile\n")},
+		"configs/keys/conf.d/ignored":    {Data: []byte("dir")},
+		"configs/keys/.hidden":           {Data: []byte("hidden")},
+		"configs/conf.d/README.md":       {Data: []byte("ignored")},
+		"configs/conf.d/10-b.yml":        {Data: []byte("b: 2\n")},
+		"configs/conf.d/20-c.json":       {Data: []byte(`{"c": 3}`)},
+		"configs/conf.d/30-d.toml":       {Data: []byte("d = 4\n")},
+		"configs/conf.d/sub/ignored.yml": {Data: []byte("ignored: true\n")},
+	}
+
+	t.Run("file", func(t *testing.T) {
+		cfg := New()
+		require.NoError(t, cfg.LoadFromFile("configs/settings.yml",
+			WithFS(fsys), WithAesEncrypt(secret), WithProfile("prod")))
+		require.Equal(t, "app", cfg.GetString("name"))
+		require.Equal(t, "prod", cfg.GetString("db.host"))
+		require.Equal(t, "p@ss", cfg.GetString("db.password"))
+
+		pos, ok := cfg.Origin("db.password")
+		require.True(t, ok)
+		require.Equal(t, "configs/secret.yml.enc", pos.File)
+	})
+
+	t.Run("dir", func(t *testing.T) {
+		cfg := New()
+		require.NoError(t, cfg.LoadFromDir("configs", WithFS(fsys), WithAesEncrypt(secret)))
+		require.Equal(t, "app", cfg.GetString("name"))
+
+		cfg = New()
+		require.NoError(t, cfg.LoadFromDir("configs/conf.d", WithFS(fsys), WithMergeAllFiles()))
+		require.Equal(t, 1, cfg.GetInt("a"))
+		require.Equal(t, 4, cfg.GetInt("d"))
+		require.False(t, cfg.IsSet("ignored"))
+
+		cfg = New()
+		require.NoError(t, cfg.LoadFromDir("configs/keys", WithFS(fsys), WithKeyPerFile()))
+		require.Equal(t, "keyperfile", cfg.GetString("db.host"))
+	})
+
+	t.Run("invalid", func(t *testing.T) {
+		_, err := new(option).applyOptfs(WithFS(nil))
+		require.Error(t, err)
+
+		cfg := New()
+		require.Error(t, cfg.LoadFromFile("configs/settings.yml",
+			WithFS(fsys), WithWatchFileModified(nil)))
+		require.Error(t, cfg.LoadFromFile("configs/not-exists.yml", WithFS(fsys)))
+		_, _, err = cfg.MigrateFile("configs/settings.yml", WithFS(fsys))
+		require.Error(t, err)
+	})
+}
+
+func TestConfig_LoadDefaultsFromFile(t *testing.T) {
+	fsys := fstest.MapFS{
+		"settings.yml": {Data: []byte("name: default\ndb:\n  host: localhost\n  port: 3306\n")},
+	}
+
+	dir := t.TempDir()
+	fpath := filepath.Join(dir, "settings.yml")
+	require.NoError(t, os.WriteFile(fpath, []byte("db:\n  host: remote\n"), 0600))
+
+	cfg := New()
+	require.NoError(t, cfg.LoadFromFile(fpath))
+	require.NoError(t, cfg.LoadDefaultsFromFile("settings.yml", WithFS(fsys)))
+	cfg.SetDefault("name", "set-default")
+
+	require.Equal(t, "remote", cfg.GetString("db.host"))
+	require.Equal(t, 3306, cfg.GetInt("db.port"))
+	require.Equal(t, "set-default", cfg.GetString("name"))
+	require.False(t, cfg.InConfig("db.port"))
+
+	exp, err := cfg.Explain("db.port")
+	require.NoError(t, err)
+	require.Equal(t, LayerDefault, exp.Layer)
+	require.Equal(t, "settings.yml", exp.Source)
+	require.Equal(t, 4, exp.Line)
+
+	pos, ok := cfg.Origin("db.port")
+	require.True(t, ok)
+	require.Equal(t, "settings.yml", pos.File)
+	_, ok = cfg.Origin("name")
+	require.False(t, ok)
+
+	exp, err = cfg.Explain("db.host")
+	require.NoError(t, err)
+	require.Equal(t, LayerFile, exp.Layer)
+
+	require.NoError(t, cfg.ReloadLayer(LayerDefault))
+	require.Equal(t, 3306, cfg.GetInt("db.port"))
+
+	require.Error(t, cfg.LoadDefaultsFromFile("settings.yml",
+		WithFS(fsys), WithWatchFileModified(nil)))
+}
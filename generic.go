@@ -0,0 +1,160 @@
+package config
+
+import (
+	"sync"
+	"time"
+
+	"github.com/mitchellh/mapstructure"
+	"github.com/pkg/errors"
+	"github.com/spf13/cast"
+)
+
+// Get get setting by key and convert it to T
+//
+// return `ErrKeyNotFound` if key is not set,
+// return error if value can not be converted to T.
+//
+// basic types, `time.Duration`, `time.Time`, `[]string`, `[]int` and maps are
+// converted like viper's getters, other types (like structs) are decoded by mapstructure.
+func Get[T any](cfg Reader, key string) (T, error) {
+	var zero T
+	raw, ok := cfg.lookup(key)
+	if !ok {
+		return zero, errors.Wrapf(ErrKeyNotFound, "key `%s`", key)
+	}
+
+	val, err := convert[T](raw)
+	if err != nil {
+		return zero, errors.Wrapf(err, "convert key `%s` to %T", key, zero)
+	}
+
+	return val, nil
+}
+
+// GetOr get setting by key and convert it to T,
+// return def if key is not set or can not be converted.
+func GetOr[T any](cfg Reader, key string, def T) T {
+	val, err := Get[T](cfg, key)
+	if err != nil {
+		return def
+	}
+
+	return val
+}
+
+// convert convert val to T
+func convert[T any](val interface{}) (out T, err error) {
+	switch p := interface{}(&out).(type) {
+	case *string:
+		*p, err = cast.ToStringE(val)
+	case *bool:
+		*p, err = cast.ToBoolE(val)
+	case *int:
+		*p, err = cast.ToIntE(val)
+	case *int8:
+		*p, err = cast.ToInt8E(val)
+	case *int16:
+		*p, err = cast.ToInt16E(val)
+	case *int32:
+		*p, err = cast.ToInt32E(val)
+	case *int64:
+		*p, err = cast.ToInt64E(val)
+	case *uint:
+		*p, err = cast.ToUintE(val)
+	case *uint8:
+		*p, err = cast.ToUint8E(val)
+	case *uint16:
+		*p, err = cast.ToUint16E(val)
+	case *uint32:
+		*p, err = cast.ToUint32E(val)
+	case *uint64:
+		*p, err = cast.ToUint64E(val)
+	case *float32:
+		*p, err = cast.ToFloat32E(val)
+	case *float64:
+		*p, err = cast.ToFloat64E(val)
+	case *time.Duration:
+		*p, err = cast.ToDurationE(val)
+	case *time.Time:
+		*p, err = cast.ToTimeE(val)
+	case *[]string:
+		*p, err = cast.ToStringSliceE(val)
+	case *[]int:
+		*p, err = cast.ToIntSliceE(val)
+	case *map[string]interface{}:
+		*p, err = cast.ToStringMapE(val)
+	case *map[string]string:
+		*p, err = cast.ToStringMapStringE(val)
+	default:
+		decoder, err := mapstructure.NewDecoder(&mapstructure.DecoderConfig{
+			Result:           &out,
+			WeaklyTypedInput: true,
+			DecodeHook: mapstructure.ComposeDecodeHookFunc(
+				mapstructure.StringToTimeDurationHookFunc(),
+				mapstructure.StringToSliceHookFunc(","),
+			),
+		})
+		if err != nil {
+			return out, err
+		}
+
+		return out, decoder.Decode(val)
+	}
+
+	return out, err
+}
+
+// Key typed handle of setting key
+//
+// parsed value is cached, and invalidated once settings changed,
+// like file reloaded or `Set` called.
+//
+// Example
+//
+//	var timeout = config.NewKey[time.Duration](cfg, "http.timeout")
+//
+//	d, err := timeout.Get()
+type Key[T any] struct {
+	cfg  Reader
+	name string
+
+	mu       sync.Mutex
+	revision uint64
+	cached   bool
+	val      T
+	err      error
+}
+
+// NewKey new typed handle of key in cfg
+func NewKey[T any](cfg Reader, name string) *Key[T] {
+	return &Key[T]{cfg: cfg, name: name}
+}
+
+// Name name of key
+func (k *Key[T]) Name() string {
+	return k.name
+}
+
+// Get get value of key, see `Get`
+func (k *Key[T]) Get() (T, error) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	revision := k.cfg.revision()
+	if !k.cached || k.revision != revision {
+		k.val, k.err = Get[T](k.cfg, k.name)
+		k.revision, k.cached = revision, true
+	}
+
+	return k.val, k.err
+}
+
+// GetOr get value of key, return def if key is not set or can not be converted
+func (k *Key[T]) GetOr(def T) T {
+	val, err := k.Get()
+	if err != nil {
+		return def
+	}
+
+	return val
+}
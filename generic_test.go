@@ -0,0 +1,150 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	gutils "github.com/Laisky/go-utils/v2"
+	"github.com/stretchr/testify/require"
+)
+
+// loadYAML load yaml content into cfg by a temp file
+func loadYAML(t *testing.T, cfg Config, cnt string) {
+	fpath := filepath.Join(t.TempDir(), "settings.yml")
+	require.NoError(t, os.WriteFile(fpath, []byte(cnt), 0644))
+	require.NoError(t, cfg.LoadFromFile(fpath))
+}
+
+func TestGet(t *testing.T) {
+	cfg := New()
+	loadYAML(t, cfg, gutils.Dedent(`
+		str: hello
+		int: "42"
+		uint: 7
+		float: 3.14
+		bool: "true"
+		duration: 1m30s
+		time: 2022-12-01T10:00:00Z
+		strs: [a, b]
+		ints: [1, "2", 3]
+		negative: -1
+		db:
+		  host: localhost
+		  port: "3306"
+		  timeout: 3s
+		  tags: a,b
+	`))
+
+	t.Run("basic", func(t *testing.T) {
+		str, err := Get[string](cfg, "str")
+		require.NoError(t, err)
+		require.Equal(t, "hello", str)
+
+		i, err := Get[int](cfg, "int")
+		require.NoError(t, err)
+		require.Equal(t, 42, i)
+
+		u, err := Get[uint16](cfg, "uint")
+		require.NoError(t, err)
+		require.Equal(t, uint16(7), u)
+
+		f, err := Get[float64](cfg, "float")
+		require.NoError(t, err)
+		require.Equal(t, 3.14, f)
+
+		b, err := Get[bool](cfg, "bool")
+		require.NoError(t, err)
+		require.True(t, b)
+
+		d, err := Get[time.Duration](cfg, "duration")
+		require.NoError(t, err)
+		require.Equal(t, 90*time.Second, d)
+
+		tm, err := Get[time.Time](cfg, "time")
+		require.NoError(t, err)
+		require.True(t, tm.Equal(time.Date(2022, 12, 1, 10, 0, 0, 0, time.UTC)))
+
+		strs, err := Get[[]string](cfg, "strs")
+		require.NoError(t, err)
+		require.Equal(t, []string{"a", "b"}, strs)
+
+		ints, err := Get[[]int](cfg, "ints")
+		require.NoError(t, err)
+		require.Equal(t, []int{1, 2, 3}, ints)
+
+		m, err := Get[map[string]string](cfg, "db")
+		require.NoError(t, err)
+		require.Equal(t, "localhost", m["host"])
+	})
+
+	t.Run("struct", func(t *testing.T) {
+		type DB struct {
+			Host    string        `mapstructure:"host"`
+			Port    int           `mapstructure:"port"`
+			Timeout time.Duration `mapstructure:"timeout"`
+			Tags    []string      `mapstructure:"tags"`
+		}
+
+		db, err := Get[DB](cfg, "db")
+		require.NoError(t, err)
+		require.Equal(t, DB{Host: "localhost", Port: 3306, Timeout: 3 * time.Second, Tags: []string{"a", "b"}}, db)
+
+		ptr, err := Get[*DB](cfg, "db")
+		require.NoError(t, err)
+		require.Equal(t, "localhost", ptr.Host)
+	})
+
+	t.Run("error", func(t *testing.T) {
+		_, err := Get[int](cfg, "not-exists")
+		require.ErrorIs(t, err, ErrKeyNotFound)
+
+		_, err = Get[int](cfg, "str")
+		require.ErrorContains(t, err, "convert key `str` to int")
+
+		_, err = Get[uint](cfg, "negative")
+		require.Error(t, err)
+	})
+
+	t.Run("or", func(t *testing.T) {
+		require.Equal(t, 42, GetOr(cfg, "int", 1))
+		require.Equal(t, 1, GetOr(cfg, "not-exists", 1))
+		require.Equal(t, 1, GetOr(cfg, "str", 1))
+	})
+}
+
+func TestKey(t *testing.T) {
+	cfg := New()
+	loadYAML(t, cfg, "timeout: 3s\n")
+
+	timeout := NewKey[time.Duration](cfg, "timeout")
+	require.Equal(t, "timeout", timeout.Name())
+
+	d, err := timeout.Get()
+	require.NoError(t, err)
+	require.Equal(t, 3*time.Second, d)
+
+	// invalidated by reload
+	loadYAML(t, cfg, "timeout: 5s\n")
+	d, err = timeout.Get()
+	require.NoError(t, err)
+	require.Equal(t, 5*time.Second, d)
+
+	// invalidated by Set
+	cfg.Set("timeout", "invalid")
+	_, err = timeout.Get()
+	require.Error(t, err)
+	require.Equal(t, time.Second, timeout.GetOr(time.Second))
+
+	cfg.Set("timeout", 7*time.Second)
+	require.Equal(t, 7*time.Second, timeout.GetOr(time.Second))
+
+	// not set
+	port := NewKey[int](cfg, "port")
+	_, err = port.Get()
+	require.ErrorIs(t, err, ErrKeyNotFound)
+
+	cfg.SetDefault("port", 8080)
+	require.Equal(t, 8080, port.GetOr(0))
+}
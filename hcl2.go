@@ -0,0 +1,153 @@
+package config
+
+import (
+	"math/big"
+	"strings"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+	"github.com/pkg/errors"
+	"github.com/zclconf/go-cty/cty"
+)
+
+// parseHCL2 parse hcl2 native syntax
+func parseHCL2(fpath string, cnt []byte) (*hclsyntax.Body, error) {
+	file, diags := hclsyntax.ParseConfig(cnt, fpath, hcl.InitialPos)
+	if diags.HasErrors() {
+		return nil, errors.Wrap(diags, "parse hcl2")
+	}
+
+	return file.Body.(*hclsyntax.Body), nil
+}
+
+// decodeHCL2 decode hcl2 into settings,
+// variables and functions are not supported in expressions.
+//
+// blocks are nested by type and labels, like `server "a" { port = 1 }`
+// to `{"server": {"a": {"port": 1}}}`, repeated blocks without labels are lists,
+// repeated blocks with the same labels are error.
+func decodeHCL2(fpath string, cnt []byte) (map[string]interface{}, error) {
+	body, err := parseHCL2(fpath, cnt)
+	if err != nil {
+		return nil, err
+	}
+
+	return hcl2BodySettings(body)
+}
+
+func hcl2BodySettings(body *hclsyntax.Body) (map[string]interface{}, error) {
+	settings := map[string]interface{}{}
+	for name, attr := range body.Attributes {
+		val, diags := attr.Expr.Value(nil)
+		if diags.HasErrors() {
+			return nil, errors.Wrapf(diags, "evaluate `%s`", name)
+		}
+
+		settings[name] = ctyToGo(val)
+	}
+
+	unlabeled := map[string]int{}
+	for _, block := range body.Blocks {
+		if len(block.Labels) == 0 {
+			unlabeled[block.Type]++
+		}
+	}
+
+	labeled := map[string]hcl.Range{}
+	for _, block := range body.Blocks {
+		if len(block.Labels) != 0 {
+			key := strings.Join(append([]string{block.Type}, block.Labels...), ".")
+			if prev, ok := labeled[key]; ok {
+				return nil, errors.Errorf("duplicate block `%s` at %s, already defined at %s",
+					key, block.DefRange(), prev)
+			}
+			labeled[key] = block.DefRange()
+		}
+
+		sub, err := hcl2BodySettings(block.Body)
+		if err != nil {
+			return nil, err
+		}
+
+		if len(block.Labels) == 0 && unlabeled[block.Type] > 1 {
+			list, _ := settings[block.Type].([]interface{})
+			settings[block.Type] = append(list, sub)
+			continue
+		}
+
+		putSettings(settings, append([]string{block.Type}, block.Labels...), sub)
+	}
+
+	return settings, nil
+}
+
+// ctyToGo convert cty value to go value
+func ctyToGo(val cty.Value) interface{} {
+	if val.IsNull() || !val.IsKnown() {
+		return nil
+	}
+
+	ty := val.Type()
+	switch {
+	case ty == cty.String:
+		return val.AsString()
+	case ty == cty.Bool:
+		return val.True()
+	case ty == cty.Number:
+		bf := val.AsBigFloat()
+		if i, acc := bf.Int64(); acc == big.Exact {
+			return int(i)
+		}
+
+		f, _ := bf.Float64()
+		return f
+	case ty.IsListType(), ty.IsTupleType(), ty.IsSetType():
+		list := make([]interface{}, 0, val.LengthInt())
+		for it := val.ElementIterator(); it.Next(); {
+			_, v := it.Element()
+			list = append(list, ctyToGo(v))
+		}
+
+		return list
+	case ty.IsMapType(), ty.IsObjectType():
+		m := map[string]interface{}{}
+		for it := val.ElementIterator(); it.Next(); {
+			k, v := it.Element()
+			m[k.AsString()] = ctyToGo(v)
+		}
+
+		return m
+	}
+
+	return nil
+}
+
+// walkHCL2 find positions of attributes and blocks
+func (ps keyPositions) walkHCL2(fpath string, cnt []byte) error {
+	body, err := parseHCL2(fpath, cnt)
+	if err != nil {
+		return err
+	}
+
+	var walk func(prefix string, body *hclsyntax.Body)
+	walk = func(prefix string, body *hclsyntax.Body) {
+		for name, attr := range body.Attributes {
+			pos := attr.NameRange.Start
+			ps[joinKey(prefix, name)] = Position{File: fpath, Line: pos.Line, Column: pos.Column}
+		}
+
+		for _, block := range body.Blocks {
+			key := joinKey(prefix, block.Type)
+			for _, label := range block.Labels {
+				key = joinKey(key, label)
+			}
+
+			pos := block.TypeRange.Start
+			ps[key] = Position{File: fpath, Line: pos.Line, Column: pos.Column}
+			walk(key, block.Body)
+		}
+	}
+	walk("", body)
+
+	return nil
+}
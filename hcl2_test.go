@@ -0,0 +1,69 @@
+package config
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestDecodeHCL2(t *testing.T) {
+	cnt := []byte(`
+name    = "app"
+port    = 8080
+ratio   = 0.5
+debug   = true
+tags    = ["a", "b"]
+limits  = { cpu = 2 }
+timeout = "${3 * 10}s"
+
+db {
+  host = "localhost"
+}
+
+server "a" {
+  port = 1
+}
+
+server "b" {
+  port = 2
+}
+
+listener {
+  port = 80
+}
+
+listener {
+  port = 443
+}
+`)
+
+	settings, err := decodeHCL2("settings.hcl2", cnt)
+	require.NoError(t, err)
+	require.Equal(t, "app", settings["name"])
+	require.Equal(t, 8080, settings["port"])
+	require.Equal(t, 0.5, settings["ratio"])
+	require.Equal(t, true, settings["debug"])
+	require.Equal(t, []interface{}{"a", "b"}, settings["tags"])
+	require.Equal(t, map[string]interface{}{"cpu": 2}, settings["limits"])
+	require.Equal(t, "30s", settings["timeout"])
+	require.Equal(t, map[string]interface{}{"host": "localhost"}, settings["db"])
+	require.Equal(t, map[string]interface{}{
+		"a": map[string]interface{}{"port": 1},
+		"b": map[string]interface{}{"port": 2},
+	}, settings["server"])
+	require.Equal(t, []interface{}{
+		map[string]interface{}{"port": 80},
+		map[string]interface{}{"port": 443},
+	}, settings["listener"])
+
+	positions := parsePositions("hcl2", "settings.hcl2", cnt)
+	require.Equal(t, Position{File: "settings.hcl2", Line: 11, Column: 3}, positions["db.host"])
+	require.Equal(t, 18, positions["server.b"].Line)
+
+	_, err = decodeHCL2("settings.hcl2", []byte(`a = var.b`))
+	require.Error(t, err)
+	_, err = decodeHCL2("settings.hcl2", []byte(`a = `))
+	require.Error(t, err)
+	_, err = decodeHCL2("settings.hcl2", []byte("server \"a\" {\n  port = 1\n}\nserver \"a\" {\n  port = 2\n}\n"))
+	require.ErrorContains(t, err, "duplicate block `server.a` at settings.hcl2:4")
+}
@@ -0,0 +1,94 @@
+package config
+
+import (
+	"encoding/json"
+
+	"github.com/pkg/errors"
+)
+
+// decodeJSONC decode json with comments and trailing commas
+func decodeJSONC(_ string, cnt []byte) (map[string]interface{}, error) {
+	settings := map[string]interface{}{}
+	if err := json.Unmarshal(blankJSONC(cnt), &settings); err != nil {
+		return nil, errors.Wrap(err, "parse jsonc")
+	}
+
+	return settings, nil
+}
+
+// blankJSONC replace comments and trailing commas in jsonc by spaces,
+// newlines are kept, so offsets of other tokens are not changed.
+func blankJSONC(cnt []byte) []byte {
+	out := make([]byte, len(cnt))
+	copy(out, cnt)
+
+	blank := func(from, to int) {
+		for i := from; i < to && i < len(out); i++ {
+			if out[i] != '\n' && out[i] != '\r' {
+				out[i] = ' '
+			}
+		}
+	}
+
+	// comments
+	var inString bool
+	for i := 0; i < len(out); i++ {
+		c := out[i]
+		switch {
+		case inString:
+			switch c {
+			case '\\':
+				i++
+			case '"':
+				inString = false
+			}
+		case c == '"':
+			inString = true
+		case c == '/' && i+1 < len(out) && out[i+1] == '/':
+			end := i
+			for end < len(out) && out[end] != '\n' {
+				end++
+			}
+			blank(i, end)
+			i = end
+		case c == '/' && i+1 < len(out) && out[i+1] == '*':
+			end := i + 2
+			for end+1 < len(out) && !(out[end] == '*' && out[end+1] == '/') {
+				end++
+			}
+			blank(i, end+2)
+			i = end + 1
+		}
+	}
+
+	// trailing commas
+	inString = false
+	for i := 0; i < len(out); i++ {
+		c := out[i]
+		switch {
+		case inString:
+			switch c {
+			case '\\':
+				i++
+			case '"':
+				inString = false
+			}
+		case c == '"':
+			inString = true
+		case c == ',':
+			next := i + 1
+			for next < len(out) && isJSONSpace(out[next]) {
+				next++
+			}
+			if next < len(out) && (out[next] == '}' || out[next] == ']') {
+				out[i] = ' '
+			}
+		}
+	}
+
+	return out
+}
+
+func isJSONSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\n' || c == '\r'
+}
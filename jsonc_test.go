@@ -0,0 +1,36 @@
+package config
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestDecodeJSONC(t *testing.T) {
+	cnt := []byte(`{
+	// line comment
+	"name": "app // not comment", /* block
+	comment */
+	"url": "http://a/*b*/",
+	"escaped": "quote \" , }",
+	"list": [1, 2, ],
+	"db": {"host": "localhost",},
+}`)
+
+	settings, err := decodeJSONC("settings.jsonc", cnt)
+	require.NoError(t, err)
+	require.Equal(t, "app // not comment", settings["name"])
+	require.Equal(t, "http://a/*b*/", settings["url"])
+	require.Equal(t, "quote \" , }", settings["escaped"])
+	require.Equal(t, []interface{}{1.0, 2.0}, settings["list"])
+	require.Equal(t, map[string]interface{}{"host": "localhost"}, settings["db"])
+
+	// offsets are kept
+	require.Len(t, blankJSONC(cnt), len(cnt))
+	positions := parsePositions("jsonc", "settings.jsonc", cnt)
+	require.Equal(t, 3, positions["name"].Line)
+	require.Equal(t, 8, positions["db.host"].Line)
+
+	_, err = decodeJSONC("settings.jsonc", []byte(`{"a": }`))
+	require.Error(t, err)
+}
@@ -0,0 +1,651 @@
+package config
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/viper"
+)
+
+// Layer of settings, settings in higher layer override lower ones
+type Layer int
+
+const (
+	// LayerDefault set by `SetDefault` and `LoadDefaultsFromFile`
+	LayerDefault Layer = iota
+	// LayerFile loaded by `LoadFromFile`, `LoadFromDir`, `ReadConfig` and `MergeConfig`
+	LayerFile
+	// LayerRemote loaded by `LoadFromRemote`, `LoadFromURL` and `LoadFromConfigServer`
+	LayerRemote
+	// LayerEnv environment variables enabled by `LoadFromEnv`
+	LayerEnv
+	// LayerFlag command line flags bound by `BindPFlags`
+	LayerFlag
+	// LayerOverride set by `Set`
+	LayerOverride
+)
+
+// String name of layer
+func (l Layer) String() string {
+	switch l {
+	case LayerDefault:
+		return "default"
+	case LayerFile:
+		return "file"
+	case LayerRemote:
+		return "remote"
+	case LayerEnv:
+		return "env"
+	case LayerFlag:
+		return "flag"
+	case LayerOverride:
+		return "override"
+	default:
+		return fmt.Sprintf("Layer(%d)", int(l))
+	}
+}
+
+// Explanation where the effective value of key comes from
+type Explanation struct {
+	Key   string
+	Value interface{}
+	Layer Layer
+	// Source file path, remote provider, env name or flag name
+	Source string
+	// Line, Column position in config file, 0 means unknown
+	Line, Column int
+}
+
+// layerSource settings loaded from one source, like a file
+type layerSource struct {
+	name string
+	// settings nested settings with lower-cased keys
+	settings map[string]interface{}
+	// positions positions of keys in config file, optional
+	positions keyPositions
+	// resets keys to be deleted from included files, see `parseResetKeys`
+	resets map[string]bool
+	// format format of file, like `yaml`, optional
+	format string
+	// encrypted whether decrypted from encrypted file
+	encrypted bool
+	// raw settings parsed from file itself, before migrated and merged
+	// with includes, nil means the same as settings. used by `Save`.
+	raw map[string]interface{}
+}
+
+// ownSettings settings of the source itself, without migrations and includes merged
+func (src layerSource) ownSettings() map[string]interface{} {
+	if src.raw != nil {
+		return src.raw
+	}
+
+	return src.settings
+}
+
+// layerGroup sources loaded together, like a file and its includes,
+// sources are in ascending priority.
+type layerGroup struct {
+	name    string
+	sources []layerSource
+	// reload read all sources again, nil means can not be reloaded
+	reload func() ([]layerSource, error)
+}
+
+// keyValue key-value pair
+type keyValue struct {
+	key string
+	val interface{}
+}
+
+// envKeyReplacer convert key to env name, like `db.host` -> `DB_HOST`
+var envKeyReplacer = strings.NewReplacer(".", "_", "-", "_")
+
+// normalizeSettings lower-case and nest all keys
+func normalizeSettings(settings map[string]interface{}) (map[string]interface{}, error) {
+	v := viper.New()
+	if err := v.MergeConfigMap(settings); err != nil {
+		return nil, errors.Wrap(err, "normalize settings")
+	}
+
+	return viperSettings(v), nil
+}
+
+// parseSettings parse settings in format cfgType
+func parseSettings(cfgType, fpath string, in io.Reader) (map[string]interface{}, error) {
+	if decode, ok := settingsDecoders[cfgType]; ok {
+		cnt, err := io.ReadAll(in)
+		if err != nil {
+			return nil, errors.Wrap(err, "read settings")
+		}
+
+		settings, err := decode(fpath, cnt)
+		if err != nil {
+			return nil, err
+		}
+
+		return normalizeSettings(settings)
+	}
+
+	v := viper.New()
+	v.SetConfigType(cfgType)
+	if err := v.ReadConfig(in); err != nil {
+		return nil, err
+	}
+
+	settings := viperSettings(v)
+	if cfgType == "dotenv" || cfgType == "env" {
+		settings = nestDotenvKeys(settings)
+	}
+
+	return settings, nil
+}
+
+// dotenvNestedSep separator of nested keys in dotenv, like `DB__HOST=localhost`
+const dotenvNestedSep = "__"
+
+// nestDotenvKeys convert `{"db__host": 1}` to `{"db": {"host": 1}}`
+func nestDotenvKeys(settings map[string]interface{}) map[string]interface{} {
+	nested := make(map[string]interface{}, len(settings))
+	for k, v := range settings {
+		if !strings.Contains(k, dotenvNestedSep) {
+			nested[k] = v
+		}
+	}
+	for k, v := range settings {
+		if strings.Contains(k, dotenvNestedSep) {
+			putSettings(nested, strings.Split(k, dotenvNestedSep), v)
+		}
+	}
+
+	return nested
+}
+
+// viperSettings get all settings of viper.
+//
+// unlike `viper.AllSettings`, keys contain `.` like `{"a": {"b.c": 1}}`
+// are not split into `{"a": {"b": {"c": 1}}}`.
+func viperSettings(v *viper.Viper) map[string]interface{} {
+	settings := map[string]interface{}{}
+	for _, key := range v.AllKeys() {
+		path := strings.Split(key, ".")
+		for i := 1; i <= len(path); i++ {
+			top := strings.Join(path[:i], ".")
+			if _, ok := settings[top]; ok {
+				break
+			}
+
+			if val := v.Get(top); val != nil {
+				settings[top] = val
+				break
+			}
+		}
+	}
+
+	return settings
+}
+
+// searchSettings find value of key in nested settings,
+// key itself may contains `.`, like `{"a": {"b.c": 1}}`
+func searchSettings(settings map[string]interface{}, path []string) (interface{}, bool) {
+	for i := len(path); i > 0; i-- {
+		val, ok := settings[strings.Join(path[:i], ".")]
+		if !ok {
+			continue
+		}
+
+		if i == len(path) {
+			return val, true
+		}
+
+		if sub, ok := val.(map[string]interface{}); ok {
+			if val, ok := searchSettings(sub, path[i:]); ok {
+				return val, true
+			}
+		}
+	}
+
+	return nil, false
+}
+
+// setGroup add group or replace the group with the same name,
+// then rebuild settings. must be called with lock held.
+//
+// deprecated keys in group are migrated, see `RegisterDeprecated`.
+// groups are not changed if rebuild failed.
+func (s *config) setGroup(layer Layer, group *layerGroup) error {
+	for i := range group.sources {
+		var found []string
+		group.sources[i], found = s.migrateSource(group.sources[i])
+		if s.strict && len(found) != 0 {
+			return errors.Errorf("deprecated keys in `%s`: %s",
+				group.sources[i].name, strings.Join(found, ", "))
+		}
+	}
+
+	// copy-on-write, the old slice is shared with snapshots
+	groups := s.groups
+	groups[layer] = append([]*layerGroup{}, s.groups[layer]...)
+	replaced := false
+	for i := range groups[layer] {
+		if groups[layer][i].name == group.name {
+			groups[layer][i] = group
+			replaced = true
+			break
+		}
+	}
+	if !replaced {
+		groups[layer] = append(groups[layer], group)
+	}
+
+	snap, err := s.buildSnapshot(groups)
+	if err != nil {
+		return err
+	}
+
+	s.groups = groups
+	s.publish(snap)
+	return nil
+}
+
+// rebuild create a new viper from all layers and publish a new snapshot.
+// must be called with lock held.
+func (s *config) rebuild() error {
+	snap, err := s.buildSnapshot(s.groups)
+	if err != nil {
+		return err
+	}
+
+	s.publish(snap)
+	return nil
+}
+
+// republish publish a new snapshot that shares viper with the latest one,
+// for changes not need to rebuild viper, like `Set` and `SetDefault`.
+// must be called with lock held.
+func (s *config) republish() {
+	snap := s.newSnapshot(s.groups)
+	snap.v = s.load().v
+	s.publish(snap)
+}
+
+// buildSnapshot create a new snapshot with a new viper built from groups.
+// must be called with lock held.
+func (s *config) buildSnapshot(groups [LayerOverride + 1][]*layerGroup) (*snapshot, error) {
+	snap := s.newSnapshot(groups)
+	v, err := snap.newViper()
+	if err != nil {
+		return nil, err
+	}
+
+	snap.v = v
+	return snap, nil
+}
+
+// newSnapshot create a snapshot without viper. must be called with lock held.
+func (s *config) newSnapshot(groups [LayerOverride + 1][]*layerGroup) *snapshot {
+	return &snapshot{
+		groups:           groups,
+		defaults:         s.defaults,
+		overrides:        s.overrides,
+		patched:          &s.patchedRead,
+		flagsets:         s.flagsets,
+		envPrefix:        s.envPrefix,
+		envEnabled:       s.envEnabled,
+		strict:           s.strict,
+		versioned:        len(s.migrations) != 0,
+		deprecated:       s.deprecated,
+		deprecatedWarned: &s.deprecatedWarned,
+	}
+}
+
+// publish publish snap as the latest snapshot. must be called with lock held.
+func (s *config) publish(snap *snapshot) {
+	if old, ok := s.snap.Load().(*snapshot); ok {
+		snap.rev = old.rev + 1
+	}
+
+	s.snap.Store(snap)
+}
+
+// newViper create a new viper from all layers,
+// except settings by `SetDefault` and `Set`, see `patch`.
+func (s *snapshot) newViper() (*viper.Viper, error) {
+	v := viper.New()
+	for _, group := range s.groups[LayerDefault] {
+		for _, src := range group.sources {
+			setDefaults(v, "", src.settings)
+		}
+	}
+
+	// files and remote are both stored in viper's config layer
+	for _, layer := range []Layer{LayerFile, LayerRemote} {
+		for _, group := range s.groups[layer] {
+			for _, src := range group.sources {
+				// viper keeps and modifies nested maps merged into it
+				if err := v.MergeConfigMap(copySettings(src.settings)); err != nil {
+					return nil, errors.Wrapf(err, "merge settings from `%s`", src.name)
+				}
+			}
+		}
+	}
+
+	if s.envEnabled {
+		v.SetEnvPrefix(s.envPrefix)
+		v.SetEnvKeyReplacer(envKeyReplacer)
+		v.AutomaticEnv()
+	}
+
+	for _, fs := range s.flagsets {
+		if err := v.BindPFlags(fs); err != nil {
+			return nil, errors.Wrap(err, "bind pflags")
+		}
+	}
+
+	return v, nil
+}
+
+// patch apply settings by `SetDefault` and `Set` to v
+func (s *snapshot) patch(v *viper.Viper) {
+	for _, kv := range s.defaults {
+		v.SetDefault(kv.key, kv.val)
+	}
+	for _, kv := range s.overrides {
+		v.Set(kv.key, kv.val)
+	}
+}
+
+// revision revision of settings, changed once settings changed
+func (s *config) revision() uint64 {
+	return s.load().rev
+}
+
+func (s *config) lookup(key string) (interface{}, bool) {
+	return s.load().lookup(key)
+}
+
+// setKeyValue add or replace kv in kvs, kvs is not modified.
+//
+// new key is appended, which only writes beyond the length of kvs
+// shared with snapshots, kvs is copied only if key already exists.
+func setKeyValue(kvs []keyValue, key string, val interface{}) []keyValue {
+	key = strings.ToLower(key)
+	for i := range kvs {
+		if kvs[i].key == key {
+			updated := make([]keyValue, 0, len(kvs))
+			updated = append(updated, kvs[:i]...)
+			updated = append(updated, kvs[i+1:]...)
+			return append(updated, keyValue{key: key, val: val})
+		}
+	}
+
+	return append(kvs, keyValue{key: key, val: val})
+}
+
+// patchedKey revisions since key patched by `SetDefault` and `Set`,
+// neverPatched means never patched
+type patchedKey struct {
+	// leaf key itself is patched
+	leaf uint64
+	// parent children of key are patched
+	parent uint64
+}
+
+const neverPatched = math.MaxUint64
+
+// patchKey mark key and its parents as patched since the next revision.
+// must be called with lock held, before publishing the next snapshot.
+//
+// patched keys are shared by all snapshots and only grow,
+// so keys already patched are never copied.
+func (s *config) patchKey(key string) {
+	if s.patched == nil {
+		s.patched = map[string]patchedKey{}
+	}
+
+	key = strings.ToLower(key)
+	rev := s.load().rev + 1
+	mark := func(key string, leaf bool) {
+		pk, ok := s.patched[key]
+		if !ok {
+			pk = patchedKey{leaf: neverPatched, parent: neverPatched}
+		}
+
+		switch {
+		case leaf && pk.leaf == neverPatched:
+			pk.leaf = rev
+		case !leaf && pk.parent == neverPatched:
+			pk.parent = rev
+		default:
+			return
+		}
+
+		s.patched[key] = pk
+		s.patchedRead.Store(key, pk)
+	}
+
+	mark(key, true)
+	for i := strings.LastIndex(key, "."); i > 0; i = strings.LastIndex(key[:i], ".") {
+		mark(key[:i], false)
+	}
+}
+
+// SetDefault set default value of key, has the lowest priority
+func (s *config) SetDefault(key string, val interface{}) {
+	defer s.notifyChanged()
+	s.Lock()
+	defer s.Unlock()
+
+	key = s.load().resolveKey(key)
+	s.defaults = setKeyValue(s.defaults, key, val)
+	s.patchKey(key)
+	s.republish()
+}
+
+// LoadFromEnv load settings from environment variables
+//
+// key `db.host` is read from env `{PREFIX}_DB_HOST`,
+// set prefix to empty to read from `DB_HOST`.
+func (s *config) LoadFromEnv(prefix string) error {
+	defer s.notifyChanged()
+	s.Lock()
+	defer s.Unlock()
+
+	s.envEnabled = true
+	s.envPrefix = prefix
+	return s.rebuild()
+}
+
+// envName env variable name of key, same as viper
+func (s *snapshot) envName(key string) string {
+	if s.envPrefix != "" {
+		key = s.envPrefix + "_" + key
+	}
+
+	return envKeyReplacer.Replace(strings.ToUpper(key))
+}
+
+// ReloadLayer read all sources in layer again
+//
+// only file and remote layers can be reloaded,
+// other layers are always up to date.
+func (s *config) ReloadLayer(layer Layer) error {
+	for _, group := range s.load().groups[layer] {
+		if group.reload == nil {
+			continue
+		}
+
+		sources, err := group.reload()
+		if err != nil {
+			return errors.Wrapf(err, "reload `%s`", group.name)
+		}
+
+		if err = s.setLayerGroup(layer, &layerGroup{
+			name:    group.name,
+			sources: sources,
+			reload:  group.reload,
+		}); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// setLayerGroup goroutine-safe version of setGroup
+func (s *config) setLayerGroup(layer Layer, group *layerGroup) error {
+	defer s.notifyChanged()
+	s.Lock()
+	defer s.Unlock()
+
+	return s.setGroup(layer, group)
+}
+
+// Explain report where the effective value of key comes from
+func (s *config) Explain(key string) (*Explanation, error) {
+	return s.load().Explain(key)
+}
+
+// Origin report the position in config file where the effective value of key is defined,
+// return false if key is not set by file.
+func (s *config) Origin(key string) (Position, bool) {
+	return s.load().Origin(key)
+}
+
+// Explain report where the effective value of key comes from
+func (s *snapshot) Explain(key string) (*Explanation, error) {
+	return s.explain(key)
+}
+
+// Origin report the position in config file where the effective value of key is defined,
+// return false if key is not set by file.
+func (s *snapshot) Origin(key string) (Position, bool) {
+	exp, err := s.explain(key)
+	if err != nil {
+		return Position{}, false
+	}
+
+	switch exp.Layer {
+	case LayerFile:
+	case LayerDefault:
+		// only defaults loaded by `LoadDefaultsFromFile`
+		if !s.hasSource(LayerDefault, exp.Source) {
+			return Position{}, false
+		}
+	default:
+		return Position{}, false
+	}
+
+	return Position{File: exp.Source, Line: exp.Line, Column: exp.Column}, true
+}
+
+// hasSource whether layer contains source named name
+func (s *snapshot) hasSource(layer Layer, name string) bool {
+	for _, group := range s.groups[layer] {
+		for _, src := range group.sources {
+			if src.name == name {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// explainGroups find the source of key in groups of layer, in descending priority
+func (s *snapshot) explainGroups(exp *Explanation, layer Layer, path []string) bool {
+	lkey := strings.Join(path, ".")
+	groups := s.groups[layer]
+	for i := len(groups) - 1; i >= 0; i-- {
+		sources := groups[i].sources
+		for j := len(sources) - 1; j >= 0; j-- {
+			if _, ok := searchSettings(sources[j].settings, path); ok {
+				exp.Layer, exp.Source = layer, sources[j].name
+				if pos, ok := sources[j].positions[lkey]; ok {
+					exp.Line, exp.Column = pos.Line, pos.Column
+				}
+
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// setDefaults set all leaves in nested settings as defaults of v,
+// so defaults from different sources are deep merged
+func setDefaults(v *viper.Viper, prefix string, settings map[string]interface{}) {
+	for k, val := range settings {
+		key := k
+		if prefix != "" {
+			key = prefix + "." + k
+		}
+
+		if sub, ok := val.(map[string]interface{}); ok && len(sub) != 0 {
+			setDefaults(v, key, sub)
+			continue
+		}
+
+		v.SetDefault(key, val)
+	}
+}
+
+func (s *snapshot) explain(key string) (*Explanation, error) {
+	key = s.resolveKey(key)
+	lkey := strings.ToLower(key)
+	path := strings.Split(lkey, ".")
+	exp := &Explanation{Key: key, Value: s.viperOf(key).Get(key)}
+
+	for i := len(s.overrides) - 1; i >= 0; i-- {
+		if s.overrides[i].key == lkey {
+			exp.Layer, exp.Source = LayerOverride, "Set"
+			return exp, nil
+		}
+	}
+
+	for _, fs := range s.flagsets {
+		if flag := fs.Lookup(lkey); flag != nil && flag.Changed {
+			exp.Layer, exp.Source = LayerFlag, "--"+flag.Name
+			return exp, nil
+		}
+	}
+
+	if s.envEnabled {
+		name := s.envName(lkey)
+		if _, ok := os.LookupEnv(name); ok {
+			exp.Layer, exp.Source = LayerEnv, name
+			return exp, nil
+		}
+	}
+
+	for _, layer := range []Layer{LayerRemote, LayerFile} {
+		if s.explainGroups(exp, layer, path) {
+			return exp, nil
+		}
+	}
+
+	for i := len(s.defaults) - 1; i >= 0; i-- {
+		if s.defaults[i].key == lkey {
+			exp.Layer, exp.Source = LayerDefault, "SetDefault"
+			return exp, nil
+		}
+	}
+
+	if s.explainGroups(exp, LayerDefault, path) {
+		return exp, nil
+	}
+
+	for _, fs := range s.flagsets {
+		if flag := fs.Lookup(lkey); flag != nil {
+			exp.Layer, exp.Source = LayerDefault, "--"+flag.Name
+			return exp, nil
+		}
+	}
+
+	return nil, errors.Wrapf(ErrKeyNotFound, "key `%s`", key)
+}
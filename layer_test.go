@@ -0,0 +1,179 @@
+package config
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/spf13/pflag"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLayer_String(t *testing.T) {
+	require.Equal(t, "default", LayerDefault.String())
+	require.Equal(t, "file", LayerFile.String())
+	require.Equal(t, "remote", LayerRemote.String())
+	require.Equal(t, "env", LayerEnv.String())
+	require.Equal(t, "flag", LayerFlag.String())
+	require.Equal(t, "override", LayerOverride.String())
+	require.Equal(t, "Layer(100)", Layer(100).String())
+}
+
+func TestViperSettings(t *testing.T) {
+	settings, err := parseSettings("yaml", "settings.yml", strings.NewReader(`
+A:
+  b.c: 1
+  d:
+    e: 2
+f: 3
+`))
+	require.NoError(t, err)
+	require.Equal(t, map[string]interface{}{
+		"a": map[string]interface{}{
+			"b.c": 1,
+			"d":   map[string]interface{}{"e": 2},
+		},
+		"f": 3,
+	}, settings)
+
+	v, ok := searchSettings(settings, []string{"a", "b", "c"})
+	require.True(t, ok)
+	require.Equal(t, 1, v)
+	v, ok = searchSettings(settings, []string{"a", "d", "e"})
+	require.True(t, ok)
+	require.Equal(t, 2, v)
+	_, ok = searchSettings(settings, []string{"a", "x"})
+	require.False(t, ok)
+}
+
+func TestConfig_layers(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	dir := t.TempDir()
+	entry := filepath.Join(dir, "settings.yml")
+	include := filepath.Join(dir, "include.yml")
+	require.NoError(t, os.WriteFile(entry, []byte(strings.Join([]string{
+		"include: include.yml",
+		"file: entry",
+		"remote: file",
+		"env: file",
+		"flag: file",
+		"override: file",
+		"removed: yes",
+	}, "\n")), 0644))
+	require.NoError(t, os.WriteFile(include, []byte(strings.Join([]string{
+		"file: include",
+		"included: include",
+	}, "\n")), 0644))
+
+	cfg := New()
+	cfg.SetDefault("default", "default")
+	cfg.SetDefault("file", "default")
+	require.NoError(t, cfg.LoadFromFile(entry))
+
+	provider := &fakeRemoteProvider{kvs: map[string]interface{}{
+		"remote": "remote",
+		"env":    "remote",
+	}}
+	require.NoError(t, cfg.LoadFromRemote(ctx, provider))
+
+	t.Setenv("LAYERTEST_ENV", "env")
+	t.Setenv("LAYERTEST_FLAG", "env")
+	require.NoError(t, cfg.LoadFromEnv("layertest"))
+
+	fs := pflag.NewFlagSet("test", pflag.ContinueOnError)
+	fs.String("flag", "flag-default", "")
+	fs.String("override", "flag-default", "")
+	fs.String("flagonly", "flag-default", "")
+	require.NoError(t, fs.Parse([]string{"--flag=flag", "--override=flag"}))
+	require.NoError(t, cfg.BindPFlags(fs))
+
+	cfg.Set("override", "override")
+
+	for key, expect := range map[string]Explanation{
+		"default":  {Value: "default", Layer: LayerDefault, Source: "SetDefault"},
+		"file":     {Value: "entry", Layer: LayerFile, Source: entry, Line: 2, Column: 1},
+		"included": {Value: "include", Layer: LayerFile, Source: include, Line: 2, Column: 1},
+		"remote":   {Value: "remote", Layer: LayerRemote, Source: "*config.fakeRemoteProvider#1"},
+		"env":      {Value: "env", Layer: LayerEnv, Source: "LAYERTEST_ENV"},
+		"flag":     {Value: "flag", Layer: LayerFlag, Source: "--flag"},
+		"override": {Value: "override", Layer: LayerOverride, Source: "Set"},
+		"flagonly": {Value: "flag-default", Layer: LayerDefault, Source: "--flagonly"},
+	} {
+		exp, err := cfg.Explain(key)
+		require.NoError(t, err, key)
+		expect.Key = key
+		require.Equal(t, expect, *exp, key)
+		require.Equal(t, expect.Value, cfg.Get(key), key)
+	}
+
+	_, err := cfg.Explain("notexists")
+	require.ErrorIs(t, err, ErrKeyNotFound)
+
+	t.Run("reload file layer", func(t *testing.T) {
+		require.NoError(t, os.WriteFile(entry, []byte(strings.Join([]string{
+			"file: reloaded",
+			"remote: file",
+		}, "\n")), 0644))
+
+		require.NoError(t, cfg.ReloadLayer(LayerFile))
+		require.Equal(t, "reloaded", cfg.GetString("file"))
+		require.False(t, cfg.IsSet("removed"))
+		require.False(t, cfg.IsSet("included"))
+
+		// other layers are not affected
+		require.Equal(t, "remote", cfg.GetString("remote"))
+		require.Equal(t, "override", cfg.GetString("override"))
+		require.Equal(t, "flag", cfg.GetString("flag"))
+	})
+
+	t.Run("reload remote layer", func(t *testing.T) {
+		provider.kvs = map[string]interface{}{"remote": "reloaded"}
+		require.NoError(t, cfg.ReloadLayer(LayerRemote))
+		require.Equal(t, "reloaded", cfg.GetString("remote"))
+		require.Equal(t, "reloaded", cfg.GetString("file"))
+
+		exp, err := cfg.Explain("env")
+		require.NoError(t, err)
+		require.Equal(t, LayerEnv, exp.Layer)
+	})
+
+	t.Run("read and merge config", func(t *testing.T) {
+		cfg := New()
+		require.NoError(t, cfg.LoadFromFile(entry))
+		require.NoError(t, cfg.MergeConfig(strings.NewReader("merged: 1"), "yaml"))
+		require.Equal(t, "reloaded", cfg.GetString("file"))
+		require.Equal(t, 1, cfg.GetInt("merged"))
+
+		require.NoError(t, cfg.ReadConfig(strings.NewReader("read: 1"), ""))
+		require.False(t, cfg.IsSet("file"))
+		require.False(t, cfg.IsSet("merged"))
+		require.Equal(t, 1, cfg.GetInt("read"))
+
+		exp, err := cfg.Explain("read")
+		require.NoError(t, err)
+		require.Equal(t, LayerFile, exp.Layer)
+		require.Equal(t, readerSourceName, exp.Source)
+	})
+}
+
+func TestConfig_rebuildKeepsSources(t *testing.T) {
+	dir := t.TempDir()
+	base, extra := filepath.Join(dir, "base.yml"), filepath.Join(dir, "extra.yml")
+	require.NoError(t, os.WriteFile(base, []byte("db: {host: localhost}\n"), 0644))
+	require.NoError(t, os.WriteFile(extra, []byte("db: {port: 3306}\n"), 0644))
+
+	cfg := New()
+	require.NoError(t, cfg.LoadFromFile(base))
+	require.NoError(t, cfg.LoadFromFile(extra))
+	require.Equal(t, 3306, cfg.GetInt("db.port"))
+
+	// keys of extra should not leak into base
+	require.NoError(t, os.WriteFile(extra, []byte("db: {user: root}\n"), 0644))
+	require.NoError(t, cfg.ReloadLayer(LayerFile))
+	require.False(t, cfg.IsSet("db.port"))
+	require.Equal(t, "localhost", cfg.GetString("db.host"))
+}
@@ -0,0 +1,239 @@
+package config
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v3"
+)
+
+// settingsResetTag yaml tag to delete key defined in included files,
+// like `brokers: !reset`
+const settingsResetTag = "!reset"
+
+type mergeKind int
+
+const (
+	mergeReplace mergeKind = iota
+	mergeAppend
+	mergePrepend
+	mergeUnion
+)
+
+// MergeStrategy how to merge list defined in both a file and the file it includes
+type MergeStrategy struct {
+	kind mergeKind
+	// field union items by this field, for `MergeUnionBy`
+	field string
+}
+
+var (
+	// MergeReplace list in the including file replaces the included one, the default
+	MergeReplace = MergeStrategy{kind: mergeReplace}
+	// MergeAppend list in the including file is appended to the included one
+	MergeAppend = MergeStrategy{kind: mergeAppend}
+	// MergePrepend list in the including file is prepended to the included one
+	MergePrepend = MergeStrategy{kind: mergePrepend}
+)
+
+// MergeUnionBy union lists of maps by field,
+// item in the including file replaces the included item with the same field,
+// other items are appended.
+func MergeUnionBy(field string) MergeStrategy {
+	return MergeStrategy{kind: mergeUnion, field: strings.ToLower(field)}
+}
+
+// WithMergeStrategy set how to merge list of key between a file and its includes,
+// default is `MergeReplace`.
+//
+//	cfg.LoadFromFile("settings.yml", config.WithMergeStrategy("kafka.brokers", config.MergeAppend))
+func WithMergeStrategy(key string, strategy MergeStrategy) Option {
+	return func(opt *option) error {
+		key = strings.ToLower(strings.Trim(key, "."))
+		if key == "" {
+			return errors.New("merge strategy key is empty")
+		}
+		if strategy.kind == mergeUnion && strategy.field == "" {
+			return errors.Errorf("union field of key `%s` is empty", key)
+		}
+
+		if opt.mergeStrategies == nil {
+			opt.mergeStrategies = map[string]MergeStrategy{}
+		}
+
+		opt.mergeStrategies[key] = strategy
+		return nil
+	}
+}
+
+// merge combine lower and upper list
+func (m MergeStrategy) merge(lower, upper []interface{}) []interface{} {
+	merged := make([]interface{}, 0, len(lower)+len(upper))
+	switch m.kind {
+	case mergeAppend:
+		merged = append(append(merged, lower...), upper...)
+	case mergePrepend:
+		merged = append(append(merged, upper...), lower...)
+	case mergeUnion:
+		merged = append(merged, lower...)
+		for _, item := range upper {
+			id, ok := m.unionID(item)
+			replaced := false
+			for i := range merged {
+				if mid, mok := m.unionID(merged[i]); ok && mok && mid == id {
+					merged[i] = item
+					replaced = true
+					break
+				}
+			}
+
+			if !replaced {
+				merged = append(merged, item)
+			}
+		}
+	default:
+		merged = append(merged, upper...)
+	}
+
+	return merged
+}
+
+// unionID get union field of item
+func (m MergeStrategy) unionID(item interface{}) (string, bool) {
+	var (
+		val interface{}
+		ok  bool
+	)
+	switch item := item.(type) {
+	case map[string]interface{}:
+		val, ok = item[m.field]
+	case map[interface{}]interface{}:
+		val, ok = item[m.field]
+	}
+	if !ok {
+		return "", false
+	}
+
+	return fmt.Sprint(val), true
+}
+
+// mergeSources apply reset directives and merge strategies to sources
+// of a file and its includes, sources are in ascending priority.
+//
+// the combined list is put into the upper source, so merging sources
+// by replacing still get the right result.
+func mergeSources(opt *option, sources []layerSource) {
+	for i := range sources {
+		src := &sources[i]
+		for key, deleted := range src.resets {
+			path := strings.Split(key, ".")
+			for j := 0; j < i; j++ {
+				deleteSettings(sources[j].settings, path)
+				deletePositions(sources[j].positions, key)
+			}
+
+			if deleted {
+				deleteSettings(src.settings, path)
+				deletePositions(src.positions, key)
+			}
+		}
+
+		for key, strategy := range opt.mergeStrategies {
+			if strategy.kind == mergeReplace {
+				continue
+			}
+
+			path := strings.Split(key, ".")
+			upper, ok := lookupSettings(src.settings, path)
+			if !ok {
+				continue
+			}
+			upperList, ok := upper.([]interface{})
+			if !ok {
+				continue
+			}
+
+			// lower sources are already merged into the nearest one
+			for j := i - 1; j >= 0; j-- {
+				lower, ok := lookupSettings(sources[j].settings, path)
+				if !ok {
+					continue
+				}
+
+				if lowerList, ok := lower.([]interface{}); ok {
+					putSettings(src.settings, path, strategy.merge(lowerList, upperList))
+				}
+
+				break
+			}
+		}
+	}
+}
+
+// deletePositions delete positions of key and its children
+func deletePositions(positions keyPositions, key string) {
+	for k := range positions {
+		if k == key || strings.HasPrefix(k, key+".") {
+			delete(positions, k)
+		}
+	}
+}
+
+// parseResetKeys find keys to be deleted from included files,
+// keys set to null or tagged by `!reset`. only yaml, json and jsonc are supported.
+//
+// the value is true if key is deleted, false if key is reset
+// to the new value like `brokers: !reset [a, b]`.
+func parseResetKeys(cfgType string, cnt []byte) map[string]bool {
+	switch cfgType {
+	case "yaml", "yml", "json":
+	case "jsonc":
+		cnt = blankJSONC(cnt)
+	default:
+		return nil
+	}
+
+	// json is also valid yaml
+	doc := new(yaml.Node)
+	if err := yaml.Unmarshal(cnt, doc); err != nil {
+		return nil
+	}
+
+	var (
+		keys = map[string]bool{}
+		walk func(prefix string, node *yaml.Node)
+	)
+	walk = func(prefix string, node *yaml.Node) {
+		switch node.Kind {
+		case yaml.DocumentNode:
+			for _, child := range node.Content {
+				walk(prefix, child)
+			}
+		case yaml.MappingNode:
+			for i := 0; i+1 < len(node.Content); i += 2 {
+				keyNode, valNode := node.Content[i], node.Content[i+1]
+				if keyNode.Tag == "!!merge" {
+					continue
+				}
+
+				key := joinKey(prefix, keyNode.Value)
+				isNull := valNode.Kind == yaml.ScalarNode &&
+					(valNode.ShortTag() == "!!null" || valNode.Value == "")
+				switch {
+				case valNode.Tag == settingsResetTag:
+					keys[key] = isNull
+					continue
+				case isNull && valNode.Style == 0:
+					keys[key] = true
+					continue
+				}
+
+				walk(key, valNode)
+			}
+		}
+	}
+	walk("", doc)
+
+	return keys
+}
@@ -0,0 +1,125 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestMergeStrategy_merge(t *testing.T) {
+	lower := []interface{}{"a", "b"}
+	upper := []interface{}{"c"}
+	require.Equal(t, []interface{}{"c"}, MergeReplace.merge(lower, upper))
+	require.Equal(t, []interface{}{"a", "b", "c"}, MergeAppend.merge(lower, upper))
+	require.Equal(t, []interface{}{"c", "a", "b"}, MergePrepend.merge(lower, upper))
+
+	lower = []interface{}{
+		map[string]interface{}{"name": "a", "port": 1},
+		map[string]interface{}{"name": "b", "port": 2},
+	}
+	upper = []interface{}{
+		map[string]interface{}{"name": "b", "port": 3},
+		map[string]interface{}{"name": "c", "port": 4},
+	}
+	require.Equal(t, []interface{}{
+		map[string]interface{}{"name": "a", "port": 1},
+		map[string]interface{}{"name": "b", "port": 3},
+		map[string]interface{}{"name": "c", "port": 4},
+	}, MergeUnionBy("Name").merge(lower, upper))
+}
+
+func TestWithMergeStrategy(t *testing.T) {
+	_, err := new(option).applyOptfs(WithMergeStrategy("", MergeAppend))
+	require.Error(t, err)
+	_, err = new(option).applyOptfs(WithMergeStrategy("a", MergeUnionBy("")))
+	require.Error(t, err)
+
+	opt, err := new(option).applyOptfs(WithMergeStrategy("Kafka.Brokers", MergeAppend))
+	require.NoError(t, err)
+	require.Equal(t, MergeAppend, opt.mergeStrategies["kafka.brokers"])
+}
+
+func TestParseResetKeys(t *testing.T) {
+	require.Equal(t, map[string]bool{
+		"a":   true,
+		"b.c": true,
+		"b.d": false,
+		"e":   true,
+	}, parseResetKeys("yaml", []byte(`
+a: ~
+b:
+  c: !reset
+  d: !reset [1, 2]
+e:
+f: ""
+`)))
+
+	require.Equal(t, map[string]bool{"a.b": true},
+		parseResetKeys("json", []byte(`{"a": {"b": null, "c": 1}}`)))
+	require.Nil(t, parseResetKeys("toml", []byte(`a = 1`)))
+}
+
+func TestLoadFromFile_merge(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"settings.yml": `include: base.yml
+kafka:
+  brokers: [c]
+  topics: [t2]
+servers:
+  - name: b
+    port: 3
+debug: ~
+db: !reset
+  host: remote
+`,
+		"base.yml": `include: common.yml
+kafka:
+  brokers: [b]
+  topics: [t1]
+servers:
+  - name: a
+    port: 1
+  - name: b
+    port: 2
+debug: true
+db:
+  host: localhost
+  port: 3306
+`,
+		"common.yml": `kafka:
+  brokers: [a]
+`,
+	}
+	for fname, cnt := range files {
+		require.NoError(t, os.WriteFile(filepath.Join(dir, fname), []byte(cnt), 0600))
+	}
+
+	cfg := New()
+	require.NoError(t, cfg.LoadFromFile(filepath.Join(dir, "settings.yml"),
+		WithMergeStrategy("kafka.brokers", MergeAppend),
+		WithMergeStrategy("kafka.topics", MergePrepend),
+		WithMergeStrategy("servers", MergeUnionBy("name")),
+	))
+
+	require.Equal(t, []string{"a", "b", "c"}, cfg.GetStringSlice("kafka.brokers"))
+	require.Equal(t, []string{"t2", "t1"}, cfg.GetStringSlice("kafka.topics"))
+
+	var servers []struct {
+		Name string
+		Port int
+	}
+	require.NoError(t, cfg.UnmarshalKey("servers", &servers))
+	require.Len(t, servers, 2)
+	require.Equal(t, "a", servers[0].Name)
+	require.Equal(t, 3, servers[1].Port)
+
+	require.False(t, cfg.IsSet("debug"))
+	require.Equal(t, "remote", cfg.GetString("db.host"))
+	require.False(t, cfg.IsSet("db.port"))
+
+	_, ok := cfg.Origin("db.port")
+	require.False(t, ok)
+}
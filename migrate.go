@@ -0,0 +1,298 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/Laisky/go-utils/v2/encrypt"
+	"github.com/Laisky/go-utils/v2/log"
+	"github.com/Laisky/zap"
+	"github.com/pelletier/go-toml"
+	"github.com/pkg/errors"
+	"github.com/spf13/cast"
+	"github.com/spf13/pflag"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	// settingsVersionKey key of settings schema version
+	settingsVersionKey = "version"
+	// defaultSettingsVersion version of file without `version` key
+	defaultSettingsVersion = 1
+)
+
+// Migration migrate settings from one version to the next version,
+// settings is a copy and can be modified in place.
+// dotted top-level keys in returned settings are nested, like `db.host`.
+type Migration func(settings map[string]interface{}) (map[string]interface{}, error)
+
+// RegisterMigration register migration from version `from` to `from+1`
+//
+// files loaded by `LoadFromFile` are migrated in sequence to the latest version
+// before merging, file without `version` key is treated as version 1.
+// latest version is the max registered `from` plus 1.
+// `version` must be an integer once any migration is registered,
+// otherwise it is an ordinary setting.
+func (s *config) RegisterMigration(from int, migration Migration) error {
+	if from < defaultSettingsVersion {
+		return errors.Errorf("invalid version %d", from)
+	}
+	if migration == nil {
+		return errors.New("migration is nil")
+	}
+
+	s.Lock()
+	defer s.Unlock()
+
+	if s.migrations == nil {
+		s.migrations = map[int]Migration{}
+	}
+	if _, ok := s.migrations[from]; ok {
+		return errors.Errorf("migration from version %d already registered", from)
+	}
+
+	s.migrations[from] = migration
+	s.republish()
+	return nil
+}
+
+// latestVersion latest settings version, 0 means no migration registered.
+// must be called with lock held.
+func (s *config) latestVersion() int {
+	latest := 0
+	for from := range s.migrations {
+		if from+1 > latest {
+			latest = from + 1
+		}
+	}
+
+	return latest
+}
+
+// migrateSettings migrate settings to the latest version,
+// return the original version and the migrated version.
+func (s *config) migrateSettings(settings map[string]interface{}) (
+	migrated map[string]interface{}, from, to int, err error) {
+	s.RLock()
+	latest := s.latestVersion()
+	migrations := make(map[int]Migration, len(s.migrations))
+	for v, m := range s.migrations {
+		migrations[v] = m
+	}
+	s.RUnlock()
+
+	from = defaultSettingsVersion
+	if latest == 0 {
+		// `version` is an ordinary setting if no migration registered
+		return settings, from, from, nil
+	}
+
+	if raw, ok := settings[settingsVersionKey]; ok {
+		if from, err = cast.ToIntE(raw); err != nil {
+			return nil, 0, 0, errors.Wrapf(err, "invalid `%s`", settingsVersionKey)
+		}
+	}
+	if from == latest {
+		return settings, from, from, nil
+	}
+	if from > latest {
+		return nil, 0, 0, errors.Errorf("unsupported version %d, latest is %d", from, latest)
+	}
+
+	migrated = copySettings(settings)
+	for v := from; v < latest; v++ {
+		migration, ok := migrations[v]
+		if !ok {
+			return nil, 0, 0, errors.Errorf("migration from version %d not registered", v)
+		}
+
+		if migrated, err = migration(migrated); err != nil {
+			return nil, 0, 0, errors.Wrapf(err, "migrate from version %d to %d", v, v+1)
+		}
+
+		// migration may return settings with upper-cased or dotted keys,
+		// dotted top-level keys like `db.host` are nested
+		for k, val := range migrated {
+			if strings.Contains(k, ".") {
+				delete(migrated, k)
+				putSettings(migrated, strings.Split(k, "."), val)
+			}
+		}
+		if migrated, err = normalizeSettings(migrated); err != nil {
+			return nil, 0, 0, errors.Wrapf(err, "migrate from version %d to %d", v, v+1)
+		}
+	}
+
+	migrated[settingsVersionKey] = latest
+	return migrated, from, latest, nil
+}
+
+// migrateFileSource migrate settings of file to the latest version
+func (s *config) migrateFileSource(src layerSource) (layerSource, error) {
+	settings, from, to, err := s.migrateSettings(src.settings)
+	if err != nil {
+		return layerSource{}, errors.Wrapf(err, "migrate file `%s`", src.name)
+	}
+
+	if to != from {
+		log.Shared.Info("migrate settings file",
+			zap.String("file", src.name),
+			zap.Int("from", from),
+			zap.Int("to", to))
+	}
+
+	src.settings = settings
+	return src, nil
+}
+
+// encodeSettings serialize settings in format cfgType
+func encodeSettings(cfgType string, settings map[string]interface{}) ([]byte, error) {
+	switch cfgType {
+	case "yaml", "yml":
+		return yaml.Marshal(settings)
+	case "json", "jsonc":
+		cnt, err := json.MarshalIndent(settings, "", "  ")
+		if err != nil {
+			return nil, err
+		}
+
+		return append(cnt, '\n'), nil
+	case "toml":
+		tree, err := toml.TreeFromMap(settings)
+		if err != nil {
+			return nil, err
+		}
+
+		return []byte(tree.String()), nil
+	default:
+		return nil, errors.Errorf("unsupported config type `%s`", cfgType)
+	}
+}
+
+// migrateFile migrate file to the latest version,
+// return new content of file. comments in file are not preserved.
+func (s *config) migrateFile(opt *option, fpath string) (cnt []byte, from, to int, err error) {
+	src, err := readConfigFile(opt, fpath)
+	if err != nil {
+		return nil, 0, 0, err
+	}
+
+	settings, from, to, err := s.migrateSettings(src.settings)
+	if err != nil {
+		return nil, 0, 0, errors.Wrapf(err, "migrate file `%s`", fpath)
+	}
+
+	if to == from {
+		return nil, from, to, nil
+	}
+
+	if cnt, err = encodeSettings(src.format, settings); err != nil {
+		return nil, 0, 0, errors.Wrapf(err, "encode file `%s`", fpath)
+	}
+
+	if isSettingsFileEncrypted(opt, fpath) {
+		if cnt, err = encrypt.EncryptByAes(opt.aesKey, cnt); err != nil {
+			return nil, 0, 0, errors.Wrapf(err, "encrypt file `%s`", fpath)
+		}
+	}
+
+	return cnt, from, to, nil
+}
+
+// MigrateFile rewrite file to the latest version, do nothing if already latest.
+//
+// only yaml, json and toml are supported, comments in file are not preserved.
+// encrypted file is encrypted again by `WithAesEncrypt`.
+func (s *config) MigrateFile(fpath string, opts ...Option) (from, to int, err error) {
+	opt, err := new(option).fillDefault().applyOptfs(opts...)
+	if err != nil {
+		return 0, 0, errors.Wrap(err, "apply options")
+	}
+	if opt.fsys != nil {
+		return 0, 0, errors.New("can not write files in fs")
+	}
+
+	cnt, from, to, err := s.migrateFile(opt, fpath)
+	if err != nil || cnt == nil {
+		return from, to, err
+	}
+
+	fi, err := os.Stat(fpath)
+	if err != nil {
+		return 0, 0, errors.Wrapf(err, "stat file `%s`", fpath)
+	}
+
+	if err = writeFileAtomic(fpath, cnt, fi.Mode().Perm()); err != nil {
+		return 0, 0, err
+	}
+
+	return from, to, nil
+}
+
+// RunMigrateCommand run subcommand to migrate files to the latest version
+//
+//	migrate [--dry-run] FILE...
+//
+// args are arguments after the subcommand name, like `os.Args[2:]`.
+// progress is written to out, like `os.Stdout`. with `--dry-run`,
+// migrated content is written to out instead of written to file.
+//
+// Example
+//
+//	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+//		if err := cfg.RunMigrateCommand(os.Stdout, os.Args[2:]); err != nil {
+//			log.Fatal(err)
+//		}
+//		return
+//	}
+func (s *config) RunMigrateCommand(out io.Writer, args []string, opts ...Option) error {
+	fs := pflag.NewFlagSet("migrate", pflag.ContinueOnError)
+	dryRun := fs.Bool("dry-run", false, "print migrated content instead of writing to file")
+	if err := fs.Parse(args); err != nil {
+		return errors.Wrap(err, "parse args")
+	}
+
+	files := fs.Args()
+	if len(files) == 0 {
+		return errors.New("usage: migrate [--dry-run] FILE...")
+	}
+
+	opt, err := new(option).fillDefault().applyOptfs(opts...)
+	if err != nil {
+		return errors.Wrap(err, "apply options")
+	}
+
+	for _, fpath := range files {
+		if !*dryRun {
+			from, to, err := s.MigrateFile(fpath, opts...)
+			if err != nil {
+				return err
+			}
+
+			if _, err = fmt.Fprintf(out, "%s: version %d -> %d\n", fpath, from, to); err != nil {
+				return errors.Wrap(err, "write output")
+			}
+			continue
+		}
+
+		cnt, from, to, err := s.migrateFile(opt, fpath)
+		if err != nil {
+			return err
+		}
+
+		if _, err = fmt.Fprintf(out, "# %s: version %d -> %d\n", fpath, from, to); err != nil {
+			return errors.Wrap(err, "write output")
+		}
+		if cnt != nil && !isSettingsFileEncrypted(opt, fpath) {
+			if _, err = fmt.Fprintf(out, "%s\n", bytes.TrimRight(cnt, "\n")); err != nil {
+				return errors.Wrap(err, "write output")
+			}
+		}
+	}
+
+	return nil
+}
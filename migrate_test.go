@@ -0,0 +1,201 @@
+package config
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	gutils "github.com/Laisky/go-utils/v2"
+	"github.com/Laisky/go-utils/v2/encrypt"
+	"github.com/stretchr/testify/require"
+)
+
+func newMigratedConfig(t *testing.T) Config {
+	cfg := New()
+	// v1 -> v2: rename `addr` to `db.host`
+	require.NoError(t, cfg.RegisterMigration(1, func(settings map[string]interface{}) (map[string]interface{}, error) {
+		if addr, ok := settings["addr"]; ok {
+			delete(settings, "addr")
+			settings["db.host"] = addr
+		}
+
+		return settings, nil
+	}))
+	// v2 -> v3: `db.port` becomes string
+	require.NoError(t, cfg.RegisterMigration(2, func(settings map[string]interface{}) (map[string]interface{}, error) {
+		if db, ok := settings["db"].(map[string]interface{}); ok {
+			db["Port"] = "3306"
+		}
+
+		return settings, nil
+	}))
+
+	return cfg
+}
+
+func TestConfig_RegisterMigration(t *testing.T) {
+	dir := t.TempDir()
+
+	t.Run("migrate on load", func(t *testing.T) {
+		fpath := filepath.Join(dir, "v1.yml")
+		require.NoError(t, os.WriteFile(fpath, []byte("addr: localhost\nname: app\n"), 0644))
+
+		cfg := newMigratedConfig(t)
+		require.NoError(t, cfg.LoadFromFile(fpath))
+		require.Equal(t, "localhost", cfg.GetString("db.host"))
+		require.Equal(t, "3306", cfg.GetString("db.port"))
+		require.Equal(t, "app", cfg.GetString("name"))
+		require.Equal(t, 3, cfg.GetInt("version"))
+		require.False(t, cfg.IsSet("addr"))
+
+		// file is not modified
+		cnt, err := os.ReadFile(fpath)
+		require.NoError(t, err)
+		require.Equal(t, "addr: localhost\nname: app\n", string(cnt))
+
+		var st struct {
+			Name string `mapstructure:"name"`
+			DB   struct {
+				Host string `mapstructure:"host"`
+				Port string `mapstructure:"port"`
+			} `mapstructure:"db"`
+		}
+		require.NoError(t, cfg.UnmarshalStrict(&st))
+	})
+
+	t.Run("start from version", func(t *testing.T) {
+		fpath := filepath.Join(dir, "v2.yml")
+		require.NoError(t, os.WriteFile(fpath, []byte(gutils.Dedent(`
+			version: 2
+			addr: kept
+			db:
+			  host: localhost
+		`)), 0644))
+
+		cfg := newMigratedConfig(t)
+		require.NoError(t, cfg.LoadFromFile(fpath))
+		require.Equal(t, "kept", cfg.GetString("addr"))
+		require.Equal(t, "3306", cfg.GetString("db.port"))
+	})
+
+	t.Run("unsupported version", func(t *testing.T) {
+		fpath := filepath.Join(dir, "v9.yml")
+		require.NoError(t, os.WriteFile(fpath, []byte("version: 9\n"), 0644))
+
+		err := newMigratedConfig(t).LoadFromFile(fpath)
+		require.ErrorContains(t, err, "unsupported version 9, latest is 3")
+	})
+
+	t.Run("missing migration", func(t *testing.T) {
+		fpath := filepath.Join(dir, "v1-missing.yml")
+		require.NoError(t, os.WriteFile(fpath, []byte("name: app\n"), 0644))
+
+		cfg := New()
+		require.NoError(t, cfg.RegisterMigration(2, func(settings map[string]interface{}) (map[string]interface{}, error) {
+			return settings, nil
+		}))
+		require.ErrorContains(t, cfg.LoadFromFile(fpath), "migration from version 1 not registered")
+	})
+
+	t.Run("non-integer version without migrations", func(t *testing.T) {
+		fpath := filepath.Join(dir, "app-version.yml")
+		require.NoError(t, os.WriteFile(fpath, []byte("version: 1.2.3\nname: app\n"), 0644))
+
+		cfg := New()
+		require.NoError(t, cfg.LoadFromFile(fpath))
+		require.Equal(t, "1.2.3", cfg.GetString("version"))
+		require.Equal(t, "app", cfg.GetString("name"))
+
+		require.ErrorContains(t, newMigratedConfig(t).LoadFromFile(fpath), "invalid `version`")
+	})
+
+	t.Run("invalid", func(t *testing.T) {
+		cfg := newMigratedConfig(t)
+		require.Error(t, cfg.RegisterMigration(0, func(settings map[string]interface{}) (map[string]interface{}, error) {
+			return settings, nil
+		}))
+		require.Error(t, cfg.RegisterMigration(1, func(settings map[string]interface{}) (map[string]interface{}, error) {
+			return settings, nil
+		}))
+		require.Error(t, cfg.RegisterMigration(3, nil))
+	})
+}
+
+func TestConfig_MigrateFile(t *testing.T) {
+	dir := t.TempDir()
+
+	for _, fname := range []string{"settings.yml", "settings.json", "settings.toml"} {
+		t.Run(fname, func(t *testing.T) {
+			fpath := filepath.Join(dir, fname)
+			cnt := map[string]string{
+				"settings.yml":  "addr: localhost\n",
+				"settings.json": `{"addr": "localhost"}`,
+				"settings.toml": `addr = "localhost"`,
+			}[fname]
+			require.NoError(t, os.WriteFile(fpath, []byte(cnt), 0600))
+
+			cfg := newMigratedConfig(t)
+			from, to, err := cfg.MigrateFile(fpath)
+			require.NoError(t, err)
+			require.Equal(t, 1, from)
+			require.Equal(t, 3, to)
+
+			fi, err := os.Stat(fpath)
+			require.NoError(t, err)
+			require.Equal(t, os.FileMode(0600), fi.Mode().Perm())
+
+			// load migrated file without migrations
+			loaded := New()
+			require.NoError(t, loaded.LoadFromFile(fpath))
+			require.Equal(t, "localhost", loaded.GetString("db.host"))
+			require.Equal(t, "3306", loaded.GetString("db.port"))
+			require.Equal(t, 3, loaded.GetInt("version"))
+
+			// already latest
+			from, to, err = cfg.MigrateFile(fpath)
+			require.NoError(t, err)
+			require.Equal(t, 3, from)
+			require.Equal(t, 3, to)
+		})
+	}
+
+	t.Run("encrypted", func(t *testing.T) {
+		fpath := filepath.Join(dir, "settings.yml.enc")
+		secret := []byte("secret")
+		encrypted, err := encrypt.EncryptByAes(secret, []byte("addr: localhost\n"))
+		require.NoError(t, err)
+		require.NoError(t, os.WriteFile(fpath, encrypted, 0600))
+
+		_, _, err = newMigratedConfig(t).MigrateFile(fpath, WithAesEncrypt(secret))
+		require.NoError(t, err)
+
+		loaded := New()
+		require.NoError(t, loaded.LoadFromFile(fpath, WithAesEncrypt(secret)))
+		require.Equal(t, "localhost", loaded.GetString("db.host"))
+	})
+}
+
+func TestConfig_RunMigrateCommand(t *testing.T) {
+	dir := t.TempDir()
+	fpath := filepath.Join(dir, "settings.yml")
+	require.NoError(t, os.WriteFile(fpath, []byte("addr: localhost\n"), 0644))
+
+	cfg := newMigratedConfig(t)
+	out := new(bytes.Buffer)
+	require.Error(t, cfg.RunMigrateCommand(out, nil))
+
+	require.NoError(t, cfg.RunMigrateCommand(out, []string{"--dry-run", fpath}))
+	require.Contains(t, out.String(), "# "+fpath+": version 1 -> 3\n")
+	require.Contains(t, out.String(), "host: localhost")
+	cnt, err := os.ReadFile(fpath)
+	require.NoError(t, err)
+	require.Equal(t, "addr: localhost\n", string(cnt))
+
+	out.Reset()
+	require.NoError(t, cfg.RunMigrateCommand(out, []string{fpath}))
+	require.Equal(t, fpath+": version 1 -> 3\n", out.String())
+	loaded := New()
+	require.NoError(t, loaded.LoadFromFile(fpath))
+	require.Equal(t, 3, loaded.GetInt("version"))
+}
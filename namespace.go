@@ -0,0 +1,206 @@
+package config
+
+import (
+	"strings"
+	"time"
+)
+
+// namespace view of settings under prefix
+type namespace struct {
+	cfg    Reader
+	prefix string
+}
+
+func newNamespace(cfg Reader, prefix string) *namespace {
+	return &namespace{cfg: cfg, prefix: strings.Trim(prefix, ".")}
+}
+
+// Namespace return a goroutine-safe read-only view of settings under prefix
+//
+// unlike `Sub`, settings are not copied, the view always reads from
+// the current settings, including after reloaded.
+//
+//	db := cfg.Namespace("db")
+//	db.GetString("host") // same as cfg.GetString("db.host")
+func (s *config) Namespace(prefix string) Reader {
+	return newNamespace(s, prefix)
+}
+
+// key full key in config
+func (n *namespace) key(key string) string {
+	if key == "" {
+		return n.prefix
+	}
+	if n.prefix == "" {
+		return key
+	}
+
+	return n.prefix + "." + key
+}
+
+// Namespace return view of settings under prefix in this namespace
+func (n *namespace) Namespace(prefix string) Reader {
+	return newNamespace(n.cfg, n.key(strings.Trim(prefix, ".")))
+}
+
+// Get get setting by key under prefix
+func (n *namespace) Get(key string) interface{} {
+	return n.cfg.Get(n.key(key))
+}
+
+// GetString get setting by key under prefix
+func (n *namespace) GetString(key string) string {
+	return n.cfg.GetString(n.key(key))
+}
+
+// GetStringSlice get setting by key under prefix
+func (n *namespace) GetStringSlice(key string) []string {
+	return n.cfg.GetStringSlice(n.key(key))
+}
+
+// GetBool get setting by key under prefix
+func (n *namespace) GetBool(key string) bool {
+	return n.cfg.GetBool(n.key(key))
+}
+
+// GetInt get setting by key under prefix
+func (n *namespace) GetInt(key string) int {
+	return n.cfg.GetInt(n.key(key))
+}
+
+// GetInt64 get setting by key under prefix
+func (n *namespace) GetInt64(key string) int64 {
+	return n.cfg.GetInt64(n.key(key))
+}
+
+// GetDuration get setting by key under prefix
+func (n *namespace) GetDuration(key string) time.Duration {
+	return n.cfg.GetDuration(n.key(key))
+}
+
+// GetFloat64 get setting by key under prefix
+func (n *namespace) GetFloat64(key string) float64 {
+	return n.cfg.GetFloat64(n.key(key))
+}
+
+// GetUint get setting by key under prefix
+func (n *namespace) GetUint(key string) uint {
+	return n.cfg.GetUint(n.key(key))
+}
+
+// GetUint32 get setting by key under prefix
+func (n *namespace) GetUint32(key string) uint32 {
+	return n.cfg.GetUint32(n.key(key))
+}
+
+// GetUint64 get setting by key under prefix
+func (n *namespace) GetUint64(key string) uint64 {
+	return n.cfg.GetUint64(n.key(key))
+}
+
+// GetTime get setting by key under prefix
+func (n *namespace) GetTime(key string) time.Time {
+	return n.cfg.GetTime(n.key(key))
+}
+
+// GetIntSlice get setting by key under prefix
+func (n *namespace) GetIntSlice(key string) []int {
+	return n.cfg.GetIntSlice(n.key(key))
+}
+
+// GetSizeInBytes get size setting by key under prefix, like `10mb` or `1 GB`
+func (n *namespace) GetSizeInBytes(key string) uint {
+	return n.cfg.GetSizeInBytes(n.key(key))
+}
+
+// GetStringMap return map contains interface under prefix
+func (n *namespace) GetStringMap(key string) map[string]interface{} {
+	return n.cfg.GetStringMap(n.key(key))
+}
+
+// GetStringMapString return map contains strings under prefix
+func (n *namespace) GetStringMapString(key string) map[string]string {
+	return n.cfg.GetStringMapString(n.key(key))
+}
+
+// AllKeys keys under prefix, prefix is trimmed
+func (n *namespace) AllKeys() []string {
+	if n.prefix == "" {
+		return n.cfg.AllKeys()
+	}
+
+	prefix := strings.ToLower(n.prefix) + "."
+	var keys []string
+	for _, key := range n.cfg.AllKeys() {
+		if strings.HasPrefix(key, prefix) {
+			keys = append(keys, strings.TrimPrefix(key, prefix))
+		}
+	}
+
+	return keys
+}
+
+// AllSettings settings under prefix as nested map
+func (n *namespace) AllSettings() map[string]interface{} {
+	if n.prefix == "" {
+		return n.cfg.AllSettings()
+	}
+
+	return n.cfg.GetStringMap(n.prefix)
+}
+
+// InConfig check whether key under prefix is set by file or remote settings
+func (n *namespace) InConfig(key string) bool {
+	return n.cfg.InConfig(n.key(key))
+}
+
+// IsSet check whether key under prefix exists
+func (n *namespace) IsSet(key string) bool {
+	return n.cfg.IsSet(n.key(key))
+}
+
+// Unmarshal unmarshal all settings under prefix into obj
+func (n *namespace) Unmarshal(obj interface{}) error {
+	if n.prefix == "" {
+		return n.cfg.Unmarshal(obj)
+	}
+
+	return n.cfg.UnmarshalKey(n.prefix, obj)
+}
+
+// UnmarshalKey unmarshals settings under key into obj
+func (n *namespace) UnmarshalKey(key string, obj interface{}) error {
+	return n.cfg.UnmarshalKey(n.key(key), obj)
+}
+
+// UnmarshalStrict unmarshal all settings under prefix into obj, see `Config.UnmarshalStrict`
+func (n *namespace) UnmarshalStrict(obj interface{}) error {
+	if n.prefix == "" {
+		return n.cfg.UnmarshalStrict(obj)
+	}
+
+	return n.cfg.UnmarshalKeyStrict(n.prefix, obj)
+}
+
+// UnmarshalKeyStrict like `UnmarshalKey`, but reject unknown keys
+func (n *namespace) UnmarshalKeyStrict(key string, obj interface{}) error {
+	return n.cfg.UnmarshalKeyStrict(n.key(key), obj)
+}
+
+// Explain report where the effective value of key under prefix comes from
+func (n *namespace) Explain(key string) (*Explanation, error) {
+	return n.cfg.Explain(n.key(key))
+}
+
+// Origin return position of key under prefix in settings file
+func (n *namespace) Origin(key string) (Position, bool) {
+	return n.cfg.Origin(n.key(key))
+}
+
+func (n *namespace) revision() uint64 {
+	return n.cfg.revision()
+}
+
+func (n *namespace) lookup(key string) (interface{}, bool) {
+	return n.cfg.lookup(n.key(key))
+}
@@ -0,0 +1,69 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	gutils "github.com/Laisky/go-utils/v2"
+	"github.com/stretchr/testify/require"
+)
+
+func TestConfig_Namespace(t *testing.T) {
+	fpath := filepath.Join(t.TempDir(), "settings.yml")
+	write := func(cnt string) {
+		require.NoError(t, os.WriteFile(fpath, []byte(gutils.Dedent(cnt)), 0644))
+	}
+	write(`
+		db:
+		  host: localhost
+		  port: 3306
+		  opts:
+		    timeout: 3s
+		name: app
+	`)
+
+	cfg := New()
+	require.NoError(t, cfg.LoadFromFile(fpath))
+
+	db := cfg.Namespace("db")
+	require.Equal(t, "localhost", db.GetString("host"))
+	require.Equal(t, 3306, db.GetInt("port"))
+	require.Equal(t, 3*time.Second, db.Namespace("opts").GetDuration("timeout"))
+	require.Equal(t, 3*time.Second, cfg.Namespace("db.").GetDuration("opts.timeout"))
+	require.ElementsMatch(t, []string{"host", "port", "opts.timeout"}, db.AllKeys())
+	require.Equal(t, "localhost", db.AllSettings()["host"])
+	require.False(t, db.IsSet("name"))
+
+	pos, ok := db.Origin("port")
+	require.True(t, ok)
+	require.Equal(t, 3, pos.Line)
+
+	var st struct {
+		Host string `mapstructure:"host"`
+		Port int    `mapstructure:"port"`
+	}
+	require.NoError(t, db.Unmarshal(&st))
+	require.Equal(t, 3306, st.Port)
+	require.ErrorContains(t, db.UnmarshalStrict(&st), "unknown keys: `db.opts`")
+
+	port := NewKey[int](db, "port")
+	require.Equal(t, 3306, port.GetOr(0))
+
+	t.Run("follow reload", func(t *testing.T) {
+		write(`
+			db:
+			  host: remote
+			  port: 3307
+		`)
+		require.NoError(t, cfg.ReloadLayer(LayerFile))
+
+		require.Equal(t, "remote", db.GetString("host"))
+		require.Equal(t, 3307, port.GetOr(0))
+		require.False(t, db.IsSet("opts.timeout"))
+
+		cfg.Set("db.host", "override")
+		require.Equal(t, "override", db.GetString("host"))
+	})
+}
@@ -0,0 +1,228 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/pelletier/go-toml"
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v3"
+)
+
+// Position location of key in config file
+type Position struct {
+	File string
+	// Line 1-based line number, 0 means unknown
+	Line int
+	// Column 1-based column number, 0 means unknown
+	Column int
+}
+
+// String format as `file:line:column`
+func (p Position) String() string {
+	if p.Line <= 0 {
+		return p.File
+	}
+
+	return fmt.Sprintf("%s:%d:%d", p.File, p.Line, p.Column)
+}
+
+// keyPositions positions of all keys in file, keys are lower-cased and joined by `.`
+type keyPositions map[string]Position
+
+// parsePositions find positions of all keys in config file,
+// only yaml, toml, json, jsonc and hcl2 are supported.
+func parsePositions(cfgType, fpath string, cnt []byte) keyPositions {
+	positions := keyPositions{}
+	var err error
+	switch cfgType {
+	case "yaml", "yml":
+		err = positions.walkYAML(fpath, cnt)
+	case "toml":
+		err = positions.walkTOML(fpath, cnt)
+	case "json":
+		err = positions.walkJSON(fpath, cnt)
+	case "jsonc":
+		err = positions.walkJSON(fpath, blankJSONC(cnt))
+	case "hcl2":
+		err = positions.walkHCL2(fpath, cnt)
+	case "cue":
+		err = positions.walkCUE(fpath, cnt)
+	}
+
+	if err != nil {
+		// content is already parsed by viper, positions are optional
+		return keyPositions{}
+	}
+
+	return positions
+}
+
+func joinKey(prefix, key string) string {
+	key = strings.ToLower(key)
+	if prefix == "" {
+		return key
+	}
+
+	return prefix + "." + key
+}
+
+func (ps keyPositions) walkYAML(fpath string, cnt []byte) error {
+	doc := new(yaml.Node)
+	if err := yaml.Unmarshal(cnt, doc); err != nil {
+		return errors.Wrap(err, "parse yaml")
+	}
+
+	var walk func(prefix string, node *yaml.Node)
+	walk = func(prefix string, node *yaml.Node) {
+		switch node.Kind {
+		case yaml.DocumentNode:
+			for _, child := range node.Content {
+				walk(prefix, child)
+			}
+		case yaml.AliasNode:
+			walk(prefix, node.Alias)
+		case yaml.MappingNode:
+			for i := 0; i+1 < len(node.Content); i += 2 {
+				keyNode, valNode := node.Content[i], node.Content[i+1]
+				if keyNode.Tag == "!!merge" {
+					// `<<: *anchor`, keys are defined by anchor
+					walk(prefix, valNode)
+					continue
+				}
+
+				key := joinKey(prefix, keyNode.Value)
+				ps[key] = Position{File: fpath, Line: keyNode.Line, Column: keyNode.Column}
+				walk(key, valNode)
+			}
+		}
+	}
+	walk("", doc)
+
+	return nil
+}
+
+func (ps keyPositions) walkTOML(fpath string, cnt []byte) error {
+	tree, err := toml.LoadBytes(cnt)
+	if err != nil {
+		return errors.Wrap(err, "parse toml")
+	}
+
+	var walk func(prefix string, tree *toml.Tree)
+	walk = func(prefix string, tree *toml.Tree) {
+		for _, k := range tree.Keys() {
+			pos := tree.GetPositionPath([]string{k})
+			key := joinKey(prefix, k)
+			ps[key] = Position{File: fpath, Line: pos.Line, Column: pos.Col}
+			if sub, ok := tree.GetPath([]string{k}).(*toml.Tree); ok {
+				walk(key, sub)
+			}
+		}
+	}
+	walk("", tree)
+
+	return nil
+}
+
+func (ps keyPositions) walkJSON(fpath string, cnt []byte) error {
+	// offset -> line & column
+	lineStarts := []int{0}
+	for i, c := range cnt {
+		if c == '\n' {
+			lineStarts = append(lineStarts, i+1)
+		}
+	}
+	position := func(offset int) Position {
+		line := sort.Search(len(lineStarts), func(i int) bool {
+			return lineStarts[i] > offset
+		})
+		return Position{File: fpath, Line: line, Column: offset - lineStarts[line-1] + 1}
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(cnt))
+	var walk func(prefix string) error
+	walk = func(prefix string) error {
+		tok, err := decoder.Token()
+		if err != nil {
+			return err
+		}
+
+		delim, ok := tok.(json.Delim)
+		if !ok {
+			return nil
+		}
+
+		switch delim {
+		case '{':
+			for decoder.More() {
+				// offset is at the end of the key token
+				keyTok, err := decoder.Token()
+				if err != nil {
+					return err
+				}
+				k, _ := keyTok.(string)
+				end := int(decoder.InputOffset())
+				start := bytes.LastIndexByte(cnt[:end-1], '"')
+
+				key := joinKey(prefix, k)
+				ps[key] = position(start)
+				if err = walk(key); err != nil {
+					return err
+				}
+			}
+		case '[':
+			for decoder.More() {
+				// keys in array can not be addressed
+				if err = walk(prefix + ".[]"); err != nil {
+					return err
+				}
+			}
+		}
+
+		// consume closing delim
+		_, err = decoder.Token()
+		return err
+	}
+
+	return walk("")
+}
+
+// errorKeyRegexp find keys quoted in mapstructure's errors, like `'db.port' expected type 'int'`
+var errorKeyRegexp = regexp.MustCompile(`'([^'\s]+)'`)
+
+// annotateError add positions of keys mentioned in err,
+// prefix is the key passed to `UnmarshalKey`.
+func (s *snapshot) annotateError(err error, prefix string) error {
+	if err == nil {
+		return nil
+	}
+
+	var (
+		locs []string
+		seen = map[string]bool{}
+	)
+	for _, match := range errorKeyRegexp.FindAllStringSubmatch(err.Error(), -1) {
+		key := strings.ToLower(match[1])
+		if prefix != "" {
+			key = joinKey(prefix, key)
+		}
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+
+		if pos, ok := s.Origin(key); ok {
+			locs = append(locs, fmt.Sprintf("`%s` defined at %s", key, pos))
+		}
+	}
+
+	if len(locs) == 0 {
+		return err
+	}
+
+	return errors.Wrap(err, strings.Join(locs, ", "))
+}
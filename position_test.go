@@ -0,0 +1,122 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	gutils "github.com/Laisky/go-utils/v2"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPosition_String(t *testing.T) {
+	require.Equal(t, "a.yml:1:2", Position{File: "a.yml", Line: 1, Column: 2}.String())
+	require.Equal(t, "a.yml", Position{File: "a.yml"}.String())
+}
+
+func TestParsePositions(t *testing.T) {
+	t.Run("yaml", func(t *testing.T) {
+		ps := parsePositions("yaml", "a.yml", []byte(gutils.Dedent(`
+			base: &base
+			  timeout: 3
+			DB:
+			  <<: *base
+			  host: localhost
+			  k.1: 1
+			list:
+			  - a: 1
+		`)))
+
+		require.Equal(t, Position{File: "a.yml", Line: 1, Column: 1}, ps["base"])
+		require.Equal(t, Position{File: "a.yml", Line: 2, Column: 3}, ps["base.timeout"])
+		require.Equal(t, Position{File: "a.yml", Line: 3, Column: 1}, ps["db"])
+		require.Equal(t, Position{File: "a.yml", Line: 5, Column: 3}, ps["db.host"])
+		require.Equal(t, Position{File: "a.yml", Line: 6, Column: 3}, ps["db.k.1"])
+		require.Equal(t, Position{File: "a.yml", Line: 2, Column: 3}, ps["db.timeout"])
+		require.Equal(t, Position{File: "a.yml", Line: 7, Column: 1}, ps["list"])
+	})
+
+	t.Run("toml", func(t *testing.T) {
+		ps := parsePositions("toml", "a.toml", []byte(gutils.Dedent(`
+			root = "root"
+
+			[DB]
+			host = "localhost"
+		`)))
+
+		require.Equal(t, Position{File: "a.toml", Line: 1, Column: 1}, ps["root"])
+		require.Equal(t, Position{File: "a.toml", Line: 3, Column: 1}, ps["db"])
+		require.Equal(t, Position{File: "a.toml", Line: 4, Column: 1}, ps["db.host"])
+	})
+
+	t.Run("json", func(t *testing.T) {
+		ps := parsePositions("json", "a.json", []byte(gutils.Dedent(`
+			{
+			  "root": "root",
+			  "list": [{"a": 1}, 2],
+			  "DB": {
+			    "host": "localhost"
+			  }
+			}
+		`)))
+
+		require.Equal(t, Position{File: "a.json", Line: 2, Column: 3}, ps["root"])
+		require.Equal(t, Position{File: "a.json", Line: 3, Column: 3}, ps["list"])
+		require.Equal(t, Position{File: "a.json", Line: 4, Column: 3}, ps["db"])
+		require.Equal(t, Position{File: "a.json", Line: 5, Column: 5}, ps["db.host"])
+	})
+
+	t.Run("unsupported or invalid", func(t *testing.T) {
+		require.Len(t, parsePositions("ini", "a.ini", []byte("a=1")), 0)
+		require.Len(t, parsePositions("yaml", "a.yml", []byte("a: [")), 0)
+	})
+}
+
+func TestConfig_Origin(t *testing.T) {
+	dir := t.TempDir()
+	entry := filepath.Join(dir, "settings.yml")
+	require.NoError(t, os.WriteFile(entry, []byte(gutils.Dedent(`
+		include: db.toml
+		name: app
+	`)), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "db.toml"), []byte(gutils.Dedent(`
+		[db]
+		port = "abc"
+	`)), 0644))
+
+	cfg := New()
+	require.NoError(t, cfg.LoadFromFile(entry))
+
+	pos, ok := cfg.Origin("name")
+	require.True(t, ok)
+	require.Equal(t, Position{File: entry, Line: 2, Column: 1}, pos)
+
+	pos, ok = cfg.Origin("db.port")
+	require.True(t, ok)
+	require.Equal(t, Position{File: filepath.Join(dir, "db.toml"), Line: 2, Column: 1}, pos)
+
+	cfg.Set("name", "override")
+	_, ok = cfg.Origin("name")
+	require.False(t, ok)
+	_, ok = cfg.Origin("notexists")
+	require.False(t, ok)
+
+	t.Run("unmarshal error", func(t *testing.T) {
+		var st struct {
+			DB struct {
+				Port int `mapstructure:"port"`
+			} `mapstructure:"db"`
+		}
+
+		err := cfg.Unmarshal(&st)
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "`db.port` defined at "+filepath.Join(dir, "db.toml")+":2:1")
+
+		var db struct {
+			Port int `mapstructure:"port"`
+		}
+		err = cfg.UnmarshalKey("db", &db)
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "`db.port` defined at "+filepath.Join(dir, "db.toml")+":2:1")
+	})
+}
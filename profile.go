@@ -0,0 +1,135 @@
+package config
+
+import (
+	"io/fs"
+	"path/filepath"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/cast"
+)
+
+// settingsProfileKey key of active profiles, used if `WithProfile` not set,
+// so profiles can be set by env or flag, like `APP_PROFILE=prod`.
+// it is an ordinary setting in files unless `WithProfileKey` enabled.
+const settingsProfileKey = "profile"
+
+// WithProfile merge profile files on top of the entry file for `LoadFromFile`
+//
+// `settings.yml` with profile `prod` merges `settings.prod.yml`,
+// then encrypted `settings.prod.yml.enc` if `WithAesEncrypt` enabled.
+// missing profile files are ignored.
+// multiple profiles are separated by `,`, the latter has higher priority.
+//
+// if not set, profiles are read from key `profile` set by env, flag or `Set`,
+// or from the key set by `WithProfileKey`.
+func WithProfile(profile string) Option {
+	return func(opt *option) error {
+		if strings.TrimSpace(profile) == "" {
+			return errors.New("profile is empty")
+		}
+
+		opt.profile = profile
+		return nil
+	}
+}
+
+// WithProfileKey read active profiles from key for `LoadFromFile`,
+// including the entry file, remote and defaults, like `profile: prod` in `settings.yml`.
+//
+// without this option, key `profile` is only read from env, flag and `Set`,
+// so existing files that use `profile` as an ordinary setting are not affected.
+func WithProfileKey(key string) Option {
+	return func(opt *option) error {
+		if strings.TrimSpace(key) == "" {
+			return errors.New("profile key is empty")
+		}
+
+		opt.profileKey = strings.ToLower(strings.TrimSpace(key))
+		return nil
+	}
+}
+
+// activeProfiles profiles set by `WithProfile` or profile key
+func (s *config) activeProfiles(opt *option, sources []layerSource) (profiles []string) {
+	profile := opt.profile
+	if profile == "" {
+		profile = s.profileSetting(opt, sources)
+	}
+
+	for _, p := range strings.Split(profile, ",") {
+		if p = strings.TrimSpace(p); p != "" {
+			profiles = append(profiles, p)
+		}
+	}
+
+	return profiles
+}
+
+// profileSetting value of profile key in the same priority as layers
+//
+// key `profile` is only read from env, flag and override layers by default.
+// key set by `WithProfileKey` is also read from remote, then sources of
+// the entry file being loaded, then defaults. file layer already loaded
+// is ignored, so first load and reload choose the same profiles.
+func (s *config) profileSetting(opt *option, sources []layerSource) string {
+	key := opt.profileKey
+	if key == "" {
+		key = settingsProfileKey
+	}
+
+	exp, err := s.load().explain(key)
+	if err == nil && exp.Layer >= LayerEnv {
+		return cast.ToString(exp.Value)
+	}
+	if opt.profileKey == "" {
+		return ""
+	}
+
+	if err == nil && exp.Layer > LayerFile {
+		return cast.ToString(exp.Value)
+	}
+
+	for i := len(sources) - 1; i >= 0; i-- {
+		if val, ok := lookupSettings(sources[i].settings, strings.Split(key, ".")); ok {
+			return cast.ToString(val)
+		}
+	}
+
+	if err == nil && exp.Layer == LayerDefault {
+		return cast.ToString(exp.Value)
+	}
+
+	return ""
+}
+
+// profileFiles existing files of profile for entryFile,
+// like `settings.prod.yml` and `settings.prod.yml.enc`
+func profileFiles(opt *option, entryFile, profile string) (files []string, err error) {
+	fpath := entryFile
+	if opt.encryptedSuffix != "" {
+		fpath = strings.TrimSuffix(fpath, opt.encryptedSuffix)
+	}
+
+	ext := filepath.Ext(fpath)
+	fpath = strings.TrimSuffix(fpath, ext) + "." + profile + ext
+
+	candidates := []string{fpath}
+	if opt.aesKey != nil && opt.encryptedSuffix != "" {
+		candidates = append(candidates, fpath+opt.encryptedSuffix)
+	}
+
+	for _, f := range candidates {
+		if _, err = opt.stat(f); err != nil {
+			if errors.Is(err, fs.ErrNotExist) {
+				continue
+			}
+
+			return nil, errors.Wrapf(err, "stat profile file `%s`", f)
+		}
+
+		files = append(files, f)
+	}
+
+	return files, nil
+}
@@ -0,0 +1,138 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/Laisky/go-utils/v2/encrypt"
+	"github.com/stretchr/testify/require"
+)
+
+func TestProfileFiles(t *testing.T) {
+	dir := t.TempDir()
+	for _, f := range []string{"settings.yml", "settings.prod.yml", "settings.prod.yml.enc"} {
+		require.NoError(t, os.WriteFile(filepath.Join(dir, f), nil, 0600))
+	}
+	entry := filepath.Join(dir, "settings.yml")
+
+	files, err := profileFiles(new(option).fillDefault(), entry, "prod")
+	require.NoError(t, err)
+	require.Equal(t, []string{filepath.Join(dir, "settings.prod.yml")}, files)
+
+	opt, err := new(option).fillDefault().applyOptfs(WithAesEncrypt([]byte("secret")))
+	require.NoError(t, err)
+	files, err = profileFiles(opt, entry+".enc", "prod")
+	require.NoError(t, err)
+	require.Equal(t, []string{
+		filepath.Join(dir, "settings.prod.yml"),
+		filepath.Join(dir, "settings.prod.yml.enc"),
+	}, files)
+
+	files, err = profileFiles(opt, entry, "dev")
+	require.NoError(t, err)
+	require.Empty(t, files)
+
+	_, err = new(option).applyOptfs(WithProfile(" "))
+	require.Error(t, err)
+}
+
+func TestLoadFromFile_profile(t *testing.T) {
+	secret := []byte("secret")
+	dir := t.TempDir()
+	entry := filepath.Join(dir, "settings.yml")
+	require.NoError(t, os.WriteFile(entry, []byte(`
+name: base
+db:
+  host: localhost
+  port: 3306
+  password: base
+`), 0600))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "settings.prod.yml"),
+		[]byte("db:\n  host: prod\n  password: plain\n"), 0600))
+	encrypted, err := encrypt.EncryptByAes(secret, []byte("db:\n  password: p@ss\n"))
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "settings.prod.yml.enc"), encrypted, 0600))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "settings.cloud.yml"),
+		[]byte("name: cloud\n"), 0600))
+
+	t.Run("option", func(t *testing.T) {
+		cfg := New()
+		require.NoError(t, cfg.LoadFromFile(entry, WithProfile("prod"), WithAesEncrypt(secret)))
+		require.Equal(t, "base", cfg.GetString("name"))
+		require.Equal(t, "prod", cfg.GetString("db.host"))
+		require.Equal(t, 3306, cfg.GetInt("db.port"))
+		require.Equal(t, "p@ss", cfg.GetString("db.password"))
+
+		pos, ok := cfg.Origin("db.host")
+		require.True(t, ok)
+		require.Equal(t, filepath.Join(dir, "settings.prod.yml"), pos.File)
+	})
+
+	t.Run("multiple profiles", func(t *testing.T) {
+		cfg := New()
+		require.NoError(t, cfg.LoadFromFile(entry, WithProfile("prod, cloud")))
+		require.Equal(t, "cloud", cfg.GetString("name"))
+		require.Equal(t, "plain", cfg.GetString("db.password"))
+	})
+
+	t.Run("missing profile", func(t *testing.T) {
+		cfg := New()
+		require.NoError(t, cfg.LoadFromFile(entry, WithProfile("dev")))
+		require.Equal(t, "localhost", cfg.GetString("db.host"))
+	})
+
+	t.Run("env", func(t *testing.T) {
+		t.Setenv("TESTPROFILE_PROFILE", "prod")
+		cfg := New()
+		require.NoError(t, cfg.LoadFromEnv("TESTPROFILE"))
+		require.NoError(t, cfg.LoadFromFile(entry))
+		require.Equal(t, "prod", cfg.GetString("db.host"))
+	})
+
+	t.Run("in file", func(t *testing.T) {
+		dir := t.TempDir()
+		entry := filepath.Join(dir, "settings.yml")
+		require.NoError(t, os.WriteFile(entry, []byte("profile: prod\nname: base\n"), 0600))
+		require.NoError(t, os.WriteFile(filepath.Join(dir, "settings.prod.yml"), []byte("name: prod\n"), 0600))
+		require.NoError(t, os.WriteFile(filepath.Join(dir, "settings.cloud.yml"), []byte("name: cloud\n"), 0600))
+
+		// `profile` in file is an ordinary setting by default
+		cfg := New()
+		require.NoError(t, cfg.LoadFromFile(entry))
+		require.Equal(t, "base", cfg.GetString("name"))
+		require.Equal(t, "prod", cfg.GetString("profile"))
+
+		cfg = New()
+		require.NoError(t, cfg.LoadFromFile(entry, WithProfileKey("profile")))
+		require.Equal(t, "prod", cfg.GetString("name"))
+		require.NoError(t, cfg.ReloadLayer(LayerFile))
+		require.Equal(t, "prod", cfg.GetString("name"))
+
+		// profile removed from file is not kept by file layer loaded before
+		require.NoError(t, os.WriteFile(entry, []byte("name: base\n"), 0600))
+		require.NoError(t, cfg.ReloadLayer(LayerFile))
+		require.Equal(t, "base", cfg.GetString("name"))
+
+		t.Setenv("TESTPROFILE_PROFILE", "cloud")
+		require.NoError(t, os.WriteFile(entry, []byte("profile: prod\nname: base\n"), 0600))
+		cfg = New()
+		require.NoError(t, cfg.LoadFromEnv("TESTPROFILE"))
+		require.NoError(t, cfg.LoadFromFile(entry, WithProfileKey("profile")))
+		require.Equal(t, "cloud", cfg.GetString("name"))
+	})
+
+	t.Run("custom key", func(t *testing.T) {
+		dir := t.TempDir()
+		entry := filepath.Join(dir, "settings.yml")
+		require.NoError(t, os.WriteFile(entry, []byte("app:\n  env: prod\nname: base\n"), 0600))
+		require.NoError(t, os.WriteFile(filepath.Join(dir, "settings.prod.yml"), []byte("name: prod\n"), 0600))
+
+		cfg := New()
+		require.NoError(t, cfg.LoadFromFile(entry, WithProfileKey("app.env")))
+		require.Equal(t, "prod", cfg.GetString("name"))
+
+		_, err := new(option).applyOptfs(WithProfileKey(" "))
+		require.Error(t, err)
+	})
+}
@@ -0,0 +1,189 @@
+package config
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/Laisky/go-utils/v2/log"
+	"github.com/Laisky/zap"
+	"github.com/pkg/errors"
+)
+
+// RemoteProvider load settings from remote key-value store
+//
+// settings returned by provider are flat key-value pairs,
+// keys are joined by `.`, like `db.host`.
+type RemoteProvider interface {
+	// Fetch load all settings from remote
+	Fetch(ctx context.Context) (map[string]interface{}, error)
+	// Watch block until ctx done,
+	// callback will be called with all current settings once watching started,
+	// and then be called with all latest settings every time remote changed.
+	Watch(ctx context.Context, callback func(map[string]interface{})) error
+}
+
+// remoteKeepAliver provider with credentials to be kept alive in background,
+// like vault token and leases
+type remoteKeepAliver interface {
+	KeepAlive(ctx context.Context)
+}
+
+// remoteWatchRetryInterval interval to restart watching after watch failed
+var remoteWatchRetryInterval = 5 * time.Second
+
+// WithWatchRemote automate update when remote settings changed
+//
+// callback will be called after settings reloaded,
+// you can set callback to nil if you don't want to process changing event manually.
+func WithWatchRemote(callback func()) Option {
+	return func(opt *option) error {
+		opt.watchRemote = true
+		opt.watchRemoteCallback = callback
+		return nil
+	}
+}
+
+// LoadFromRemote load settings from remote provider,
+// will keep watching remote changes until ctx done if enabled `WithWatchRemote`.
+//
+// ctx is only used by the first fetch and watching,
+// reloading and keeping alive are bound to the config rather than ctx.
+func (s *config) LoadFromRemote(ctx context.Context, provider RemoteProvider, opts ...Option) error {
+	opt, err := new(option).fillDefault().applyOptfs(opts...)
+	if err != nil {
+		return errors.Wrap(err, "apply options")
+	}
+
+	kvs, err := provider.Fetch(ctx)
+	if err != nil {
+		return errors.Wrap(err, "fetch remote settings")
+	}
+
+	s.Lock()
+	s.remoteCnt++
+	name := fmt.Sprintf("%T#%d", provider, s.remoteCnt)
+	s.Unlock()
+
+	group := &layerGroup{
+		name: name,
+		reload: func() ([]layerSource, error) {
+			kvs, err := provider.Fetch(s.ctx)
+			if err != nil {
+				return nil, errors.Wrap(err, "fetch remote settings")
+			}
+
+			return remoteSources(name, kvs)
+		},
+	}
+	if group.sources, err = remoteSources(name, kvs); err != nil {
+		return err
+	}
+	if err = s.setLayerGroup(LayerRemote, group); err != nil {
+		return errors.Wrap(err, "load remote settings")
+	}
+
+	if ka, ok := provider.(remoteKeepAliver); ok {
+		go ka.KeepAlive(s.ctx)
+	}
+	if opt.watchRemote {
+		go s.watchRemote(ctx, opt, provider, group, kvs)
+	}
+
+	log.Shared.Info("load settings from remote provider",
+		zap.String("provider", name),
+		zap.Int("keys", len(kvs)))
+	return nil
+}
+
+// remoteSources convert flat key-value pairs like `{"db.host": "localhost"}` to sources
+func remoteSources(name string, kvs map[string]interface{}) ([]layerSource, error) {
+	settings, err := normalizeSettings(unflattenKeys(kvs))
+	if err != nil {
+		return nil, err
+	}
+
+	return []layerSource{{name: name, settings: settings}}, nil
+}
+
+// watchRemote keep watching remote and update group,
+// last is the latest loaded settings
+func (s *config) watchRemote(ctx context.Context, opt *option, provider RemoteProvider,
+	group *layerGroup, last map[string]interface{}) {
+	for {
+		err := provider.Watch(ctx, func(kvs map[string]interface{}) {
+			if reflect.DeepEqual(kvs, last) {
+				return
+			}
+
+			last = kvs
+			sources, err := remoteSources(group.name, kvs)
+			if err == nil {
+				err = s.setLayerGroup(LayerRemote, &layerGroup{
+					name:    group.name,
+					sources: sources,
+					reload:  group.reload,
+				})
+			}
+			if err != nil {
+				log.Shared.Error("remote watcher auto reload settings", zap.Error(err))
+				return
+			}
+
+			if opt.watchRemoteCallback != nil {
+				opt.watchRemoteCallback()
+			}
+		})
+		if ctx.Err() != nil {
+			return
+		}
+
+		log.Shared.Error("watch remote settings, will retry", zap.Error(err))
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(remoteWatchRetryInterval):
+		}
+	}
+}
+
+// unflattenKeys convert `{"a.b": 1}` to `{"a": {"b": 1}}`
+func unflattenKeys(kvs map[string]interface{}) map[string]interface{} {
+	root := map[string]interface{}{}
+	for key, val := range kvs {
+		node := root
+		parts := strings.Split(key, ".")
+		for _, part := range parts[:len(parts)-1] {
+			child, ok := node[part].(map[string]interface{})
+			if !ok {
+				child = map[string]interface{}{}
+				node[part] = child
+			}
+
+			node = child
+		}
+
+		last := parts[len(parts)-1]
+		if _, ok := node[last].(map[string]interface{}); ok {
+			// nested keys take precedence over parent value
+			continue
+		}
+
+		node[last] = val
+	}
+
+	return root
+}
+
+// remoteKey convert remote key like `/app/db/host` to settings key `db.host`
+func remoteKey(prefix, key string) string {
+	key = strings.TrimPrefix(key, prefix)
+	key = strings.Trim(key, "/")
+	return strings.ReplaceAll(key, "/", ".")
+}
+
+// remoteHTTPClient client for long polling, without timeout
+var remoteHTTPClient = &http.Client{}
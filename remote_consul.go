@@ -0,0 +1,159 @@
+package config
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	gutils "github.com/Laisky/go-utils/v2"
+	"github.com/pkg/errors"
+)
+
+// consulWaitTime max duration of blocking query
+const consulWaitTime = "5m"
+
+// ConsulProvider load settings from Consul KV
+//
+// every key under prefix is a setting, like `app/db/host` -> `db.host`.
+type ConsulProvider struct {
+	// Client http client to request consul
+	Client *http.Client
+	// Token ACL token, optional
+	Token string
+
+	endpoint, // consul api, like `http://127.0.0.1:8500`
+	prefix string // key prefix, like `app/`
+}
+
+// NewConsulProvider create ConsulProvider
+func NewConsulProvider(endpoint, prefix string) *ConsulProvider {
+	return &ConsulProvider{
+		Client:   remoteHTTPClient,
+		endpoint: strings.TrimRight(endpoint, "/"),
+		prefix:   strings.TrimLeft(prefix, "/"),
+	}
+}
+
+type consulKV struct {
+	Key   string `json:"Key"`
+	Value string `json:"Value"`
+}
+
+// fetch load settings by blocking query,
+// will block until index changed if index > 0
+func (p *ConsulProvider) fetch(ctx context.Context, index uint64) (kvs map[string]interface{}, newIndex uint64, err error) {
+	query := url.Values{}
+	query.Set("recurse", "true")
+	if index > 0 {
+		query.Set("index", strconv.FormatUint(index, 10))
+		query.Set("wait", consulWaitTime)
+	}
+
+	api := p.endpoint + "/v1/kv/" + p.prefix + "?" + query.Encode()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, api, nil)
+	if err != nil {
+		return nil, 0, errors.Wrap(err, "new request")
+	}
+	if p.Token != "" {
+		req.Header.Set("X-Consul-Token", p.Token)
+	}
+
+	resp, err := p.Client.Do(req)
+	if err != nil {
+		return nil, 0, errors.Wrap(err, "request consul")
+	}
+	defer gutils.SilentClose(resp.Body)
+
+	if v := resp.Header.Get("X-Consul-Index"); v != "" {
+		if newIndex, err = strconv.ParseUint(v, 10, 64); err != nil {
+			return nil, 0, errors.Wrapf(err, "parse consul index `%s`", v)
+		}
+	}
+
+	kvs = map[string]interface{}{}
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotFound:
+		// no key under prefix
+		return kvs, newIndex, nil
+	default:
+		msg, _ := io.ReadAll(resp.Body)
+		return nil, 0, errors.Errorf("request consul got [%d] %s", resp.StatusCode, string(msg))
+	}
+
+	var data []consulKV
+	if err = json.NewDecoder(resp.Body).Decode(&data); err != nil {
+		return nil, 0, errors.Wrap(err, "decode consul response")
+	}
+
+	for _, kv := range data {
+		if strings.HasSuffix(kv.Key, "/") {
+			// folder
+			continue
+		}
+
+		val, err := base64.StdEncoding.DecodeString(kv.Value)
+		if err != nil {
+			return nil, 0, errors.Wrapf(err, "decode value of key `%s`", kv.Key)
+		}
+
+		if k := remoteKey(p.prefix, kv.Key); k != "" {
+			kvs[k] = string(val)
+		}
+	}
+
+	return kvs, newIndex, nil
+}
+
+// Fetch load all settings under prefix
+func (p *ConsulProvider) Fetch(ctx context.Context) (map[string]interface{}, error) {
+	kvs, _, err := p.fetch(ctx, 0)
+	return kvs, err
+}
+
+// errConsulIndexMissing consul response without `X-Consul-Index`,
+// blocking query can not be made, query with index 0 returns immediately.
+var errConsulIndexMissing = errors.New("consul response without valid `X-Consul-Index`")
+
+// Watch watch changes under prefix by blocking queries until ctx done
+func (p *ConsulProvider) Watch(ctx context.Context, callback func(map[string]interface{})) error {
+	kvs, index, err := p.fetch(ctx, 0)
+	if err != nil {
+		return err
+	}
+	if index == 0 {
+		return errConsulIndexMissing
+	}
+	callback(kvs)
+
+	for {
+		kvs, newIndex, err := p.fetch(ctx, index)
+		if err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+
+			return err
+		}
+
+		switch {
+		case newIndex == 0:
+			return errConsulIndexMissing
+		case newIndex == index:
+			// wait timeout, nothing changed
+			continue
+		case newIndex < index:
+			// index went backwards, consul suggests resetting
+			index = 1
+		default:
+			index = newIndex
+		}
+
+		callback(kvs)
+	}
+}
@@ -0,0 +1,164 @@
+package config
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// fakeConsul mock consul KV api with blocking queries
+type fakeConsul struct {
+	sync.Mutex
+	kvs     map[string]string
+	index   uint64
+	changed chan struct{}
+	token   string
+}
+
+func newFakeConsul(kvs map[string]string) *fakeConsul {
+	return &fakeConsul{
+		kvs:     kvs,
+		index:   10,
+		changed: make(chan struct{}),
+	}
+}
+
+func (c *fakeConsul) put(key, val string) {
+	c.Lock()
+	c.kvs[key] = val
+	c.index++
+	close(c.changed)
+	c.changed = make(chan struct{})
+	c.Unlock()
+}
+
+func (c *fakeConsul) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if c.token != "" && r.Header.Get("X-Consul-Token") != c.token {
+		http.Error(w, "ACL not found", http.StatusForbidden)
+		return
+	}
+
+	prefix := strings.TrimPrefix(r.URL.Path, "/v1/kv/")
+	if idx := r.URL.Query().Get("index"); idx != "" {
+		waitIndex, _ := strconv.ParseUint(idx, 10, 64)
+		c.Lock()
+		index, changed := c.index, c.changed
+		c.Unlock()
+		if index <= waitIndex {
+			select {
+			case <-changed:
+			case <-r.Context().Done():
+				return
+			}
+		}
+	}
+
+	c.Lock()
+	defer c.Unlock()
+
+	w.Header().Set("X-Consul-Index", strconv.FormatUint(c.index, 10))
+	var kvs []map[string]string
+	for k, v := range c.kvs {
+		if strings.HasPrefix(k, prefix) {
+			kvs = append(kvs, map[string]string{
+				"Key":   k,
+				"Value": base64.StdEncoding.EncodeToString([]byte(v)),
+			})
+		}
+	}
+
+	if len(kvs) == 0 {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	_ = json.NewEncoder(w).Encode(kvs)
+}
+
+func TestConsulProvider(t *testing.T) {
+	consul := newFakeConsul(map[string]string{
+		"app/":         "",
+		"app/db/host":  "localhost",
+		"app/db/port":  "3306",
+		"other/db/hos": "other",
+	})
+	consul.token = "token"
+	srv := httptest.NewServer(consul)
+	defer srv.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	provider := NewConsulProvider(srv.URL, "/app/")
+	_, err := provider.Fetch(ctx)
+	require.Error(t, err)
+
+	provider.Token = "token"
+	kvs, err := provider.Fetch(ctx)
+	require.NoError(t, err)
+	require.Equal(t, map[string]interface{}{
+		"db.host": "localhost",
+		"db.port": "3306",
+	}, kvs)
+
+	t.Run("empty", func(t *testing.T) {
+		provider := NewConsulProvider(srv.URL, "notexists/")
+		provider.Token = "token"
+		kvs, err := provider.Fetch(ctx)
+		require.NoError(t, err)
+		require.Len(t, kvs, 0)
+	})
+
+	t.Run("watch", func(t *testing.T) {
+		cfg := New()
+		reloaded := make(chan struct{}, 1)
+		require.NoError(t, cfg.LoadFromRemote(ctx, provider, WithWatchRemote(func() {
+			reloaded <- struct{}{}
+		})))
+		require.Equal(t, "localhost", cfg.GetString("db.host"))
+
+		// wait watcher connected
+		time.Sleep(100 * time.Millisecond)
+		consul.put("app/db/host", "remote")
+
+		select {
+		case <-reloaded:
+		case <-time.After(3 * time.Second):
+			t.Fatal("settings not reloaded")
+		}
+
+		require.Equal(t, "remote", cfg.GetString("db.host"))
+	})
+}
+
+func TestConsulProvider_watchWithoutIndex(t *testing.T) {
+	var requests int64
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt64(&requests, 1)
+		_ = json.NewEncoder(w).Encode([]map[string]string{
+			{"Key": "app/name", "Value": base64.StdEncoding.EncodeToString([]byte("app"))},
+		})
+	}))
+	defer srv.Close()
+
+	provider := NewConsulProvider(srv.URL, "app/")
+	kvs, err := provider.Fetch(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, "app", kvs["name"])
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	err = provider.Watch(ctx, func(map[string]interface{}) {})
+	require.ErrorIs(t, err, errConsulIndexMissing)
+	require.Equal(t, int64(2), atomic.LoadInt64(&requests))
+}
@@ -0,0 +1,197 @@
+package config
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	gutils "github.com/Laisky/go-utils/v2"
+	"github.com/pkg/errors"
+)
+
+// EtcdProvider load settings from etcd v3 by its JSON gateway
+//
+// every key under prefix is a setting, like `/app/db/host` -> `db.host`.
+type EtcdProvider struct {
+	// Client http client to request etcd
+	Client *http.Client
+
+	endpoint, // etcd api, like `http://127.0.0.1:2379`
+	prefix string // key prefix, like `/app/`
+}
+
+// NewEtcdProvider create EtcdProvider
+func NewEtcdProvider(endpoint, prefix string) *EtcdProvider {
+	return &EtcdProvider{
+		Client:   remoteHTTPClient,
+		endpoint: strings.TrimRight(endpoint, "/"),
+		prefix:   prefix,
+	}
+}
+
+type etcdKV struct {
+	Key   string `json:"key"`
+	Value string `json:"value"`
+}
+
+type etcdHeader struct {
+	Revision string `json:"revision"`
+}
+
+type etcdRangeResp struct {
+	Header etcdHeader `json:"header"`
+	Kvs    []etcdKV   `json:"kvs"`
+}
+
+type etcdWatchResp struct {
+	Result struct {
+		Header   etcdHeader        `json:"header"`
+		Created  bool              `json:"created"`
+		Canceled bool              `json:"canceled"`
+		Events   []json.RawMessage `json:"events"`
+	} `json:"result"`
+	Error *struct {
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+// etcdPrefixEnd the range end to get all keys with prefix
+func etcdPrefixEnd(prefix string) string {
+	end := []byte(prefix)
+	for i := len(end) - 1; i >= 0; i-- {
+		if end[i] < 0xff {
+			end[i]++
+			return string(end[:i+1])
+		}
+	}
+
+	// prefix is all 0xff, means all keys
+	return "\x00"
+}
+
+func (p *EtcdProvider) post(ctx context.Context, api string, body interface{}) (*http.Response, error) {
+	payload, err := gutils.JSON.Marshal(body)
+	if err != nil {
+		return nil, errors.Wrap(err, "marshal request")
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.endpoint+api, bytes.NewReader(payload))
+	if err != nil {
+		return nil, errors.Wrap(err, "new request")
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := p.Client.Do(req)
+	if err != nil {
+		return nil, errors.Wrapf(err, "request `%s`", api)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		defer gutils.SilentClose(resp.Body)
+		msg, _ := io.ReadAll(resp.Body)
+		return nil, errors.Errorf("request `%s` got [%d] %s", api, resp.StatusCode, string(msg))
+	}
+
+	return resp, nil
+}
+
+func (p *EtcdProvider) fetch(ctx context.Context) (kvs map[string]interface{}, revision int64, err error) {
+	resp, err := p.post(ctx, "/v3/kv/range", map[string]string{
+		"key":       base64.StdEncoding.EncodeToString([]byte(p.prefix)),
+		"range_end": base64.StdEncoding.EncodeToString([]byte(etcdPrefixEnd(p.prefix))),
+	})
+	if err != nil {
+		return nil, 0, err
+	}
+	defer gutils.SilentClose(resp.Body)
+
+	data := new(etcdRangeResp)
+	if err = json.NewDecoder(resp.Body).Decode(data); err != nil {
+		return nil, 0, errors.Wrap(err, "decode etcd response")
+	}
+
+	if data.Header.Revision != "" {
+		if revision, err = strconv.ParseInt(data.Header.Revision, 10, 64); err != nil {
+			return nil, 0, errors.Wrapf(err, "parse revision `%s`", data.Header.Revision)
+		}
+	}
+
+	kvs = make(map[string]interface{}, len(data.Kvs))
+	for _, kv := range data.Kvs {
+		key, err := base64.StdEncoding.DecodeString(kv.Key)
+		if err != nil {
+			return nil, 0, errors.Wrap(err, "decode key")
+		}
+
+		val, err := base64.StdEncoding.DecodeString(kv.Value)
+		if err != nil {
+			return nil, 0, errors.Wrapf(err, "decode value of key `%s`", key)
+		}
+
+		if k := remoteKey(p.prefix, string(key)); k != "" {
+			kvs[k] = string(val)
+		}
+	}
+
+	return kvs, revision, nil
+}
+
+// Fetch load all settings under prefix
+func (p *EtcdProvider) Fetch(ctx context.Context) (map[string]interface{}, error) {
+	kvs, _, err := p.fetch(ctx)
+	return kvs, err
+}
+
+// Watch watch changes under prefix until ctx done
+func (p *EtcdProvider) Watch(ctx context.Context, callback func(map[string]interface{})) error {
+	kvs, revision, err := p.fetch(ctx)
+	if err != nil {
+		return err
+	}
+	callback(kvs)
+
+	resp, err := p.post(ctx, "/v3/watch", map[string]interface{}{
+		"create_request": map[string]interface{}{
+			"key":            base64.StdEncoding.EncodeToString([]byte(p.prefix)),
+			"range_end":      base64.StdEncoding.EncodeToString([]byte(etcdPrefixEnd(p.prefix))),
+			"start_revision": strconv.FormatInt(revision+1, 10),
+		},
+	})
+	if err != nil {
+		return err
+	}
+	defer gutils.SilentClose(resp.Body)
+
+	decoder := json.NewDecoder(resp.Body)
+	for {
+		event := new(etcdWatchResp)
+		if err = decoder.Decode(event); err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+
+			return errors.Wrap(err, "read etcd watch stream")
+		}
+
+		switch {
+		case event.Error != nil:
+			return errors.Errorf("etcd watch error: %s", event.Error.Message)
+		case event.Result.Canceled:
+			return errors.New("etcd watch canceled")
+		case len(event.Result.Events) == 0:
+			continue
+		}
+
+		kvs, err := p.Fetch(ctx)
+		if err != nil {
+			return err
+		}
+
+		callback(kvs)
+	}
+}
@@ -0,0 +1,158 @@
+package config
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// fakeEtcd mock etcd v3 JSON gateway
+type fakeEtcd struct {
+	sync.Mutex
+	kvs      map[string]string
+	revision int64
+	changed  chan struct{}
+}
+
+func newFakeEtcd(kvs map[string]string) *fakeEtcd {
+	return &fakeEtcd{
+		kvs:      kvs,
+		revision: 1,
+		changed:  make(chan struct{}),
+	}
+}
+
+func (e *fakeEtcd) put(key, val string) {
+	e.Lock()
+	e.kvs[key] = val
+	e.revision++
+	close(e.changed)
+	e.changed = make(chan struct{})
+	e.Unlock()
+}
+
+func (e *fakeEtcd) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	req := map[string]interface{}{}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	switch r.URL.Path {
+	case "/v3/kv/range":
+		key, _ := base64.StdEncoding.DecodeString(req["key"].(string))
+		end, _ := base64.StdEncoding.DecodeString(req["range_end"].(string))
+
+		e.Lock()
+		var kvs []map[string]string
+		for k, v := range e.kvs {
+			if k >= string(key) && k < string(end) {
+				kvs = append(kvs, map[string]string{
+					"key":   base64.StdEncoding.EncodeToString([]byte(k)),
+					"value": base64.StdEncoding.EncodeToString([]byte(v)),
+				})
+			}
+		}
+		rev := e.revision
+		e.Unlock()
+
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{
+			"header": map[string]string{"revision": strconv.FormatInt(rev, 10)},
+			"kvs":    kvs,
+		})
+	case "/v3/watch":
+		e.Lock()
+		changed := e.changed
+		e.Unlock()
+
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{
+			"result": map[string]interface{}{"created": true},
+		})
+		w.(http.Flusher).Flush()
+
+		for {
+			select {
+			case <-r.Context().Done():
+				return
+			case <-changed:
+			}
+
+			e.Lock()
+			changed = e.changed
+			e.Unlock()
+
+			_ = json.NewEncoder(w).Encode(map[string]interface{}{
+				"result": map[string]interface{}{
+					"events": []map[string]string{{"type": "PUT"}},
+				},
+			})
+			w.(http.Flusher).Flush()
+		}
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func TestEtcdPrefixEnd(t *testing.T) {
+	require.Equal(t, "/app0", etcdPrefixEnd("/app/"))
+	require.Equal(t, "b", etcdPrefixEnd("a\xff"))
+	require.Equal(t, "\x00", etcdPrefixEnd(""))
+}
+
+func TestEtcdProvider(t *testing.T) {
+	etcd := newFakeEtcd(map[string]string{
+		"/app/db/host":  "localhost",
+		"/app/db/port":  "3306",
+		"/other/db/hos": "other",
+	})
+	srv := httptest.NewServer(etcd)
+	defer srv.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	provider := NewEtcdProvider(srv.URL, "/app/")
+	kvs, err := provider.Fetch(ctx)
+	require.NoError(t, err)
+	require.Equal(t, map[string]interface{}{
+		"db.host": "localhost",
+		"db.port": "3306",
+	}, kvs)
+
+	t.Run("watch", func(t *testing.T) {
+		cfg := New()
+		reloaded := make(chan struct{}, 1)
+		require.NoError(t, cfg.LoadFromRemote(ctx, provider, WithWatchRemote(func() {
+			reloaded <- struct{}{}
+		})))
+		require.Equal(t, "localhost", cfg.GetString("db.host"))
+
+		// wait watcher connected
+		time.Sleep(100 * time.Millisecond)
+		etcd.put("/app/db/host", "remote")
+
+		select {
+		case <-reloaded:
+		case <-time.After(3 * time.Second):
+			t.Fatal("settings not reloaded")
+		}
+
+		require.Equal(t, "remote", cfg.GetString("db.host"))
+	})
+
+	t.Run("error", func(t *testing.T) {
+		provider := NewEtcdProvider(srv.URL+"/notexists", "/app/")
+		_, err := provider.Fetch(ctx)
+		require.Error(t, err)
+		require.True(t, strings.Contains(err.Error(), "404"))
+	})
+}
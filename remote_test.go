@@ -0,0 +1,115 @@
+package config
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestUnflattenKeys(t *testing.T) {
+	got := unflattenKeys(map[string]interface{}{
+		"a":       "1",
+		"b.c":     "2",
+		"b.d.e":   "3",
+		"f":       "override by nested",
+		"f.g":     "4",
+		"h.i.j.k": "5",
+	})
+
+	require.Equal(t, map[string]interface{}{
+		"a": "1",
+		"b": map[string]interface{}{
+			"c": "2",
+			"d": map[string]interface{}{"e": "3"},
+		},
+		"f": map[string]interface{}{"g": "4"},
+		"h": map[string]interface{}{
+			"i": map[string]interface{}{
+				"j": map[string]interface{}{"k": "5"},
+			},
+		},
+	}, got)
+}
+
+func TestRemoteKey(t *testing.T) {
+	require.Equal(t, "db.host", remoteKey("/app/", "/app/db/host"))
+	require.Equal(t, "db.host", remoteKey("/app", "/app/db/host"))
+	require.Equal(t, "db.host", remoteKey("app/", "app/db/host"))
+	require.Equal(t, "", remoteKey("app/", "app/"))
+}
+
+type fakeRemoteProvider struct {
+	kvs     map[string]interface{}
+	changed chan map[string]interface{}
+}
+
+func (p *fakeRemoteProvider) Fetch(ctx context.Context) (map[string]interface{}, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	return p.kvs, nil
+}
+
+func (p *fakeRemoteProvider) Watch(ctx context.Context, callback func(map[string]interface{})) error {
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case kvs := <-p.changed:
+			callback(kvs)
+		}
+	}
+}
+
+func TestConfig_LoadFromRemote(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	provider := &fakeRemoteProvider{
+		kvs: map[string]interface{}{
+			"db.host": "localhost",
+			"db.port": "3306",
+		},
+		changed: make(chan map[string]interface{}),
+	}
+
+	reloaded := make(chan struct{}, 1)
+	cfg := New()
+	require.NoError(t, cfg.LoadFromRemote(ctx, provider, WithWatchRemote(func() {
+		reloaded <- struct{}{}
+	})))
+	require.Equal(t, "localhost", cfg.GetString("db.host"))
+	require.Equal(t, 3306, cfg.GetInt("db.port"))
+
+	provider.changed <- map[string]interface{}{
+		"db.host": "remote",
+		"db.port": "3306",
+	}
+
+	select {
+	case <-reloaded:
+	case <-time.After(time.Second):
+		t.Fatal("settings not reloaded")
+	}
+
+	require.Equal(t, "remote", cfg.GetString("db.host"))
+	require.Equal(t, "remote", cfg.GetStringMapString("db")["host"])
+}
+
+func TestConfig_LoadFromRemote_reloadAfterCanceled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	provider := &fakeRemoteProvider{
+		kvs: map[string]interface{}{"db.host": "localhost"},
+	}
+
+	cfg := New()
+	require.NoError(t, cfg.LoadFromRemote(ctx, provider))
+	cancel()
+
+	provider.kvs = map[string]interface{}{"db.host": "remote"}
+	require.NoError(t, cfg.ReloadLayer(LayerRemote))
+	require.Equal(t, "remote", cfg.GetString("db.host"))
+}
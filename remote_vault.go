@@ -0,0 +1,496 @@
+package config
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	gutils "github.com/Laisky/go-utils/v2"
+	"github.com/Laisky/go-utils/v2/log"
+	"github.com/Laisky/zap"
+	"github.com/pkg/errors"
+)
+
+const (
+	defaultVaultKVVersion    = 2
+	defaultVaultPollInterval = time.Minute
+	defaultVaultAppRoleMount = "approle"
+	// minVaultRenewWait lower bound of the wait between renewals
+	minVaultRenewWait = 100 * time.Millisecond
+)
+
+// errVaultForbidden vault rejects the token, maybe expired or revoked
+var errVaultForbidden = errors.New("vault permission denied")
+
+// VaultAuth how to get token from vault
+type VaultAuth interface {
+	// login return new token
+	login(ctx context.Context, p *VaultProvider) (*vaultSecret, error)
+}
+
+type vaultTokenAuth struct {
+	token string
+}
+
+// VaultTokenAuth auth by static token
+func VaultTokenAuth(token string) VaultAuth {
+	return &vaultTokenAuth{token: token}
+}
+
+func (a *vaultTokenAuth) login(ctx context.Context, p *VaultProvider) (*vaultSecret, error) {
+	// lookup ttl of token, token without ttl will never be renewed
+	secret, err := p.request(ctx, a.token, http.MethodGet, "auth/token/lookup-self", nil)
+	if err != nil {
+		return nil, errors.Wrap(err, "lookup token")
+	}
+
+	ttl, _ := secret.Data["ttl"].(float64)
+	renewable, _ := secret.Data["renewable"].(bool)
+	return &vaultSecret{
+		Auth: &vaultSecretAuth{
+			ClientToken:   a.token,
+			LeaseDuration: int(ttl),
+			Renewable:     renewable,
+		},
+	}, nil
+}
+
+type vaultAppRoleAuth struct {
+	mount,
+	roleID,
+	secretID string
+}
+
+// VaultAppRoleAuth auth by AppRole mounted at `auth/approle`
+func VaultAppRoleAuth(roleID, secretID string) VaultAuth {
+	return VaultAppRoleAuthWithMount(defaultVaultAppRoleMount, roleID, secretID)
+}
+
+// VaultAppRoleAuthWithMount auth by AppRole mounted at `auth/{mount}`
+func VaultAppRoleAuthWithMount(mount, roleID, secretID string) VaultAuth {
+	return &vaultAppRoleAuth{
+		mount:    strings.Trim(mount, "/"),
+		roleID:   roleID,
+		secretID: secretID,
+	}
+}
+
+func (a *vaultAppRoleAuth) login(ctx context.Context, p *VaultProvider) (*vaultSecret, error) {
+	secret, err := p.request(ctx, "", http.MethodPost, "auth/"+a.mount+"/login", map[string]string{
+		"role_id":   a.roleID,
+		"secret_id": a.secretID,
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "login by approle")
+	}
+
+	if secret.Auth == nil || secret.Auth.ClientToken == "" {
+		return nil, errors.New("approle login got empty token")
+	}
+
+	return secret, nil
+}
+
+type vaultSecretAuth struct {
+	ClientToken   string `json:"client_token"`
+	LeaseDuration int    `json:"lease_duration"`
+	Renewable     bool   `json:"renewable"`
+}
+
+// vaultSecret response of vault api
+type vaultSecret struct {
+	LeaseID       string                 `json:"lease_id"`
+	LeaseDuration int                    `json:"lease_duration"`
+	Renewable     bool                   `json:"renewable"`
+	Data          map[string]interface{} `json:"data"`
+	Auth          *vaultSecretAuth       `json:"auth"`
+	Errors        []string               `json:"errors"`
+}
+
+// VaultProvider load secrets from HashiCorp Vault KV engine
+//
+// all fields of secrets are put under `KeyPrefix`,
+// like `{"password": "xxx"}` -> `{KeyPrefix}.password`.
+// secrets from latter paths override former ones.
+//
+// token and leases are renewed in background once loaded by `LoadFromRemote`,
+// expired or revoked token is replaced by login again.
+type VaultProvider struct {
+	// Client http client to request vault
+	Client *http.Client
+	// KVVersion version of KV secrets engine, 1 or 2, default is 2
+	KVVersion int
+	// KeyPrefix put secrets under this key
+	KeyPrefix string
+	// Namespace vault enterprise namespace, optional
+	Namespace string
+	// PollInterval interval to reload secrets when watching,
+	// default is 1 minute if not positive
+	PollInterval time.Duration
+
+	endpoint string   // vault api, like `http://127.0.0.1:8200`
+	paths    []string // secret paths, like `secret/myapp`
+	auth     VaultAuth
+
+	mu       sync.Mutex
+	token    *vaultSecretAuth
+	expireAt time.Time // expiry of token, zero means never expire
+	leases   map[string]time.Duration
+	renewing bool // whether KeepAlive is running
+}
+
+// NewVaultProvider create VaultProvider
+//
+// paths are in the form of `{mount}/{path}`, like `secret/myapp/db`.
+func NewVaultProvider(endpoint string, auth VaultAuth, paths ...string) *VaultProvider {
+	return &VaultProvider{
+		Client:       remoteHTTPClient,
+		KVVersion:    defaultVaultKVVersion,
+		PollInterval: defaultVaultPollInterval,
+		endpoint:     strings.TrimRight(endpoint, "/"),
+		paths:        paths,
+		auth:         auth,
+		leases:       map[string]time.Duration{},
+	}
+}
+
+func (p *VaultProvider) request(ctx context.Context, token, method, api string, body interface{}) (*vaultSecret, error) {
+	var reqBody io.Reader
+	if body != nil {
+		payload, err := gutils.JSON.Marshal(body)
+		if err != nil {
+			return nil, errors.Wrap(err, "marshal request")
+		}
+
+		reqBody = bytes.NewReader(payload)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, p.endpoint+"/v1/"+api, reqBody)
+	if err != nil {
+		return nil, errors.Wrap(err, "new request")
+	}
+	if token != "" {
+		req.Header.Set("X-Vault-Token", token)
+	}
+	if p.Namespace != "" {
+		req.Header.Set("X-Vault-Namespace", p.Namespace)
+	}
+
+	resp, err := p.Client.Do(req)
+	if err != nil {
+		return nil, errors.Wrapf(err, "request `%s`", api)
+	}
+	defer gutils.SilentClose(resp.Body)
+
+	secret := new(vaultSecret)
+	if resp.StatusCode == http.StatusNoContent {
+		return secret, nil
+	}
+
+	if err = json.NewDecoder(resp.Body).Decode(secret); err != nil && err != io.EOF {
+		return nil, errors.Wrapf(err, "decode response of `%s`", api)
+	}
+
+	if resp.StatusCode == http.StatusForbidden {
+		return nil, errors.Wrapf(errVaultForbidden, "request `%s` got [%d] %s",
+			api, resp.StatusCode, strings.Join(secret.Errors, "; "))
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, errors.Errorf("request `%s` got [%d] %s",
+			api, resp.StatusCode, strings.Join(secret.Errors, "; "))
+	}
+
+	return secret, nil
+}
+
+// clientToken return current token, login if not logged in or token expired
+func (p *VaultProvider) clientToken(ctx context.Context) (string, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.token != nil &&
+		(p.expireAt.IsZero() || time.Now().Before(p.expireAt)) {
+		return p.token.ClientToken, nil
+	}
+
+	secret, err := p.auth.login(ctx, p)
+	if err != nil {
+		return "", err
+	}
+
+	p.setToken(secret.Auth)
+	return p.token.ClientToken, nil
+}
+
+// setToken replace current token, should be called with lock
+func (p *VaultProvider) setToken(auth *vaultSecretAuth) {
+	p.token = auth
+	p.expireAt = time.Time{}
+	if auth.LeaseDuration > 0 {
+		p.expireAt = time.Now().Add(time.Duration(auth.LeaseDuration) * time.Second)
+	}
+}
+
+// resetToken drop token if it is still the current one,
+// force to login again in next fetching
+func (p *VaultProvider) resetToken(token string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.token != nil && p.token.ClientToken == token {
+		p.token = nil
+	}
+}
+
+// pollInterval return PollInterval, or the default one if not positive
+func (p *VaultProvider) pollInterval() time.Duration {
+	if p.PollInterval <= 0 {
+		return defaultVaultPollInterval
+	}
+
+	return p.PollInterval
+}
+
+// kvPath convert `{mount}/{path}` to kv api path
+func (p *VaultProvider) kvPath(path string) string {
+	path = strings.Trim(path, "/")
+	if p.KVVersion != 2 {
+		return path
+	}
+
+	if i := strings.Index(path, "/"); i > 0 {
+		return path[:i] + "/data" + path[i:]
+	}
+
+	return path + "/data"
+}
+
+// Fetch load all secrets
+func (p *VaultProvider) Fetch(ctx context.Context) (map[string]interface{}, error) {
+	kvs, err := p.fetch(ctx)
+	if errors.Is(err, errVaultForbidden) {
+		// token may be expired or revoked before its ttl, login again
+		log.Shared.Warn("vault token rejected, try to login again", zap.Error(err))
+		kvs, err = p.fetch(ctx)
+	}
+
+	return kvs, err
+}
+
+// fetch load all secrets by current token,
+// token will be dropped if rejected by vault
+func (p *VaultProvider) fetch(ctx context.Context) (map[string]interface{}, error) {
+	token, err := p.clientToken(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	kvs := map[string]interface{}{}
+	for _, path := range p.paths {
+		secret, err := p.request(ctx, token, http.MethodGet, p.kvPath(path), nil)
+		if err != nil {
+			if errors.Is(err, errVaultForbidden) {
+				p.resetToken(token)
+			}
+
+			return nil, errors.Wrapf(err, "read secret `%s`", path)
+		}
+
+		data := secret.Data
+		if p.KVVersion == 2 {
+			data, _ = secret.Data["data"].(map[string]interface{})
+		}
+
+		for field, val := range data {
+			if p.KeyPrefix != "" {
+				field = p.KeyPrefix + "." + field
+			}
+
+			kvs[field] = val
+		}
+
+		if secret.LeaseID != "" && secret.Renewable {
+			p.mu.Lock()
+			p.leases[secret.LeaseID] = time.Duration(secret.LeaseDuration) * time.Second
+			p.mu.Unlock()
+		}
+	}
+
+	return kvs, nil
+}
+
+// renew renew token and leases
+//
+// lock is only held to read and store state, not during requests,
+// so `Fetch` is not blocked by renewing.
+func (p *VaultProvider) renew(ctx context.Context) error {
+	p.mu.Lock()
+	token, expireAt := p.token, p.expireAt
+	leaseIDs := make([]string, 0, len(p.leases))
+	for leaseID := range p.leases {
+		leaseIDs = append(leaseIDs, leaseID)
+	}
+	p.mu.Unlock()
+
+	if token == nil {
+		return nil
+	}
+
+	var auth *vaultSecretAuth
+	if !token.Renewable && !expireAt.IsZero() && time.Now().After(expireAt) {
+		// token can not be renewed, login again to renew leases
+		secret, err := p.auth.login(ctx, p)
+		if err != nil {
+			p.resetToken(token.ClientToken)
+			return errors.Wrap(err, "login vault")
+		}
+
+		auth = secret.Auth
+	} else if token.Renewable {
+		secret, err := p.request(ctx, token.ClientToken, http.MethodPost, "auth/token/renew-self", nil)
+		if err != nil {
+			// token can not be renewed, login again
+			log.Shared.Warn("renew vault token, try to login again", zap.Error(err))
+			if secret, err = p.auth.login(ctx, p); err != nil {
+				// force to login again in next fetching
+				p.resetToken(token.ClientToken)
+				return errors.Wrap(err, "login vault")
+			}
+		}
+
+		auth = secret.Auth
+	}
+
+	clientToken := token.ClientToken
+	if auth != nil {
+		p.mu.Lock()
+		p.setToken(auth)
+		p.mu.Unlock()
+		clientToken = auth.ClientToken
+	}
+
+	for _, leaseID := range leaseIDs {
+		secret, err := p.request(ctx, clientToken, http.MethodPut, "sys/leases/renew", map[string]string{
+			"lease_id": leaseID,
+		})
+
+		p.mu.Lock()
+		if err != nil {
+			// lease will be recreated by next polling
+			log.Shared.Warn("renew vault lease", zap.String("lease", leaseID), zap.Error(err))
+			delete(p.leases, leaseID)
+		} else {
+			p.leases[leaseID] = time.Duration(secret.LeaseDuration) * time.Second
+		}
+		p.mu.Unlock()
+	}
+
+	return nil
+}
+
+// nextRenew return the duration until next renewal, 0 means no need to renew.
+func (p *VaultProvider) nextRenew() time.Duration {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	var next time.Duration
+	ttls := []time.Duration{}
+	if p.token != nil && p.token.Renewable {
+		ttls = append(ttls, time.Duration(p.token.LeaseDuration)*time.Second)
+	}
+	for _, ttl := range p.leases {
+		ttls = append(ttls, ttl)
+	}
+
+	for _, ttl := range ttls {
+		if ttl = ttl * 2 / 3; ttl > 0 && (next == 0 || ttl < next) {
+			next = ttl
+		}
+	}
+
+	return next
+}
+
+// KeepAlive renew token and leases in background until ctx done,
+// do nothing if already running.
+//
+// called by `LoadFromRemote` and `Watch`, no need to call it manually.
+func (p *VaultProvider) KeepAlive(ctx context.Context) {
+	p.mu.Lock()
+	if p.renewing {
+		p.mu.Unlock()
+		return
+	}
+	p.renewing = true
+	p.mu.Unlock()
+
+	defer func() {
+		p.mu.Lock()
+		p.renewing = false
+		p.mu.Unlock()
+	}()
+
+	lastRenew := time.Now()
+	for {
+		// wake up at least every PollInterval to check new leases
+		wait := p.pollInterval()
+		next := p.nextRenew()
+		if next > 0 {
+			if d := time.Until(lastRenew.Add(next)); d < wait {
+				wait = d
+			}
+		}
+		if wait < minVaultRenewWait {
+			wait = minVaultRenewWait
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(wait):
+		}
+
+		if next = p.nextRenew(); next <= 0 || time.Now().Before(lastRenew.Add(next)) {
+			continue
+		}
+
+		if err := p.renew(ctx); err != nil {
+			log.Shared.Error("renew vault token and leases", zap.Error(err))
+		}
+		lastRenew = time.Now()
+	}
+}
+
+// Watch reload secrets every `PollInterval` until ctx done,
+// token and leases are renewed in background by `KeepAlive`.
+func (p *VaultProvider) Watch(ctx context.Context, callback func(map[string]interface{})) error {
+	kvs, err := p.Fetch(ctx)
+	if err != nil {
+		return err
+	}
+	callback(kvs)
+
+	go p.KeepAlive(ctx)
+
+	poll := time.NewTicker(p.pollInterval())
+	defer poll.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-poll.C:
+			kvs, err := p.Fetch(ctx)
+			if err != nil {
+				return err
+			}
+
+			callback(kvs)
+		}
+	}
+}
@@ -0,0 +1,300 @@
+package config
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// fakeVault mock vault api
+type fakeVault struct {
+	sync.Mutex
+	// secrets api path -> data
+	secrets  map[string]map[string]interface{}
+	kvV2     bool
+	tokenTTL int
+	// nonRenewable approle tokens can not be renewed
+	nonRenewable bool
+	// tokens valid approle tokens
+	tokens   map[string]bool
+	loginCnt int64
+	renewCnt int64
+}
+
+// revoke invalidate all approle tokens
+func (v *fakeVault) revoke() {
+	v.Lock()
+	defer v.Unlock()
+	v.tokens = nil
+}
+
+func (v *fakeVault) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	writeErr := func(code int, msg string) {
+		w.WriteHeader(code)
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{"errors": []string{msg}})
+	}
+
+	switch r.URL.Path {
+	case "/v1/auth/approle/login":
+		req := map[string]string{}
+		_ = json.NewDecoder(r.Body).Decode(&req)
+		if req["role_id"] != "role" || req["secret_id"] != "secret" {
+			writeErr(http.StatusBadRequest, "invalid role or secret ID")
+			return
+		}
+
+		token := fmt.Sprintf("approle-token-%d", atomic.AddInt64(&v.loginCnt, 1))
+		v.Lock()
+		if v.tokens == nil {
+			v.tokens = map[string]bool{}
+		}
+		v.tokens[token] = true
+		v.Unlock()
+
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{
+			"auth": map[string]interface{}{
+				"client_token":   token,
+				"lease_duration": v.tokenTTL,
+				"renewable":      !v.nonRenewable,
+			},
+		})
+		return
+	}
+
+	token := r.Header.Get("X-Vault-Token")
+	v.Lock()
+	valid := token == "root" || v.tokens[token]
+	v.Unlock()
+	if !valid {
+		writeErr(http.StatusForbidden, "permission denied")
+		return
+	}
+
+	switch r.URL.Path {
+	case "/v1/auth/token/lookup-self":
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{
+			"data": map[string]interface{}{
+				"ttl":       v.tokenTTL,
+				"renewable": v.tokenTTL > 0,
+			},
+		})
+	case "/v1/auth/token/renew-self":
+		atomic.AddInt64(&v.renewCnt, 1)
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{
+			"auth": map[string]interface{}{
+				"client_token":   token,
+				"lease_duration": v.tokenTTL,
+				"renewable":      true,
+			},
+		})
+	default:
+		v.Lock()
+		data, ok := v.secrets[r.URL.Path]
+		v.Unlock()
+		if !ok {
+			writeErr(http.StatusNotFound, "")
+			return
+		}
+
+		if v.kvV2 {
+			data = map[string]interface{}{
+				"data":     data,
+				"metadata": map[string]interface{}{"version": 1},
+			}
+		}
+
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{
+			"lease_duration": 2764800,
+			"data":           data,
+		})
+	}
+}
+
+func TestVaultProvider_kvPath(t *testing.T) {
+	p := NewVaultProvider("http://vault", VaultTokenAuth("root"))
+	require.Equal(t, "secret/data/app/db", p.kvPath("secret/app/db"))
+	require.Equal(t, "secret/data/app", p.kvPath("/secret/app/"))
+	require.Equal(t, "secret/data", p.kvPath("secret"))
+
+	p.KVVersion = 1
+	require.Equal(t, "secret/app/db", p.kvPath("secret/app/db"))
+}
+
+func TestVaultProvider(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	t.Run("kv v2 with token", func(t *testing.T) {
+		vault := &fakeVault{
+			kvV2: true,
+			secrets: map[string]map[string]interface{}{
+				"/v1/secret/data/app":    {"password": "p1", "user": "u1"},
+				"/v1/secret/data/app/db": {"password": "p2"},
+			},
+		}
+		srv := httptest.NewServer(vault)
+		defer srv.Close()
+
+		p := NewVaultProvider(srv.URL, VaultTokenAuth("root"), "secret/app", "secret/app/db")
+		p.KeyPrefix = "secrets"
+		kvs, err := p.Fetch(ctx)
+		require.NoError(t, err)
+		require.Equal(t, map[string]interface{}{
+			"secrets.password": "p2",
+			"secrets.user":     "u1",
+		}, kvs)
+
+		cfg := New()
+		require.NoError(t, cfg.LoadFromRemote(ctx, p))
+		require.Equal(t, "p2", cfg.GetString("secrets.password"))
+	})
+
+	t.Run("invalid token", func(t *testing.T) {
+		srv := httptest.NewServer(&fakeVault{})
+		defer srv.Close()
+
+		p := NewVaultProvider(srv.URL, VaultTokenAuth("wrong"), "secret/app")
+		_, err := p.Fetch(ctx)
+		require.ErrorContains(t, err, "permission denied")
+	})
+
+	t.Run("kv v1 with approle", func(t *testing.T) {
+		vault := &fakeVault{
+			secrets: map[string]map[string]interface{}{
+				"/v1/kv/app": {"password": "p1"},
+			},
+			tokenTTL: 1,
+		}
+		srv := httptest.NewServer(vault)
+		defer srv.Close()
+
+		p := NewVaultProvider(srv.URL, VaultAppRoleAuth("role", "wrong"), "kv/app")
+		p.KVVersion = 1
+		_, err := p.Fetch(ctx)
+		require.ErrorContains(t, err, "invalid role or secret ID")
+
+		p = NewVaultProvider(srv.URL, VaultAppRoleAuth("role", "secret"), "kv/app")
+		p.KVVersion = 1
+		p.PollInterval = 50 * time.Millisecond
+
+		cfg := New()
+		reloaded := make(chan struct{}, 1)
+		require.NoError(t, cfg.LoadFromRemote(ctx, p, WithWatchRemote(func() {
+			reloaded <- struct{}{}
+		})))
+		require.Equal(t, "p1", cfg.GetString("password"))
+
+		vault.Lock()
+		vault.secrets["/v1/kv/app"] = map[string]interface{}{"password": "p2"}
+		vault.Unlock()
+
+		select {
+		case <-reloaded:
+		case <-time.After(3 * time.Second):
+			t.Fatal("settings not reloaded")
+		}
+		require.Equal(t, "p2", cfg.GetString("password"))
+
+		// token ttl is 1s, should be renewed after 2/3s
+		time.Sleep(time.Second)
+		require.Greater(t, atomic.LoadInt64(&vault.renewCnt), int64(0))
+	})
+
+	t.Run("login again after token revoked", func(t *testing.T) {
+		vault := &fakeVault{
+			secrets: map[string]map[string]interface{}{
+				"/v1/kv/app": {"password": "p1"},
+			},
+		}
+		srv := httptest.NewServer(vault)
+		defer srv.Close()
+
+		p := NewVaultProvider(srv.URL, VaultAppRoleAuth("role", "secret"), "kv/app")
+		p.KVVersion = 1
+		_, err := p.Fetch(ctx)
+		require.NoError(t, err)
+
+		vault.revoke()
+		kvs, err := p.Fetch(ctx)
+		require.NoError(t, err)
+		require.Equal(t, "p1", kvs["password"])
+		require.Equal(t, int64(2), atomic.LoadInt64(&vault.loginCnt))
+	})
+
+	t.Run("login again after token expired", func(t *testing.T) {
+		vault := &fakeVault{
+			secrets: map[string]map[string]interface{}{
+				"/v1/kv/app": {"password": "p1"},
+			},
+			tokenTTL:     1,
+			nonRenewable: true,
+		}
+		srv := httptest.NewServer(vault)
+		defer srv.Close()
+
+		p := NewVaultProvider(srv.URL, VaultAppRoleAuth("role", "secret"), "kv/app")
+		p.KVVersion = 1
+		_, err := p.Fetch(ctx)
+		require.NoError(t, err)
+		_, err = p.Fetch(ctx)
+		require.NoError(t, err)
+		require.Equal(t, int64(1), atomic.LoadInt64(&vault.loginCnt))
+
+		time.Sleep(1100 * time.Millisecond)
+		_, err = p.Fetch(ctx)
+		require.NoError(t, err)
+		require.Equal(t, int64(2), atomic.LoadInt64(&vault.loginCnt))
+	})
+
+	t.Run("renew without watching", func(t *testing.T) {
+		vault := &fakeVault{
+			secrets: map[string]map[string]interface{}{
+				"/v1/kv/app": {"password": "p1"},
+			},
+			tokenTTL: 1,
+		}
+		srv := httptest.NewServer(vault)
+		defer srv.Close()
+
+		p := NewVaultProvider(srv.URL, VaultAppRoleAuth("role", "secret"), "kv/app")
+		p.KVVersion = 1
+
+		cfg := New()
+		require.NoError(t, cfg.LoadFromRemote(ctx, p))
+		require.Eventually(t, func() bool {
+			return atomic.LoadInt64(&vault.renewCnt) > 0
+		}, 3*time.Second, 50*time.Millisecond)
+	})
+
+	t.Run("watch without poll interval", func(t *testing.T) {
+		vault := &fakeVault{
+			secrets: map[string]map[string]interface{}{
+				"/v1/kv/app": {"password": "p1"},
+			},
+		}
+		srv := httptest.NewServer(vault)
+		defer srv.Close()
+
+		p := NewVaultProvider(srv.URL, VaultTokenAuth("root"), "kv/app")
+		p.KVVersion = 1
+		p.PollInterval = 0
+
+		ctx, cancel := context.WithTimeout(ctx, 200*time.Millisecond)
+		defer cancel()
+
+		var got map[string]interface{}
+		err := p.Watch(ctx, func(kvs map[string]interface{}) {
+			got = kvs
+		})
+		require.ErrorIs(t, err, context.DeadlineExceeded)
+		require.Equal(t, "p1", got["password"])
+	})
+}
@@ -0,0 +1,1149 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/Laisky/go-utils/v2/encrypt"
+	"github.com/pelletier/go-toml"
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v3"
+)
+
+// WithSaveOverridesOnly only save settings set by `Set`, for `Save` and `SaveAs`
+func WithSaveOverridesOnly() Option {
+	return func(opt *option) error {
+		opt.saveOverridesOnly = true
+		return nil
+	}
+}
+
+// savedSettings settings to save into fpath, file settings and overrides
+//
+// if fpath is loaded in file layer, only keys of itself are saved,
+// otherwise keys of all files except encrypted ones are saved.
+// settings are saved as parsed from files, lists merged from includes
+// and keys migrated by `RegisterMigration` are never written back.
+// values from encrypted files, remote, env and flags are never saved,
+// the value in saved files is kept instead.
+func (s *config) savedSettings(opt *option, fpath string) map[string]interface{} {
+	snap := s.load()
+	settings := map[string]interface{}{}
+	if !opt.saveOverridesOnly {
+		for _, src := range snap.savedSources(fpath) {
+			walkSettings(src.ownSettings(), nil, func(path []string, val interface{}) {
+				if _, ok := lookupSettings(settings, path); ok {
+					return
+				}
+
+				putSettings(settings, path, val)
+			})
+		}
+	}
+
+	for _, kv := range snap.overrides {
+		putSettings(settings, strings.Split(kv.key, "."), kv.val)
+	}
+
+	return settings
+}
+
+// savedSources sources in file layer to save into fpath, in descending priority
+func (s *snapshot) savedSources(fpath string) []layerSource {
+	var sources []layerSource
+	groups := s.groups[LayerFile]
+	for i := len(groups) - 1; i >= 0; i-- {
+		for j := len(groups[i].sources) - 1; j >= 0; j-- {
+			src := groups[i].sources[j]
+			if isSamePath(src.name, fpath) {
+				return []layerSource{src}
+			}
+			if !src.encrypted {
+				sources = append(sources, src)
+			}
+		}
+	}
+
+	return sources
+}
+
+// isSamePath whether two file paths point to the same file
+func isSamePath(a, b string) bool {
+	if a == b {
+		return true
+	}
+
+	absA, err := filepath.Abs(a)
+	if err != nil {
+		return false
+	}
+	absB, err := filepath.Abs(b)
+	if err != nil {
+		return false
+	}
+
+	return absA == absB
+}
+
+// walkSettings call fn with path of every leaf in nested settings
+func walkSettings(settings map[string]interface{}, path []string, fn func(path []string, val interface{})) {
+	for k, v := range settings {
+		cur := append(append([]string{}, path...), k)
+		if sub, ok := v.(map[string]interface{}); ok && len(sub) != 0 {
+			walkSettings(sub, cur, fn)
+			continue
+		}
+
+		fn(cur, v)
+	}
+}
+
+// Save write settings into file fpath in its format,
+// file is created by `SaveAs` if not exists.
+//
+// comments and key order of yaml and toml are preserved,
+// keys only in file are kept. encrypted file is encrypted again by `WithAesEncrypt`.
+// settings of the file and overrides set by `Set` are saved, see `savedSettings`,
+// use `WithSaveOverridesOnly` to save only settings set by `Set`.
+// error is returned if comments or key order can not be preserved.
+func (s *config) Save(fpath string, opts ...Option) error {
+	opt, err := new(option).fillDefault().applyOptfs(opts...)
+	if err != nil {
+		return errors.Wrap(err, "apply options")
+	}
+	if opt.fsys != nil {
+		return errors.New("can not write files in fs")
+	}
+
+	if _, err = os.Stat(fpath); os.IsNotExist(err) {
+		return s.saveAs(opt, fpath)
+	}
+
+	cnt, err := readSettingsFile(opt, fpath)
+	if err != nil {
+		return err
+	}
+
+	cfgType, err := detectFormat(opt, fpath, cnt)
+	if err != nil {
+		return err
+	}
+
+	if cnt, err = patchSettingsFile(cfgType, fpath, cnt, s.savedSettings(opt, fpath)); err != nil {
+		return errors.Wrapf(err, "save settings to `%s`", fpath)
+	}
+
+	return writeSettingsFile(opt, fpath, cnt)
+}
+
+// SaveAs write settings into file fpath, existing content is replaced.
+//
+// format is detected by extension, or set by `WithFormat`.
+// only yaml, json and toml are supported.
+// settings of all files except encrypted ones and overrides set by `Set` are saved.
+func (s *config) SaveAs(fpath string, opts ...Option) error {
+	opt, err := new(option).fillDefault().applyOptfs(opts...)
+	if err != nil {
+		return errors.Wrap(err, "apply options")
+	}
+	if opt.fsys != nil {
+		return errors.New("can not write files in fs")
+	}
+
+	return s.saveAs(opt, fpath)
+}
+
+func (s *config) saveAs(opt *option, fpath string) error {
+	cfgType := configFileType(opt, fpath)
+	if !isSupportedFormat(cfgType) {
+		if opt.format == "" {
+			return errors.Errorf("can not detect format of `%s`, set it by `WithFormat`", fpath)
+		}
+
+		cfgType = opt.format
+	}
+
+	cnt, err := encodeSettings(cfgType, s.savedSettings(opt, fpath))
+	if err != nil {
+		return errors.Wrapf(err, "save settings to `%s`", fpath)
+	}
+
+	return writeSettingsFile(opt, fpath, cnt)
+}
+
+// writeSettingsFile write file atomically by renaming a temp file,
+// encrypt if file is encrypted.
+func writeSettingsFile(opt *option, fpath string, cnt []byte) (err error) {
+	if opt.encryptedSuffix != "" && strings.HasSuffix(fpath, opt.encryptedSuffix) && opt.aesKey == nil {
+		return errors.Errorf("aes key is required to write encrypted file `%s`", fpath)
+	}
+
+	if isSettingsFileEncrypted(opt, fpath) {
+		if cnt, err = encrypt.EncryptByAes(opt.aesKey, cnt); err != nil {
+			return errors.Wrapf(err, "encrypt file `%s`", fpath)
+		}
+	}
+
+	perm := os.FileMode(0644)
+	if fi, err := os.Stat(fpath); err == nil {
+		perm = fi.Mode().Perm()
+	}
+
+	return writeFileAtomic(fpath, cnt, perm)
+}
+
+// writeFileAtomic write file by renaming a temp file in the same dir,
+// so readers never see a partially written file.
+func writeFileAtomic(fpath string, cnt []byte, perm os.FileMode) (err error) {
+	fp, err := os.CreateTemp(filepath.Dir(fpath), "."+filepath.Base(fpath)+".*")
+	if err != nil {
+		return errors.Wrapf(err, "create temp file for `%s`", fpath)
+	}
+	defer func() {
+		if err != nil {
+			_ = os.Remove(fp.Name())
+		}
+	}()
+
+	if _, err = fp.Write(cnt); err != nil {
+		_ = fp.Close()
+		return errors.Wrapf(err, "write file `%s`", fp.Name())
+	}
+	if err = fp.Sync(); err != nil {
+		_ = fp.Close()
+		return errors.Wrapf(err, "sync file `%s`", fp.Name())
+	}
+	if err = fp.Close(); err != nil {
+		return errors.Wrapf(err, "close file `%s`", fp.Name())
+	}
+	if err = os.Chmod(fp.Name(), perm); err != nil {
+		return errors.Wrapf(err, "chmod file `%s`", fp.Name())
+	}
+	if err = os.Rename(fp.Name(), fpath); err != nil {
+		return errors.Wrapf(err, "rename `%s` to `%s`", fp.Name(), fpath)
+	}
+
+	return nil
+}
+
+// patchSettingsFile write settings into content cnt of file fpath in format cfgType
+func patchSettingsFile(cfgType, fpath string, cnt []byte, settings map[string]interface{}) ([]byte, error) {
+	expected, err := parseSettings(cfgType, fpath, bytes.NewReader(cnt))
+	if err != nil {
+		return nil, errors.Wrap(err, "parse file")
+	}
+	if expected == nil {
+		expected = map[string]interface{}{}
+	}
+	overlaySettings(expected, settings)
+
+	var patch func(cnt []byte) ([]byte, error)
+	switch cfgType {
+	case "yaml", "yml":
+		patch = func(cnt []byte) ([]byte, error) { return patchYAML(cnt, settings) }
+	case "toml":
+		patch = func(cnt []byte) ([]byte, error) { return patchTOML(cnt, settings) }
+	}
+
+	return rewriteSettingsFile(cfgType, fpath, cnt, expected, patch)
+}
+
+// rewriteSettingsFile edit content cnt of file fpath in format cfgType by edit,
+// expected is settings after edited.
+//
+// json without comments is encoded from expected if edit is nil,
+// otherwise error is returned if edit is nil or failed, file is never rewritten lossily.
+func rewriteSettingsFile(cfgType, fpath string, cnt []byte, expected map[string]interface{},
+	edit func(cnt []byte) ([]byte, error)) ([]byte, error) {
+	if edit == nil {
+		if cfgType != "json" {
+			return nil, errors.Errorf("can not preserve comments and key order of format `%s`", cfgType)
+		}
+
+		return encodeSettings(cfgType, expected)
+	}
+
+	edited, err := edit(cnt)
+	if err != nil {
+		return nil, errors.Wrap(err, "can not preserve comments and key order")
+	}
+
+	// make sure edited file is exactly what expected
+	settings, err := parseSettings(cfgType, fpath, bytes.NewReader(edited))
+	if err != nil {
+		return nil, errors.Wrap(err, "parse edited file")
+	}
+	if expected, err = normalizeSettings(copySettings(expected)); err != nil {
+		return nil, err
+	}
+	if !settingsEqual(settings, expected) {
+		return nil, errors.New("edited settings mismatch, can not preserve comments and key order")
+	}
+
+	return edited, nil
+}
+
+// overlaySettings deep merge src into dst
+func overlaySettings(dst, src map[string]interface{}) {
+	for k, v := range src {
+		if sub, ok := v.(map[string]interface{}); ok {
+			if dstSub, ok := dst[k].(map[string]interface{}); ok {
+				overlaySettings(dstSub, sub)
+				continue
+			}
+		}
+
+		dst[k] = v
+	}
+}
+
+// settingsEqual whether two values are serialized to the same json
+func settingsEqual(a, b interface{}) bool {
+	ja, err := json.Marshal(a)
+	if err != nil {
+		return false
+	}
+	jb, err := json.Marshal(b)
+	if err != nil {
+		return false
+	}
+
+	return bytes.Equal(ja, jb)
+}
+
+func sortedKeys(settings map[string]interface{}) []string {
+	keys := make([]string, 0, len(settings))
+	for k := range settings {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	return keys
+}
+
+// yamlPatcher write settings into yaml document by editing text,
+// values are replaced in place and new keys are appended to their mappings,
+// so comments, blank lines and alignment are kept.
+type yamlPatcher struct {
+	textLines
+	// root mapping of document, nil if document is empty
+	root   *yaml.Node
+	indent int
+	edits  []textEdit
+}
+
+func newYAMLPatcher(cnt []byte) (*yamlPatcher, error) {
+	doc := new(yaml.Node)
+	if err := yaml.Unmarshal(cnt, doc); err != nil {
+		return nil, errors.Wrap(err, "parse yaml")
+	}
+
+	p := &yamlPatcher{textLines: newTextLines(cnt), indent: yamlIndent(cnt)}
+	if len(doc.Content) != 0 {
+		p.root = doc.Content[0]
+		if p.root.Kind != yaml.MappingNode {
+			return nil, errors.New("yaml document is not a mapping")
+		}
+	}
+
+	return p, nil
+}
+
+// patchYAML write settings into yaml document, only changed values are replaced,
+// new keys are appended to their mappings.
+func patchYAML(cnt []byte, settings map[string]interface{}) ([]byte, error) {
+	p, err := newYAMLPatcher(cnt)
+	if err != nil {
+		return nil, err
+	}
+
+	if p.root == nil {
+		// only comments in document
+		text, err := encodeSettings("yaml", settings)
+		if err != nil {
+			return nil, err
+		}
+		if len(cnt) > 0 && cnt[len(cnt)-1] != '\n' {
+			text = append([]byte("\n"), text...)
+		}
+
+		return append(append([]byte{}, cnt...), text...), nil
+	}
+
+	if err = p.patchMapping(p.root, len(cnt), settings); err != nil {
+		return nil, err
+	}
+
+	return applyEdits(cnt, p.edits), nil
+}
+
+// yamlKeyIndex index of key in mapping node, -1 if not found
+func yamlKeyIndex(node *yaml.Node, key string) int {
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if node.Content[i].Tag != "!!merge" && strings.EqualFold(node.Content[i].Value, key) {
+			return i
+		}
+	}
+
+	return -1
+}
+
+// entryEnd offset where entry at idx of mapping node ends,
+// the line of the next key, or end of the mapping
+func (p *yamlPatcher) entryEnd(node *yaml.Node, idx, end int) int {
+	if idx+2 < len(node.Content) {
+		if off, ok := p.offsetOf(node.Content[idx+2].Line, 1); ok {
+			return off
+		}
+	}
+
+	return end
+}
+
+// patchMapping write settings into block mapping node ends at end
+func (p *yamlPatcher) patchMapping(node *yaml.Node, end int, settings map[string]interface{}) error {
+	if node.Style&yaml.FlowStyle != 0 {
+		return errors.New("can not edit flow mapping in place")
+	}
+
+	// current values, keys merged by `<<` are included
+	current := map[string]interface{}{}
+	if err := node.Decode(&current); err != nil {
+		return errors.Wrap(err, "decode yaml")
+	}
+	for k, v := range current {
+		current[strings.ToLower(k)] = v
+	}
+
+	var newKeys []string
+	for _, key := range sortedKeys(settings) {
+		val := settings[key]
+		idx := yamlKeyIndex(node, key)
+		if idx < 0 {
+			if cur, ok := current[key]; !ok || !settingsEqual(cur, val) {
+				newKeys = append(newKeys, key)
+			}
+
+			continue
+		}
+
+		keyNode, valNode := node.Content[idx], node.Content[idx+1]
+		entryEnd := p.entryEnd(node, idx, end)
+		if sub, ok := val.(map[string]interface{}); ok && valNode.Kind == yaml.MappingNode {
+			if valNode.Style&yaml.FlowStyle == 0 {
+				if err := p.patchMapping(valNode, entryEnd, sub); err != nil {
+					return err
+				}
+
+				continue
+			}
+
+			// flow mapping is replaced as a whole
+			merged := map[string]interface{}{}
+			if err := valNode.Decode(&merged); err != nil {
+				return errors.Wrap(err, "decode yaml")
+			}
+			overlaySettings(merged, sub)
+			val = merged
+		}
+
+		if settingsEqual(current[key], val) {
+			continue
+		}
+
+		if err := p.replaceValue(keyNode, valNode, entryEnd, val); err != nil {
+			return errors.Wrapf(err, "replace `%s`", key)
+		}
+	}
+
+	return p.insertKeys(node, end, newKeys, settings)
+}
+
+// replaceValue replace value of key, comments after value are kept
+func (p *yamlPatcher) replaceValue(keyNode, valNode *yaml.Node, end int, val interface{}) error {
+	text, err := encodeYAMLInline(val, valNode)
+	if err != nil {
+		return err
+	}
+
+	start, ok := p.offsetOf(valNode.Line, valNode.Column)
+	if !ok {
+		return errors.New("unknown position of value")
+	}
+
+	// block collections and empty values are replaced from `:` of key
+	if (valNode.Style&yaml.FlowStyle == 0 &&
+		(valNode.Kind == yaml.MappingNode || valNode.Kind == yaml.SequenceNode)) ||
+		(valNode.Tag == "!!null" && valNode.Value == "") ||
+		valNode.Line != keyNode.Line {
+		colon, err := p.colonOf(keyNode)
+		if err != nil {
+			return err
+		}
+
+		start, text = colon+1, " "+text
+	}
+
+	p.edits = append(p.edits, textEdit{
+		start: start,
+		end:   p.valueEnd(start, p.trimEnd(start, end), valNode),
+		text:  text,
+	})
+	return nil
+}
+
+// colonOf offset of `:` after key
+func (p *yamlPatcher) colonOf(keyNode *yaml.Node) (int, error) {
+	start, ok := p.offsetOf(keyNode.Line, keyNode.Column)
+	if !ok {
+		return 0, errors.Errorf("unknown position of `%s`", keyNode.Value)
+	}
+
+	var quote byte
+	for off := start; off < len(p.cnt); off++ {
+		c := p.cnt[off]
+		switch {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case off == start && (c == '"' || c == '\''):
+			quote = c
+		case c == ':' && (off+1 == len(p.cnt) || bytes.IndexByte([]byte(" \t\r\n"), p.cnt[off+1]) >= 0):
+			return off, nil
+		case c == '\n':
+			return 0, errors.Errorf("can not find `:` of `%s`", keyNode.Value)
+		}
+	}
+
+	return 0, errors.Errorf("can not find `:` of `%s`", keyNode.Value)
+}
+
+// valueEnd end of value between start and end, trailing comment is cut
+func (p *yamlPatcher) valueEnd(start, end int, old *yaml.Node) int {
+	text := p.cnt[start:end]
+	for i := 1; i < len(text); i++ {
+		if text[i] == '#' && (text[i-1] == ' ' || text[i-1] == '\t') && yamlValueIs(text[:i], old) {
+			return start + len(bytes.TrimRight(text[:i], " \t"))
+		}
+	}
+
+	return start + len(bytes.TrimRight(text, " \t\r\n"))
+}
+
+// yamlValueIs whether text is the yaml of value of node
+func yamlValueIs(text []byte, node *yaml.Node) bool {
+	var want interface{}
+	if err := node.Decode(&want); err != nil {
+		return false
+	}
+
+	got := map[string]interface{}{}
+	if err := yaml.Unmarshal(append([]byte("v: "), text...), &got); err != nil {
+		return false
+	}
+
+	return settingsEqual(got["v"], want)
+}
+
+// insertKeys append new keys to the end of block mapping node ends at end
+func (p *yamlPatcher) insertKeys(node *yaml.Node, end int, keys []string, settings map[string]interface{}) error {
+	if len(keys) == 0 {
+		return nil
+	}
+
+	start, ok := p.offsetOf(node.Line, 1)
+	if !ok {
+		return errors.New("unknown position of mapping")
+	}
+	off := p.trimEnd(start, end)
+
+	var buf strings.Builder
+	if off > 0 && p.cnt[off-1] != '\n' {
+		buf.WriteByte('\n')
+	}
+
+	indent := strings.Repeat(" ", node.Column-1)
+	for _, key := range keys {
+		text, err := encodeYAMLEntry(key, settings[key], p.indent)
+		if err != nil {
+			return errors.Wrapf(err, "encode `%s`", key)
+		}
+
+		for _, line := range strings.SplitAfter(text, "\n") {
+			if line != "" {
+				buf.WriteString(indent + line)
+			}
+		}
+	}
+
+	p.edits = append(p.edits, textEdit{start: off, end: off, text: buf.String()})
+	return nil
+}
+
+// encodeYAMLInline encode value in one line by flow style,
+// quoted string keeps the quoting style of old value.
+func encodeYAMLInline(val interface{}, old *yaml.Node) (string, error) {
+	node := new(yaml.Node)
+	if err := node.Encode(val); err != nil {
+		return "", errors.Wrap(err, "encode yaml")
+	}
+	setYAMLFlowStyle(node)
+
+	if node.Kind == yaml.ScalarNode && node.Tag == "!!str" && node.Style == 0 &&
+		old.Kind == yaml.ScalarNode && old.Tag == "!!str" &&
+		old.Style&(yaml.SingleQuotedStyle|yaml.DoubleQuotedStyle) != 0 {
+		node.Style = old.Style
+	}
+
+	out, err := yaml.Marshal(node)
+	if err != nil {
+		return "", errors.Wrap(err, "encode yaml")
+	}
+
+	text := strings.TrimSuffix(string(out), "\n")
+	if strings.Contains(text, "\n") {
+		return "", errors.Errorf("can not encode `%T` in one line", val)
+	}
+
+	return text, nil
+}
+
+// setYAMLFlowStyle encode collections in flow style and multi-line strings quoted
+func setYAMLFlowStyle(node *yaml.Node) {
+	switch node.Kind {
+	case yaml.MappingNode, yaml.SequenceNode:
+		node.Style = yaml.FlowStyle
+	case yaml.ScalarNode:
+		if strings.Contains(node.Value, "\n") {
+			node.Style = yaml.DoubleQuotedStyle
+		}
+	}
+
+	for _, child := range node.Content {
+		setYAMLFlowStyle(child)
+	}
+}
+
+// encodeYAMLEntry encode key-value as block yaml
+func encodeYAMLEntry(key string, val interface{}, indent int) (string, error) {
+	var buf bytes.Buffer
+	enc := yaml.NewEncoder(&buf)
+	enc.SetIndent(indent)
+	if err := enc.Encode(map[string]interface{}{key: val}); err != nil {
+		return "", err
+	}
+	if err := enc.Close(); err != nil {
+		return "", err
+	}
+
+	return buf.String(), nil
+}
+
+// yamlIndent indent of yaml document, 4 if not detected
+func yamlIndent(cnt []byte) int {
+	for _, line := range strings.Split(string(cnt), "\n") {
+		trimmed := strings.TrimLeft(line, " ")
+		if trimmed == "" || strings.HasPrefix(trimmed, "#") || strings.HasPrefix(trimmed, "- ") {
+			continue
+		}
+
+		if indent := len(line) - len(trimmed); indent > 0 {
+			return indent
+		}
+	}
+
+	return 4
+}
+
+// textEdit replace content between start and end by text
+type textEdit struct {
+	start, end int
+	text       string
+}
+
+// applyEdits apply non-overlapping edits to cnt
+func applyEdits(cnt []byte, edits []textEdit) []byte {
+	sort.SliceStable(edits, func(i, j int) bool {
+		return edits[i].start < edits[j].start
+	})
+
+	var buf bytes.Buffer
+	last := 0
+	for _, e := range edits {
+		buf.Write(cnt[last:e.start])
+		buf.WriteString(e.text)
+		last = e.end
+	}
+	buf.Write(cnt[last:])
+
+	return buf.Bytes()
+}
+
+// textLines content and offsets of its lines, for editing text in place
+type textLines struct {
+	cnt       []byte
+	lineStart []int
+}
+
+func newTextLines(cnt []byte) textLines {
+	t := textLines{cnt: cnt, lineStart: []int{0}}
+	for i, c := range cnt {
+		if c == '\n' {
+			t.lineStart = append(t.lineStart, i+1)
+		}
+	}
+
+	return t
+}
+
+// offsetOf byte offset of 1-based line and column, column counts runes
+func (t textLines) offsetOf(line, col int) (int, bool) {
+	if line <= 0 || line > len(t.lineStart) {
+		return 0, false
+	}
+
+	off := t.lineStart[line-1]
+	for c := 1; c < col && off < len(t.cnt); c++ {
+		_, size := utf8.DecodeRune(t.cnt[off:])
+		off += size
+	}
+
+	return off, true
+}
+
+// line content of 1-based line number, without newline
+func (t textLines) line(n int) []byte {
+	start := t.lineStart[n-1]
+	end := len(t.cnt)
+	if n < len(t.lineStart) {
+		end = t.lineStart[n] - 1
+	}
+
+	return t.cnt[start:end]
+}
+
+// trimEnd move end back over blank and comment lines, but not before start.
+// end should be the start of a line or the end of content.
+func (t textLines) trimEnd(start, end int) int {
+	for end > start {
+		body := bytes.TrimSuffix(t.cnt[:end], []byte("\n"))
+		lineBegin := bytes.LastIndexByte(body, '\n') + 1
+		if lineBegin < start {
+			lineBegin = start
+		}
+
+		trimmed := bytes.TrimSpace(t.cnt[lineBegin:len(body)])
+		if len(trimmed) != 0 && trimmed[0] != '#' {
+			break
+		}
+
+		end = lineBegin
+	}
+
+	return end
+}
+
+// tomlPatcher write settings into toml document by editing text,
+// values are replaced in place and new keys are inserted into their tables.
+type tomlPatcher struct {
+	textLines
+	tree  *toml.Tree
+	edits []textEdit
+	// appended new tables appended to the end of document
+	appended []string
+}
+
+var tomlBareKeyRegexp = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
+func newTOMLPatcher(cnt []byte) (*tomlPatcher, error) {
+	tree, err := toml.LoadBytes(cnt)
+	if err != nil {
+		return nil, errors.Wrap(err, "parse toml")
+	}
+
+	return &tomlPatcher{textLines: newTextLines(cnt), tree: tree}, nil
+}
+
+// patchTOML write settings into toml document,
+// only changed values are replaced, new keys are inserted into their tables.
+func patchTOML(cnt []byte, settings map[string]interface{}) ([]byte, error) {
+	p, err := newTOMLPatcher(cnt)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = p.patch(nil, nil, settings); err != nil {
+		return nil, err
+	}
+
+	buf := bytes.NewBuffer(applyEdits(cnt, p.edits))
+	for _, table := range p.appended {
+		if buf.Len() > 0 && !bytes.HasSuffix(buf.Bytes(), []byte("\n")) {
+			buf.WriteByte('\n')
+		}
+		buf.WriteString("\n" + table)
+	}
+
+	if _, err = toml.LoadBytes(buf.Bytes()); err != nil {
+		return nil, errors.Wrap(err, "patched toml is invalid")
+	}
+
+	return buf.Bytes(), nil
+}
+
+// patch write settings into table at path, tree is the table, nil for root
+func (p *tomlPatcher) patch(path []string, tree *toml.Tree, settings map[string]interface{}) error {
+	if tree == nil {
+		tree = p.tree
+	}
+
+	var newKeys []string
+	for _, key := range sortedKeys(settings) {
+		val := settings[key]
+		fileKey := ""
+		for _, k := range tree.Keys() {
+			if strings.EqualFold(k, key) {
+				fileKey = k
+				break
+			}
+		}
+
+		if fileKey == "" {
+			newKeys = append(newKeys, key)
+			continue
+		}
+
+		keyPath := append(append([]string{}, path...), fileKey)
+		fileVal := tree.GetPath([]string{fileKey})
+		if sub, ok := val.(map[string]interface{}); ok {
+			if subTree, ok := fileVal.(*toml.Tree); ok {
+				if err := p.patch(keyPath, subTree, sub); err != nil {
+					return err
+				}
+
+				continue
+			}
+		}
+
+		if settingsEqual(tomlToGo(fileVal), val) {
+			continue
+		}
+
+		if err := p.replaceValue(keyPath, tree.GetPositionPath([]string{fileKey}), val); err != nil {
+			return err
+		}
+	}
+
+	if len(newKeys) == 0 {
+		return nil
+	}
+
+	return p.insertKeys(path, newKeys, settings)
+}
+
+// tomlToGo convert value of toml tree to go value
+func tomlToGo(val interface{}) interface{} {
+	switch val := val.(type) {
+	case *toml.Tree:
+		return val.ToMap()
+	case []*toml.Tree:
+		list := make([]interface{}, 0, len(val))
+		for _, t := range val {
+			list = append(list, t.ToMap())
+		}
+
+		return list
+	}
+
+	return val
+}
+
+// offset byte offset of toml position
+func (p *tomlPatcher) offset(pos toml.Position) (int, bool) {
+	return p.offsetOf(pos.Line, pos.Col)
+}
+
+// replaceValue replace value of key at pos, comments after value are kept
+func (p *tomlPatcher) replaceValue(path []string, pos toml.Position, val interface{}) error {
+	text, err := encodeTOMLValue(val)
+	if err != nil {
+		return errors.Wrapf(err, "encode `%s`", strings.Join(path, "."))
+	}
+
+	start, end, err := p.valueRange(path, pos)
+	if err != nil {
+		return err
+	}
+
+	p.edits = append(p.edits, textEdit{start: start, end: end, text: text})
+	return nil
+}
+
+// valueRange find range of value of key at pos
+func (p *tomlPatcher) valueRange(path []string, pos toml.Position) (start, end int, err error) {
+	off, ok := p.offset(pos)
+	if !ok {
+		return 0, 0, errors.Errorf("unknown position of `%s`", strings.Join(path, "."))
+	}
+
+	// skip key to `=`, key may be quoted
+	var quote byte
+	for ; off < len(p.cnt); off++ {
+		c := p.cnt[off]
+		if quote != 0 {
+			if c == quote {
+				quote = 0
+			}
+			continue
+		}
+		if c == '"' || c == '\'' {
+			quote = c
+			continue
+		}
+		if c == '=' || c == '\n' || c == '[' {
+			break
+		}
+	}
+	if off >= len(p.cnt) || p.cnt[off] != '=' {
+		return 0, 0, errors.Errorf("`%s` is not a key-value", strings.Join(path, "."))
+	}
+
+	start = off + 1
+	for start < len(p.cnt) && (p.cnt[start] == ' ' || p.cnt[start] == '\t') {
+		start++
+	}
+
+	if end, ok = p.valueEnd(start); !ok {
+		return 0, 0, errors.Errorf("can not find value of `%s`", strings.Join(path, "."))
+	}
+
+	return start, end, nil
+}
+
+// valueEnd find end of value starts at start, the shortest lines which can be parsed,
+// then cut at comment.
+func (p *tomlPatcher) valueEnd(start int) (int, bool) {
+	for lineEnd := start; lineEnd <= len(p.cnt); lineEnd++ {
+		if lineEnd < len(p.cnt) && p.cnt[lineEnd] != '\n' {
+			continue
+		}
+		if !isTOMLValue(p.cnt[start:lineEnd]) {
+			continue
+		}
+
+		// cut at the first `#` which is not in value
+		lineBegin := bytes.LastIndexByte(p.cnt[:lineEnd], '\n') + 1
+		if lineBegin < start {
+			lineBegin = start
+		}
+		for i := lineBegin; i < lineEnd; i++ {
+			if p.cnt[i] == '#' && isTOMLValue(p.cnt[start:i]) {
+				return start + len(bytes.TrimRight(p.cnt[start:i], " \t")), true
+			}
+		}
+
+		return start + len(bytes.TrimRight(p.cnt[start:lineEnd], " \t\r")), true
+	}
+
+	return 0, false
+}
+
+func isTOMLValue(text []byte) bool {
+	if len(bytes.TrimSpace(text)) == 0 {
+		return false
+	}
+
+	_, err := toml.LoadBytes(append([]byte("v = "), text...))
+	return err == nil
+}
+
+// insertKeys insert new keys into table at path
+func (p *tomlPatcher) insertKeys(path []string, keys []string, settings map[string]interface{}) error {
+	var leaves, tables []string
+	for _, key := range keys {
+		if sub, ok := settings[key].(map[string]interface{}); ok {
+			table, err := encodeTOMLTable(append(append([]string{}, path...), key), sub)
+			if err != nil {
+				return err
+			}
+
+			tables = append(tables, table)
+			continue
+		}
+
+		text, err := encodeTOMLValue(settings[key])
+		if err != nil {
+			return errors.Wrapf(err, "encode `%s`", key)
+		}
+
+		leaves = append(leaves, tomlKey(key)+" = "+text+"\n")
+	}
+
+	p.appended = append(p.appended, tables...)
+	if len(leaves) == 0 {
+		return nil
+	}
+
+	off, err := p.tableEnd(path)
+	if err != nil {
+		return err
+	}
+
+	prefix := ""
+	if off > 0 && p.cnt[off-1] != '\n' {
+		prefix = "\n"
+	}
+
+	p.edits = append(p.edits, textEdit{start: off, end: off, text: prefix + strings.Join(leaves, "")})
+	return nil
+}
+
+// tableEnd offset to insert keys into table at path,
+// before the next table header and its leading comments.
+func (p *tomlPatcher) tableEnd(path []string) (int, error) {
+	headerLine := 0
+	if len(path) > 0 {
+		pos := p.tree.GetPositionPath(path)
+		off, ok := p.offset(pos)
+		if !ok || !tomlHeaderIs(p.cnt[off:], path) {
+			return 0, errors.Errorf("`%s` is not a table", strings.Join(path, "."))
+		}
+
+		headerLine = pos.Line
+	}
+
+	// the next table header after headerLine
+	next := len(p.lineStart)
+	for line := headerLine + 1; line <= len(p.lineStart); line++ {
+		if bytes.HasPrefix(bytes.TrimLeft(p.line(line), " \t"), []byte("[")) {
+			if off, ok := p.offset(toml.Position{Line: line, Col: 1}); ok && p.inValue(off) {
+				continue
+			}
+
+			next = line - 1
+			break
+		}
+	}
+
+	// skip comments and blank lines before the next header
+	for next > headerLine {
+		trimmed := bytes.TrimSpace(p.line(next))
+		if len(trimmed) != 0 && trimmed[0] != '#' {
+			break
+		}
+
+		next--
+	}
+
+	if next == 0 {
+		return 0, nil
+	}
+	if next >= len(p.lineStart) {
+		return len(p.cnt), nil
+	}
+
+	return p.lineStart[next], nil
+}
+
+// inValue whether offset is inside a multi-line value
+func (p *tomlPatcher) inValue(off int) bool {
+	_, err := toml.LoadBytes(p.cnt[:off])
+	return err != nil
+}
+
+// tomlHeaderIs whether text starts with table header of path
+func tomlHeaderIs(text []byte, path []string) bool {
+	if i := bytes.IndexByte(text, '\n'); i >= 0 {
+		text = text[:i]
+	}
+
+	text = bytes.TrimSpace(text)
+	if !bytes.HasPrefix(text, []byte("[")) || bytes.HasPrefix(text, []byte("[[")) {
+		return false
+	}
+
+	tree, err := toml.LoadBytes(text)
+	if err != nil {
+		return false
+	}
+
+	_, ok := tree.GetPath(path).(*toml.Tree)
+	return ok
+}
+
+// encodeTOMLValue encode value as inline toml
+func encodeTOMLValue(val interface{}) (string, error) {
+	tree, err := toml.TreeFromMap(map[string]interface{}{"v": val})
+	if err != nil {
+		return "", err
+	}
+
+	text, err := tree.ToTomlString()
+	if err != nil {
+		return "", err
+	}
+
+	text = strings.TrimSpace(text)
+	if !strings.HasPrefix(text, "v = ") {
+		return "", errors.Errorf("can not encode `%T` as inline value", val)
+	}
+
+	return strings.TrimPrefix(text, "v = "), nil
+}
+
+// encodeTOMLTable encode settings as table at path, sub tables follow it,
+// header of table without values is omitted.
+func encodeTOMLTable(path []string, settings map[string]interface{}) (string, error) {
+	var leaves, tables []string
+	for _, key := range sortedKeys(settings) {
+		if sub, ok := settings[key].(map[string]interface{}); ok {
+			table, err := encodeTOMLTable(append(append([]string{}, path...), key), sub)
+			if err != nil {
+				return "", err
+			}
+
+			tables = append(tables, table)
+			continue
+		}
+
+		text, err := encodeTOMLValue(settings[key])
+		if err != nil {
+			return "", errors.Wrapf(err, "encode `%s`", key)
+		}
+
+		leaves = append(leaves, tomlKey(key)+" = "+text+"\n")
+	}
+
+	if len(leaves) == 0 && len(tables) != 0 {
+		return strings.Join(tables, "\n"), nil
+	}
+
+	keys := make([]string, 0, len(path))
+	for _, k := range path {
+		keys = append(keys, tomlKey(k))
+	}
+
+	table := "[" + strings.Join(keys, ".") + "]\n" + strings.Join(leaves, "")
+	for _, sub := range tables {
+		table += "\n" + sub
+	}
+
+	return table, nil
+}
+
+// tomlKey quote key if it is not a bare key
+func tomlKey(key string) string {
+	if tomlBareKeyRegexp.MatchString(key) {
+		return key
+	}
+
+	return strconv.Quote(key)
+}
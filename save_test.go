@@ -0,0 +1,333 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/Laisky/go-utils/v2/encrypt"
+	"github.com/stretchr/testify/require"
+)
+
+func TestConfig_Save(t *testing.T) {
+	dir := t.TempDir()
+
+	t.Run("yaml", func(t *testing.T) {
+		fpath := filepath.Join(dir, "settings.yml")
+		require.NoError(t, os.WriteFile(fpath, []byte(`# app settings
+name: app        # app name
+timeout: '3s'    # quoted
+
+db:
+  # database
+  port: 3306     # db port
+  host: localhost
+
+tags: [a, b]
+`), 0600))
+
+		cfg := New()
+		require.NoError(t, cfg.LoadFromFile(fpath))
+		cfg.Set("db.port", 5432)
+		cfg.Set("db.user", "root")
+		cfg.Set("debug", true)
+		cfg.Set("timeout", "5s")
+		cfg.Set("cache.redis.addr", "localhost:6379")
+		require.NoError(t, cfg.Save(fpath))
+
+		cnt, err := os.ReadFile(fpath)
+		require.NoError(t, err)
+		require.Equal(t, `# app settings
+name: app        # app name
+timeout: '5s'    # quoted
+
+db:
+  # database
+  port: 5432     # db port
+  host: localhost
+  user: root
+
+tags: [a, b]
+cache:
+  redis:
+    addr: localhost:6379
+debug: true
+`, string(cnt))
+
+		fi, err := os.Stat(fpath)
+		require.NoError(t, err)
+		require.Equal(t, os.FileMode(0600), fi.Mode().Perm())
+	})
+
+	t.Run("toml", func(t *testing.T) {
+		fpath := filepath.Join(dir, "settings.toml")
+		require.NoError(t, os.WriteFile(fpath, []byte(`# app settings
+name = "app" # app name
+ports = [
+  80, # http
+  443,
+]
+
+# database
+[db]
+port = 3306
+host = "localhost"
+
+[log]
+level = "info"
+`), 0644))
+
+		cfg := New()
+		require.NoError(t, cfg.LoadFromFile(fpath))
+		cfg.Set("db.port", 5432)
+		cfg.Set("db.user", "root")
+		cfg.Set("ports", []int{8080})
+		cfg.Set("debug", true)
+		cfg.Set("cache.redis.addr", "localhost:6379")
+		require.NoError(t, cfg.Save(fpath, WithSaveOverridesOnly()))
+
+		cnt, err := os.ReadFile(fpath)
+		require.NoError(t, err)
+		require.Equal(t, `# app settings
+name = "app" # app name
+ports = [8080]
+debug = true
+
+# database
+[db]
+port = 5432
+host = "localhost"
+user = "root"
+
+[log]
+level = "info"
+
+[cache.redis]
+addr = "localhost:6379"
+`, string(cnt))
+
+		reloaded := New()
+		require.NoError(t, reloaded.LoadFromFile(fpath))
+		require.Equal(t, []int{8080}, reloaded.GetIntSlice("ports"))
+		require.Equal(t, 5432, reloaded.GetInt("db.port"))
+		require.Equal(t, "localhost:6379", reloaded.GetString("cache.redis.addr"))
+	})
+
+	t.Run("json", func(t *testing.T) {
+		fpath := filepath.Join(dir, "settings.json")
+		require.NoError(t, os.WriteFile(fpath, []byte(`{"name": "app", "db": {"port": 3306}}`), 0644))
+
+		cfg := New()
+		cfg.Set("db.port", 5432)
+		require.NoError(t, cfg.Save(fpath, WithSaveOverridesOnly()))
+
+		cnt, err := os.ReadFile(fpath)
+		require.NoError(t, err)
+		require.JSONEq(t, `{"name": "app", "db": {"port": 5432}}`, string(cnt))
+	})
+
+	t.Run("not exists", func(t *testing.T) {
+		fpath := filepath.Join(dir, "new.yml")
+
+		cfg := New()
+		cfg.Set("name", "app")
+		require.NoError(t, cfg.Save(fpath))
+
+		reloaded := New()
+		require.NoError(t, reloaded.LoadFromFile(fpath))
+		require.Equal(t, "app", reloaded.GetString("name"))
+	})
+
+	t.Run("encrypted", func(t *testing.T) {
+		secret := []byte("01234567890123456789012345678901")
+		fpath := filepath.Join(dir, "secret.yml.enc")
+
+		cfg := New()
+		cfg.Set("password", "123")
+		require.Error(t, cfg.Save(fpath))
+		require.NoError(t, cfg.Save(fpath, WithAesEncrypt(secret)))
+
+		cnt, err := os.ReadFile(fpath)
+		require.NoError(t, err)
+		require.NotContains(t, string(cnt), "password")
+
+		cfg.Set("user", "root")
+		require.NoError(t, cfg.Save(fpath, WithAesEncrypt(secret)))
+
+		reloaded := New()
+		require.NoError(t, reloaded.LoadFromFile(fpath, WithAesEncrypt(secret)))
+		require.Equal(t, "123", reloaded.GetString("password"))
+		require.Equal(t, "root", reloaded.GetString("user"))
+	})
+
+	t.Run("encrypted include", func(t *testing.T) {
+		secret := []byte("01234567890123456789012345678901")
+		dir := t.TempDir()
+		fpath := filepath.Join(dir, "settings.yml")
+		require.NoError(t, os.WriteFile(fpath, []byte("include: secret.yml.enc\nname: app\ndb:\n  host: localhost\n"), 0600))
+		encrypted, err := encrypt.EncryptByAes(secret, []byte("db:\n  password: p@ss\n"))
+		require.NoError(t, err)
+		require.NoError(t, os.WriteFile(filepath.Join(dir, "secret.yml.enc"), encrypted, 0600))
+
+		t.Setenv("TESTSAVE_DB_HOST", "remote")
+		cfg := New()
+		require.NoError(t, cfg.LoadFromEnv("TESTSAVE"))
+		require.NoError(t, cfg.LoadFromFile(fpath, WithEnableInclude(), WithAesEncrypt(secret)))
+		require.Equal(t, "p@ss", cfg.GetString("db.password"))
+		require.Equal(t, "remote", cfg.GetString("db.host"))
+
+		cfg.Set("debug", true)
+		require.NoError(t, cfg.Save(fpath))
+		cnt, err := os.ReadFile(fpath)
+		require.NoError(t, err)
+		require.Equal(t, "include: secret.yml.enc\nname: app\ndb:\n  host: localhost\ndebug: true\n", string(cnt))
+
+		out := filepath.Join(dir, "out.yml")
+		require.NoError(t, cfg.SaveAs(out))
+		cnt, err = os.ReadFile(out)
+		require.NoError(t, err)
+		require.NotContains(t, string(cnt), "p@ss")
+		require.NotContains(t, string(cnt), "remote")
+		require.Contains(t, string(cnt), "localhost")
+	})
+
+	t.Run("appended include list", func(t *testing.T) {
+		dir := t.TempDir()
+		fpath := filepath.Join(dir, "settings.yml")
+		origin := "include: base.yml\nbrokers:\n  - b\n"
+		require.NoError(t, os.WriteFile(fpath, []byte(origin), 0600))
+		require.NoError(t, os.WriteFile(filepath.Join(dir, "base.yml"), []byte("brokers:\n  - a\n"), 0600))
+
+		for i := 0; i < 2; i++ {
+			cfg := New()
+			require.NoError(t, cfg.LoadFromFile(fpath,
+				WithEnableInclude(), WithMergeStrategy("brokers", MergeAppend)))
+			require.Equal(t, []string{"a", "b"}, cfg.GetStringSlice("brokers"))
+			require.NoError(t, cfg.Save(fpath))
+
+			cnt, err := os.ReadFile(fpath)
+			require.NoError(t, err)
+			require.Equal(t, origin, string(cnt))
+		}
+	})
+
+	t.Run("migrated keys", func(t *testing.T) {
+		fpath := filepath.Join(t.TempDir(), "settings.yml")
+		origin := "addr: localhost\nname: app\n"
+		require.NoError(t, os.WriteFile(fpath, []byte(origin), 0600))
+
+		cfg := newMigratedConfig(t)
+		require.NoError(t, cfg.LoadFromFile(fpath))
+		require.Equal(t, "localhost", cfg.GetString("db.host"))
+		require.NoError(t, cfg.Save(fpath))
+
+		cnt, err := os.ReadFile(fpath)
+		require.NoError(t, err)
+		require.Equal(t, origin, string(cnt))
+	})
+
+	t.Run("can not preserve comments", func(t *testing.T) {
+		fpath := filepath.Join(dir, "settings.jsonc")
+		origin := []byte("{\n  // app name\n  \"name\": \"app\",\n}\n")
+		require.NoError(t, os.WriteFile(fpath, origin, 0644))
+
+		cfg := New()
+		cfg.Set("name", "new")
+		require.ErrorContains(t, cfg.Save(fpath), "can not preserve comments")
+
+		cnt, err := os.ReadFile(fpath)
+		require.NoError(t, err)
+		require.Equal(t, origin, cnt)
+	})
+
+	// no temp files left
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	for _, entry := range entries {
+		require.NotEqual(t, '.', entry.Name()[0], entry.Name())
+	}
+}
+
+func TestConfig_SaveAs(t *testing.T) {
+	dir := t.TempDir()
+	fpath := filepath.Join(dir, "settings.yml")
+	require.NoError(t, os.WriteFile(fpath, []byte("name: app\ndb:\n  port: 3306\n"), 0644))
+
+	cfg := New()
+	require.NoError(t, cfg.LoadFromFile(fpath))
+	cfg.Set("db.port", 5432)
+
+	for _, name := range []string{"out.json", "out.toml", "out.yaml"} {
+		t.Run(name, func(t *testing.T) {
+			out := filepath.Join(dir, name)
+			require.NoError(t, cfg.SaveAs(out))
+
+			reloaded := New()
+			require.NoError(t, reloaded.LoadFromFile(out))
+			require.Equal(t, "app", reloaded.GetString("name"))
+			require.Equal(t, 5432, reloaded.GetInt("db.port"))
+		})
+	}
+
+	t.Run("overrides only", func(t *testing.T) {
+		out := filepath.Join(dir, "overrides.yml")
+		require.NoError(t, os.WriteFile(out, []byte("old: true\n"), 0644))
+		require.NoError(t, cfg.SaveAs(out, WithSaveOverridesOnly()))
+
+		cnt, err := os.ReadFile(out)
+		require.NoError(t, err)
+		require.Equal(t, "db:\n    port: 5432\n", string(cnt))
+	})
+
+	t.Run("format", func(t *testing.T) {
+		out := filepath.Join(dir, "config")
+		require.Error(t, cfg.SaveAs(out))
+		require.NoError(t, cfg.SaveAs(out, WithFormat("json")))
+
+		reloaded := New()
+		require.NoError(t, reloaded.LoadFromFile(out))
+		require.Equal(t, 5432, reloaded.GetInt("db.port"))
+	})
+
+	t.Run("unsupported format", func(t *testing.T) {
+		require.Error(t, cfg.SaveAs(filepath.Join(dir, "out.hcl2")))
+	})
+}
+
+func TestPatchYAML(t *testing.T) {
+	for _, c := range []struct {
+		name, cnt, expected string
+		settings            map[string]interface{}
+	}{
+		{
+			name:     "flow mapping",
+			cnt:      "db: {host: localhost}   # db\nname: app\n",
+			settings: map[string]interface{}{"db": map[string]interface{}{"port": 3306}},
+			expected: "db: {host: localhost, port: 3306}   # db\nname: app\n",
+		},
+		{
+			name:     "block to scalar",
+			cnt:      "tags:\n  - a\n  - b\n\n# name\nname: app\n",
+			settings: map[string]interface{}{"tags": "none"},
+			expected: "tags: none\n\n# name\nname: app\n",
+		},
+		{
+			name:     "empty value",
+			cnt:      "name:\nport: 80",
+			settings: map[string]interface{}{"name": "app", "debug": true},
+			expected: "name: app\nport: 80\ndebug: true\n",
+		},
+		{
+			name:     "only comments",
+			cnt:      "# empty",
+			settings: map[string]interface{}{"name": "app"},
+			expected: "# empty\nname: app\n",
+		},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			cnt, err := patchYAML([]byte(c.cnt), c.settings)
+			require.NoError(t, err)
+			require.Equal(t, c.expected, string(cnt))
+		})
+	}
+}
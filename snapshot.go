@@ -0,0 +1,294 @@
+package config
+
+import (
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/spf13/pflag"
+	"github.com/spf13/viper"
+)
+
+// snapshot immutable settings of all layers, published by `rebuild`.
+//
+// all fields must not be modified after published,
+// except vipers built lazily once, so it can be read without lock.
+type snapshot struct {
+	// v viper of all layers, except settings by `SetDefault` and `Set`,
+	// keys patched by them are read from lazily built vipers, see `viperOf`
+	v   *viper.Viper
+	rev uint64
+
+	groups    [LayerOverride + 1][]*layerGroup
+	defaults  []keyValue
+	overrides []keyValue
+	// patched keys of defaults and overrides, see `patchKey`,
+	// shared by all snapshots of the same config
+	patched    *sync.Map
+	flagsets   []*pflag.FlagSet
+	envPrefix  string
+	envEnabled bool
+	strict     bool
+	// versioned whether migrations registered, key `version` is used by migrations
+	versioned  bool
+	deprecated map[string]deprecatedKey
+	// deprecatedWarned shared by all snapshots of the same config
+	deprecatedWarned *sync.Map
+
+	// overridden viper only contains settings by `Set`
+	overridden lazyViper
+	// merged viper of all layers
+	merged lazyViper
+}
+
+// lazyViper viper built once on first use
+type lazyViper struct {
+	once sync.Once
+	v    *viper.Viper
+}
+
+func (l *lazyViper) load(build func() *viper.Viper) *viper.Viper {
+	l.once.Do(func() {
+		l.v = build()
+	})
+
+	return l.v
+}
+
+// overriddenViper viper only contains settings by `Set`
+func (s *snapshot) overriddenViper() *viper.Viper {
+	return s.overridden.load(func() *viper.Viper {
+		v := viper.New()
+		for _, kv := range s.overrides {
+			v.Set(kv.key, kv.val)
+		}
+
+		return v
+	})
+}
+
+// mergedViper viper of all layers, including settings by `SetDefault` and `Set`
+func (s *snapshot) mergedViper() *viper.Viper {
+	if len(s.defaults) == 0 && len(s.overrides) == 0 {
+		return s.v
+	}
+
+	return s.merged.load(func() *viper.Viper {
+		v, err := s.newViper()
+		if err != nil {
+			// never happens, s.v is built from the same settings
+			return s.v
+		}
+
+		s.patch(v)
+		return v
+	})
+}
+
+// viperOf viper to read key from
+//
+// keys not patched by `SetDefault` and `Set` are read from s.v directly,
+// keys set by `Set` are read from overriddenViper, since overrides have
+// the highest priority. others, like keys shadowed by or
+// defaulted by `SetDefault`, are read from mergedViper.
+func (s *snapshot) viperOf(key string) *viper.Viper {
+	if len(s.defaults) == 0 && len(s.overrides) == 0 ||
+		!s.isPatched(strings.ToLower(key)) {
+		return s.v
+	}
+
+	if v := s.overriddenViper(); v.IsSet(key) {
+		return v
+	}
+
+	return s.mergedViper()
+}
+
+// isPatched whether key, its children or its parents are patched in this snapshot
+func (s *snapshot) isPatched(key string) bool {
+	if pk, ok := s.patched.Load(key); ok {
+		if pk := pk.(patchedKey); pk.leaf <= s.rev || pk.parent <= s.rev {
+			return true
+		}
+	}
+
+	for i := strings.LastIndex(key, "."); i > 0; i = strings.LastIndex(key[:i], ".") {
+		if pk, ok := s.patched.Load(key[:i]); ok && pk.(patchedKey).leaf <= s.rev {
+			return true
+		}
+	}
+
+	return false
+}
+
+// load get the latest snapshot
+func (s *config) load() *snapshot {
+	return s.snap.Load().(*snapshot)
+}
+
+// Snapshot return a consistent read-only view of current settings
+//
+// the view is never changed by later reloads or `Set`,
+// use it to read settings consistently in a whole request.
+// reading from snapshot or config is lock-free.
+func (s *config) Snapshot() Reader {
+	return s.load()
+}
+
+// Namespace return read-only view of settings under prefix in this snapshot
+func (s *snapshot) Namespace(prefix string) Reader {
+	return newNamespace(s, prefix)
+}
+
+func (s *snapshot) revision() uint64 {
+	return s.rev
+}
+
+func (s *snapshot) lookup(key string) (interface{}, bool) {
+	key = s.resolveKey(key)
+	v := s.viperOf(key)
+	if !v.IsSet(key) {
+		return nil, false
+	}
+
+	return v.Get(key), true
+}
+
+// Get get setting by key
+func (s *snapshot) Get(key string) interface{} {
+	key = s.resolveKey(key)
+	return s.viperOf(key).Get(key)
+}
+
+// GetString get setting by key
+func (s *snapshot) GetString(key string) string {
+	key = s.resolveKey(key)
+	return s.viperOf(key).GetString(key)
+}
+
+// GetStringSlice get setting by key
+func (s *snapshot) GetStringSlice(key string) []string {
+	key = s.resolveKey(key)
+	return s.viperOf(key).GetStringSlice(key)
+}
+
+// GetBool get setting by key
+func (s *snapshot) GetBool(key string) bool {
+	key = s.resolveKey(key)
+	return s.viperOf(key).GetBool(key)
+}
+
+// GetInt get setting by key
+func (s *snapshot) GetInt(key string) int {
+	key = s.resolveKey(key)
+	return s.viperOf(key).GetInt(key)
+}
+
+// GetInt64 get setting by key
+func (s *snapshot) GetInt64(key string) int64 {
+	key = s.resolveKey(key)
+	return s.viperOf(key).GetInt64(key)
+}
+
+// GetDuration get setting by key
+func (s *snapshot) GetDuration(key string) time.Duration {
+	key = s.resolveKey(key)
+	return s.viperOf(key).GetDuration(key)
+}
+
+// GetFloat64 get setting by key
+func (s *snapshot) GetFloat64(key string) float64 {
+	key = s.resolveKey(key)
+	return s.viperOf(key).GetFloat64(key)
+}
+
+// GetUint get setting by key
+func (s *snapshot) GetUint(key string) uint {
+	key = s.resolveKey(key)
+	return s.viperOf(key).GetUint(key)
+}
+
+// GetUint32 get setting by key
+func (s *snapshot) GetUint32(key string) uint32 {
+	key = s.resolveKey(key)
+	return s.viperOf(key).GetUint32(key)
+}
+
+// GetUint64 get setting by key
+func (s *snapshot) GetUint64(key string) uint64 {
+	key = s.resolveKey(key)
+	return s.viperOf(key).GetUint64(key)
+}
+
+// GetTime get setting by key
+func (s *snapshot) GetTime(key string) time.Time {
+	key = s.resolveKey(key)
+	return s.viperOf(key).GetTime(key)
+}
+
+// GetIntSlice get setting by key
+func (s *snapshot) GetIntSlice(key string) []int {
+	key = s.resolveKey(key)
+	return s.viperOf(key).GetIntSlice(key)
+}
+
+// GetSizeInBytes get size setting by key, like `10mb` or `1 GB`
+func (s *snapshot) GetSizeInBytes(key string) uint {
+	key = s.resolveKey(key)
+	return s.viperOf(key).GetSizeInBytes(key)
+}
+
+// GetStringMap return map contains interface
+func (s *snapshot) GetStringMap(key string) map[string]interface{} {
+	key = s.resolveKey(key)
+	return s.viperOf(key).GetStringMap(key)
+}
+
+// GetStringMapString return map contains strings
+func (s *snapshot) GetStringMapString(key string) map[string]string {
+	key = s.resolveKey(key)
+	return s.viperOf(key).GetStringMapString(key)
+}
+
+// AllKeys get all keys of settings, nested keys are joined by `.`
+func (s *snapshot) AllKeys() []string {
+	return s.mergedViper().AllKeys()
+}
+
+// AllSettings get all settings as nested map
+func (s *snapshot) AllSettings() map[string]interface{} {
+	return s.mergedViper().AllSettings()
+}
+
+// InConfig check whether key is set by file or remote settings
+//
+// file and remote settings are never patched, so always read from s.v.
+func (s *snapshot) InConfig(key string) bool {
+	return s.v.InConfig(s.resolveKey(key))
+}
+
+// IsSet check whether exists
+func (s *snapshot) IsSet(key string) bool {
+	key = s.resolveKey(key)
+	return s.viperOf(key).IsSet(key)
+}
+
+// Unmarshal unmarshals all settings into obj
+func (s *snapshot) Unmarshal(obj interface{}) error {
+	return s.unmarshal("", obj, false)
+}
+
+// UnmarshalKey unmarshals settings under key into obj
+func (s *snapshot) UnmarshalKey(key string, obj interface{}) error {
+	return s.unmarshal(key, obj, false)
+}
+
+// UnmarshalStrict like `Unmarshal`, but reject unknown keys
+func (s *snapshot) UnmarshalStrict(obj interface{}) error {
+	return s.unmarshal("", obj, true)
+}
+
+// UnmarshalKeyStrict like `UnmarshalKey`, but reject unknown keys
+func (s *snapshot) UnmarshalKeyStrict(key string, obj interface{}) error {
+	return s.unmarshal(key, obj, true)
+}
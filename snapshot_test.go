@@ -0,0 +1,147 @@
+package config
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	gutils "github.com/Laisky/go-utils/v2"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/sync/errgroup"
+)
+
+func TestConfig_Snapshot(t *testing.T) {
+	fpath := filepath.Join(t.TempDir(), "settings.yml")
+	require.NoError(t, os.WriteFile(fpath, []byte("db: {host: localhost, port: 3306}\n"), 0644))
+
+	cfg := New()
+	require.NoError(t, cfg.LoadFromFile(fpath))
+
+	snap := cfg.Snapshot()
+	require.Equal(t, "localhost", snap.GetString("db.host"))
+
+	cfg.Set("db.host", "override")
+	cfg.SetDefault("db.user", "root")
+	require.NoError(t, os.WriteFile(fpath, []byte("db: {host: localhost, port: 3307}\n"), 0644))
+	require.NoError(t, cfg.ReloadLayer(LayerFile))
+
+	// snapshot is not changed
+	require.Equal(t, "localhost", snap.GetString("db.host"))
+	require.Equal(t, 3306, snap.GetInt("db.port"))
+	require.False(t, snap.IsSet("db.user"))
+	exp, err := snap.Explain("db.host")
+	require.NoError(t, err)
+	require.Equal(t, LayerFile, exp.Layer)
+
+	db := snap.Namespace("db")
+	require.Equal(t, 3306, db.GetInt("port"))
+	var st struct {
+		Host string `mapstructure:"host"`
+		Port int    `mapstructure:"port"`
+	}
+	require.NoError(t, db.UnmarshalStrict(&st))
+	require.Equal(t, 3306, st.Port)
+
+	// config reads the latest
+	require.Equal(t, "override", cfg.GetString("db.host"))
+	require.Equal(t, 3307, cfg.GetInt("db.port"))
+	require.Equal(t, "root", cfg.GetString("db.user"))
+	exp, err = cfg.Explain("db.host")
+	require.NoError(t, err)
+	require.Equal(t, LayerOverride, exp.Layer)
+
+	latest := cfg.Snapshot()
+	require.Equal(t, "override", latest.GetString("db.host"))
+	require.NotEqual(t, snap.(*snapshot).rev, latest.(*snapshot).rev)
+}
+
+func TestConfig_SnapshotConcurrent(t *testing.T) {
+	cfg := New()
+	var pool errgroup.Group
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	for i := 0; i < 4; i++ {
+		pool.Go(func() error {
+			for ctx.Err() == nil {
+				snap := cfg.Snapshot()
+				// values set together are always consistent in snapshot
+				if a, b := snap.GetInt("a"), snap.GetInt("b"); a != b && a != b+1 {
+					return fmt.Errorf("inconsistent a=%d b=%d", a, b)
+				}
+				_ = cfg.GetString("a")
+				_ = cfg.IsSet("b")
+			}
+
+			return nil
+		})
+	}
+
+	for i := 0; i < 200; i++ {
+		cfg.Set("a", i)
+		cfg.Set("b", i)
+	}
+	cancel()
+
+	require.NoError(t, pool.Wait())
+	require.Equal(t, 199, cfg.GetInt("b"))
+}
+
+// TestConfig_SnapshotPatched keys patched by `Set` and `SetDefault`
+// are read the same as a viper with all settings merged
+func TestConfig_SnapshotPatched(t *testing.T) {
+	fpath := filepath.Join(t.TempDir(), "settings.yml")
+	require.NoError(t, os.WriteFile(fpath, []byte(gutils.Dedent(`
+		db:
+		  host: localhost
+		  port: 3306
+		redis:
+		  addr: localhost:6379
+		log: debug`)), 0644))
+
+	cfg := New()
+	require.NoError(t, cfg.LoadFromFile(fpath))
+	v := viper.New()
+	v.SetConfigFile(fpath)
+	require.NoError(t, v.ReadInConfig())
+
+	for _, c := range []struct {
+		set bool
+		key string
+		val interface{}
+	}{
+		{true, "db.host", "override"},
+		{true, "redis", "shadowed"},
+		{true, "mq", map[string]interface{}{"Addr": "localhost:5672"}},
+		{false, "db.user", "root"},
+		{false, "db.port", 3307},
+		{false, "cache.ttl", "1m"},
+		{true, "log.level", "info"},
+	} {
+		if c.set {
+			cfg.Set(c.key, c.val)
+			v.Set(c.key, c.val)
+		} else {
+			cfg.SetDefault(c.key, c.val)
+			v.SetDefault(c.key, c.val)
+		}
+	}
+
+	for _, key := range []string{
+		"db", "db.host", "db.port", "db.user", "db.password",
+		"redis", "redis.addr", "mq", "mq.addr", "cache", "cache.ttl",
+		"log", "log.level",
+	} {
+		require.Equal(t, v.Get(key), cfg.Get(key), key)
+		require.Equal(t, v.IsSet(key), cfg.IsSet(key), key)
+		require.Equal(t, v.InConfig(key), cfg.InConfig(key), key)
+	}
+
+	require.ElementsMatch(t, v.AllKeys(), cfg.AllKeys())
+	require.Equal(t, v.AllSettings(), cfg.AllSettings())
+	require.Equal(t, time.Minute, cfg.GetDuration("cache.ttl"))
+}
@@ -0,0 +1,112 @@
+package config
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/mitchellh/mapstructure"
+	"github.com/pkg/errors"
+)
+
+// strictIgnoredKeys keys used by this library itself, never reported as unknown.
+// `version` is only ignored if migrations registered, see `isStrictIgnored`.
+var strictIgnoredKeys = map[string]bool{
+	settingsIncludeKey: true,
+}
+
+// SetStrict enable or disable strict mode
+//
+// in strict mode, `Unmarshal` and `UnmarshalKey` behave like
+// `UnmarshalStrict` and `UnmarshalKeyStrict`,
+// and loading settings that contain deprecated keys returns error.
+func (s *config) SetStrict(strict bool) {
+	s.Lock()
+	defer s.Unlock()
+
+	s.strict = strict
+	s.republish()
+}
+
+// UnmarshalStrict like `Unmarshal`, but return error if there are keys
+// in file or remote settings that are not mapped to any field of obj.
+//
+// `mapstructure`'s `squash` and `remain` are respected.
+func (s *config) UnmarshalStrict(obj interface{}) error {
+	return s.load().UnmarshalStrict(obj)
+}
+
+// UnmarshalKeyStrict like `UnmarshalKey`, but return error if there are keys
+// in file or remote settings that are not mapped to any field of obj.
+func (s *config) UnmarshalKeyStrict(key string, obj interface{}) error {
+	return s.load().UnmarshalKeyStrict(key, obj)
+}
+
+// unmarshal unmarshal settings under key into obj, key is empty means all settings
+func (s *snapshot) unmarshal(key string, obj interface{}, strict bool) (err error) {
+	md := new(mapstructure.Metadata)
+	withMetadata := func(c *mapstructure.DecoderConfig) {
+		c.Metadata = md
+	}
+
+	strict = strict || s.strict
+	if key != "" {
+		key = s.resolveKey(key)
+	}
+	if key == "" {
+		err = s.mergedViper().Unmarshal(obj, withMetadata)
+	} else {
+		err = s.mergedViper().UnmarshalKey(key, obj, withMetadata)
+	}
+
+	var unknown []string
+	if err == nil && strict {
+		unknown = s.unknownKeys(key, md.Unused)
+	}
+
+	if err != nil {
+		return s.annotateError(err, key)
+	}
+
+	if len(unknown) != 0 {
+		return errors.Errorf("unknown keys: %s", strings.Join(unknown, ", "))
+	}
+
+	return nil
+}
+
+// isStrictIgnored whether key is used by this library itself
+func (s *snapshot) isStrictIgnored(key string) bool {
+	return strictIgnoredKeys[key] || (key == settingsVersionKey && s.versioned)
+}
+
+// unknownKeys describe unused keys that come from file or remote layers
+func (s *snapshot) unknownKeys(prefix string, unused []string) (unknown []string) {
+	sort.Strings(unused)
+	for _, key := range unused {
+		key = strings.ToLower(key)
+		if prefix != "" {
+			key = joinKey(prefix, key)
+		}
+		if s.isStrictIgnored(key) {
+			continue
+		}
+
+		exp, err := s.explain(key)
+		if err != nil {
+			// key contains `.` is split by viper, like `a.b` in `{"a.b": 1}`
+			unknown = append(unknown, fmt.Sprintf("`%s`", key))
+			continue
+		}
+
+		switch exp.Layer {
+		case LayerFile:
+			pos := Position{File: exp.Source, Line: exp.Line, Column: exp.Column}
+			unknown = append(unknown, fmt.Sprintf("`%s` (%s)", key, pos))
+		case LayerRemote:
+			unknown = append(unknown, fmt.Sprintf("`%s` (%s)", key, exp.Source))
+		}
+	}
+
+	return unknown
+}
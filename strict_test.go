@@ -0,0 +1,126 @@
+package config
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	gutils "github.com/Laisky/go-utils/v2"
+	"github.com/spf13/pflag"
+	"github.com/stretchr/testify/require"
+)
+
+func TestConfig_UnmarshalStrict(t *testing.T) {
+	dir := t.TempDir()
+	entry := filepath.Join(dir, "settings.yml")
+	require.NoError(t, os.WriteFile(entry, []byte(gutils.Dedent(`
+		include: extra.yml
+		name: app
+		retires: 3
+		db:
+		  host: localhost
+		  hots: typo
+		labels:
+		  a: b
+		extra:
+		  x: 1
+	`)), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "extra.yml"), []byte("unknown_included: 1\n"), 0644))
+
+	cfg := New()
+	require.NoError(t, cfg.LoadFromFile(entry))
+
+	// keys from flags are never reported
+	fs := pflag.NewFlagSet("test", pflag.ContinueOnError)
+	fs.String("config", "", "")
+	require.NoError(t, cfg.BindPFlags(fs))
+
+	type DB struct {
+		Host string `mapstructure:"host"`
+	}
+	type Base struct {
+		Name string `mapstructure:"name"`
+	}
+	type settings struct {
+		Base   `mapstructure:",squash"`
+		DB     DB                     `mapstructure:"db"`
+		Labels map[string]string      `mapstructure:"labels"`
+		Remain map[string]interface{} `mapstructure:",remain"`
+	}
+	type settingsWithoutRemain struct {
+		Base   `mapstructure:",squash"`
+		DB     DB                `mapstructure:"db"`
+		Labels map[string]string `mapstructure:"labels"`
+	}
+
+	t.Run("remain", func(t *testing.T) {
+		// remain only collects unknown keys at its own level
+		var st settings
+		err := cfg.UnmarshalStrict(&st)
+		require.Error(t, err)
+		require.Equal(t, "unknown keys: `db.hots` ("+entry+":6:3)", err.Error())
+		require.Equal(t, "app", st.Name)
+		require.Contains(t, st.Remain, "retires")
+	})
+
+	t.Run("version", func(t *testing.T) {
+		fpath := filepath.Join(t.TempDir(), "settings.yml")
+		require.NoError(t, os.WriteFile(fpath, []byte("name: app\nversion: 3\n"), 0644))
+
+		// version is an ordinary setting without migrations
+		cfg := New()
+		require.NoError(t, cfg.LoadFromFile(fpath))
+		var st Base
+		require.ErrorContains(t, cfg.UnmarshalStrict(&st), "unknown keys: `version`")
+
+		require.NoError(t, cfg.RegisterMigration(2, func(settings map[string]interface{}) (map[string]interface{}, error) {
+			return settings, nil
+		}))
+		require.NoError(t, cfg.UnmarshalStrict(&st))
+	})
+
+	t.Run("unknown", func(t *testing.T) {
+		var st settingsWithoutRemain
+		require.NoError(t, cfg.Unmarshal(&st))
+
+		err := cfg.UnmarshalStrict(&st)
+		require.Error(t, err)
+		require.Equal(t, "unknown keys: "+
+			"`db.hots` ("+entry+":6:3), "+
+			"`extra` ("+entry+":9:1), "+
+			"`retires` ("+entry+":3:1), "+
+			"`unknown_included` ("+filepath.Join(dir, "extra.yml")+":1:1)",
+			err.Error())
+	})
+
+	t.Run("key", func(t *testing.T) {
+		var db DB
+		err := cfg.UnmarshalKeyStrict("db", &db)
+		require.Error(t, err)
+		require.Equal(t, "unknown keys: `db.hots` ("+entry+":6:3)", err.Error())
+	})
+
+	t.Run("strict mode", func(t *testing.T) {
+		cfg := New()
+		require.NoError(t, cfg.LoadFromFile(entry))
+		cfg.SetStrict(true)
+
+		var db DB
+		require.Error(t, cfg.UnmarshalKey("db", &db))
+		cfg.SetStrict(false)
+		require.NoError(t, cfg.UnmarshalKey("db", &db))
+	})
+
+	t.Run("remote", func(t *testing.T) {
+		cfg := New()
+		require.NoError(t, cfg.LoadFromRemote(context.Background(), &fakeRemoteProvider{
+			kvs: map[string]interface{}{"db.host": "remote", "db.port": "3306"},
+		}))
+
+		var db DB
+		err := cfg.UnmarshalKeyStrict("db", &db)
+		require.Error(t, err)
+		require.Equal(t, "unknown keys: `db.port` (*config.fakeRemoteProvider#1)", err.Error())
+	})
+}
@@ -0,0 +1,345 @@
+package config
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	gutils "github.com/Laisky/go-utils/v2"
+	"github.com/Laisky/go-utils/v2/encrypt"
+	"github.com/Laisky/go-utils/v2/log"
+	"github.com/Laisky/zap"
+	"github.com/pkg/errors"
+)
+
+// defaultPollInterval interval to refresh settings loaded by `LoadFromURL`
+const defaultPollInterval = time.Minute
+
+// fileHTTPClient client to load `file://` urls, supports conditional GET by modification time
+var fileHTTPClient = &http.Client{Transport: http.NewFileTransport(http.Dir("/"))}
+
+// WithHTTPClient http client to load settings, for `LoadFromURL`
+func WithHTTPClient(client *http.Client) Option {
+	return func(opt *option) error {
+		if client == nil {
+			return errors.New("http client is nil")
+		}
+
+		opt.httpClient = client
+		return nil
+	}
+}
+
+// WithChecksum pin sha256 checksum of content of url, for `LoadFromURL`
+//
+// sum is hex encoded, content is checked before decrypted.
+// loading fails if checksum mismatched.
+func WithChecksum(rawURL, sum string) Option {
+	return func(opt *option) error {
+		if _, err := hex.DecodeString(sum); err != nil || len(sum) != sha256.Size*2 {
+			return errors.Errorf("invalid sha256 checksum `%s` for `%s`", sum, rawURL)
+		}
+
+		if opt.checksums == nil {
+			opt.checksums = map[string]string{}
+		}
+
+		opt.checksums[rawURL] = strings.ToLower(sum)
+		return nil
+	}
+}
+
+// WithPollInterval interval to refresh settings, for `LoadFromURL` with `WithWatchRemote`
+func WithPollInterval(interval time.Duration) Option {
+	return func(opt *option) error {
+		if interval <= 0 {
+			return errors.Errorf("poll interval should be positive, got %s", interval)
+		}
+
+		opt.pollInterval = interval
+		return nil
+	}
+}
+
+// urlCache last response of url, for conditional GET
+type urlCache struct {
+	etag, lastModified string
+	src                layerSource
+}
+
+// urlLoader load settings file and its includes from http server
+type urlLoader struct {
+	opt *option
+
+	mu    sync.Mutex
+	cache map[string]*urlCache
+}
+
+func newURLLoader(opt *option) *urlLoader {
+	return &urlLoader{opt: opt, cache: map[string]*urlCache{}}
+}
+
+// fetch get settings from rawURL by conditional GET,
+// return the cached one if not modified.
+func (l *urlLoader) fetch(ctx context.Context, rawURL string) (src layerSource, modified bool, err error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return layerSource{}, false, errors.Wrapf(err, "parse url `%s`", rawURL)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, rawURL, nil)
+	if err != nil {
+		return layerSource{}, false, errors.Wrapf(err, "new request `%s`", rawURL)
+	}
+
+	l.mu.Lock()
+	cached := l.cache[rawURL]
+	l.mu.Unlock()
+	if cached != nil {
+		if cached.etag != "" {
+			req.Header.Set("If-None-Match", cached.etag)
+		}
+		if cached.lastModified != "" {
+			req.Header.Set("If-Modified-Since", cached.lastModified)
+		}
+	}
+
+	client := l.opt.httpClient
+	if u.Scheme == "file" {
+		client = fileHTTPClient
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return layerSource{}, false, errors.Wrapf(err, "request `%s`", rawURL)
+	}
+	defer gutils.SilentClose(resp.Body)
+
+	switch {
+	case resp.StatusCode == http.StatusNotModified && cached != nil:
+		return cached.src, false, nil
+	case resp.StatusCode != http.StatusOK:
+		return layerSource{}, false, errors.Errorf("request `%s` got status %d", rawURL, resp.StatusCode)
+	}
+
+	cnt, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return layerSource{}, false, errors.Wrapf(err, "read `%s`", rawURL)
+	}
+
+	if sum, ok := l.opt.checksums[rawURL]; ok {
+		actual := sha256.Sum256(cnt)
+		if hex.EncodeToString(actual[:]) != sum {
+			return layerSource{}, false, errors.Errorf("checksum mismatch for `%s`", rawURL)
+		}
+	}
+
+	if isSettingsFileEncrypted(l.opt, u.Path) {
+		reader, err := encrypt.NewAesReaderWrapper(bytes.NewReader(cnt), l.opt.aesKey)
+		if err != nil {
+			return layerSource{}, false, errors.Wrapf(err, "decrypt `%s`", rawURL)
+		}
+		if cnt, err = io.ReadAll(reader); err != nil {
+			return layerSource{}, false, errors.Wrapf(err, "decrypt `%s`", rawURL)
+		}
+	}
+
+	cfgType, err := detectFormat(l.opt, u.Path, cnt)
+	if err != nil {
+		return layerSource{}, false, err
+	}
+
+	settings, err := parseSettings(cfgType, rawURL, bytes.NewReader(cnt))
+	if err != nil {
+		return layerSource{}, false, errors.Wrapf(err, "load config from `%s`", rawURL)
+	}
+
+	src = layerSource{
+		name:      rawURL,
+		settings:  settings,
+		positions: parsePositions(cfgType, rawURL, cnt),
+		resets:    parseResetKeys(cfgType, cnt),
+		format:    cfgType,
+	}
+
+	l.mu.Lock()
+	l.cache[rawURL] = &urlCache{
+		etag:         resp.Header.Get("ETag"),
+		lastModified: resp.Header.Get("Last-Modified"),
+		src:          src,
+	}
+	l.mu.Unlock()
+
+	return src, true, nil
+}
+
+// load entryURL and all urls included by it,
+// relative includes are resolved against the url including it.
+//
+// return sources in ascending priority, sources are copied from cache,
+// modified is false if all urls not modified.
+func (l *urlLoader) load(ctx context.Context, entryURL string) (urls []string, sources []layerSource, modified bool, err error) {
+	curURL := entryURL
+
+RECUR_INCLUDE_LOOP:
+	for curURL != "" {
+		urls = append(urls, curURL)
+		src, changed, err := l.fetch(ctx, curURL)
+		if err != nil {
+			return nil, nil, false, err
+		}
+		modified = modified || changed
+
+		include, _ := src.settings[settingsIncludeKey].(string)
+		src.settings = copySettings(src.settings)
+		src.positions = copyPositions(src.positions)
+		sources = append(sources, src)
+		if include == "" {
+			break
+		}
+
+		base, err := url.Parse(curURL)
+		if err != nil {
+			return nil, nil, false, errors.Wrapf(err, "parse url `%s`", curURL)
+		}
+		ref, err := url.Parse(include)
+		if err != nil {
+			return nil, nil, false, errors.Wrapf(err, "parse include `%s` in `%s`", include, curURL)
+		}
+
+		next := base.ResolveReference(ref)
+		if urlSchemeFamily(next.Scheme) != urlSchemeFamily(base.Scheme) {
+			// remote settings must not read local files, and vice versa
+			return nil, nil, false, errors.Errorf(
+				"include `%s` in `%s`: scheme `%s` not allowed from `%s`",
+				include, curURL, next.Scheme, base.Scheme)
+		}
+
+		curURL = next.String()
+		for _, u := range urls {
+			if u == curURL {
+				break RECUR_INCLUDE_LOOP
+			}
+		}
+	}
+
+	// included urls have lower priority
+	for i, j := 0, len(sources)-1; i < j; i, j = i+1, j-1 {
+		sources[i], sources[j] = sources[j], sources[i]
+	}
+
+	return urls, sources, modified, nil
+}
+
+// urlSchemeFamily http and https are the same family,
+// others are only the same as themselves
+func urlSchemeFamily(scheme string) string {
+	scheme = strings.ToLower(scheme)
+	if scheme == "https" {
+		return "http"
+	}
+
+	return scheme
+}
+
+// loadURL load sources of entryURL by loader
+func (s *config) loadURL(ctx context.Context, loader *urlLoader, entryURL string) (urls []string, sources []layerSource, modified bool, err error) {
+	if urls, sources, modified, err = loader.load(ctx, entryURL); err != nil {
+		return nil, nil, false, err
+	}
+
+	if err = s.prepareSources(loader.opt, sources); err != nil {
+		return nil, nil, false, err
+	}
+
+	return urls, sources, modified, nil
+}
+
+// LoadFromURL load settings file from http server or `file://` url, like `LoadFromFile`
+//
+// `include` can be an absolute url or a path relative to the url including it.
+// http(s) urls can only include http(s) urls, `file://` urls can only include `file://` urls.
+// encrypted file is decrypted by `WithAesEncrypt`, checksum can be pinned by `WithChecksum`.
+//
+// enable `WithWatchRemote` to refresh every `WithPollInterval` until ctx done,
+// conditional GET by ETag and Last-Modified is used to avoid downloading unchanged files.
+func (s *config) LoadFromURL(ctx context.Context, entryURL string, opts ...Option) error {
+	opt, err := new(option).fillDefault().applyOptfs(opts...)
+	if err != nil {
+		return errors.Wrap(err, "apply options")
+	}
+	if opt.httpClient == nil {
+		opt.httpClient = httpClient
+	}
+	if opt.pollInterval == 0 {
+		opt.pollInterval = defaultPollInterval
+	}
+
+	loader := newURLLoader(opt)
+	urls, sources, _, err := s.loadURL(ctx, loader, entryURL)
+	if err != nil {
+		return err
+	}
+
+	group := &layerGroup{
+		name:    entryURL,
+		sources: sources,
+		reload: func() ([]layerSource, error) {
+			_, sources, _, err := s.loadURL(ctx, loader, entryURL)
+			return sources, err
+		},
+	}
+	if err = s.setLayerGroup(LayerRemote, group); err != nil {
+		return errors.Wrapf(err, "load settings from `%s`", entryURL)
+	}
+
+	if opt.watchRemote {
+		go s.pollURL(ctx, loader, group)
+	}
+
+	log.Shared.Info("load settings from url",
+		zap.String("url", entryURL),
+		zap.Strings("urls", urls))
+	return nil
+}
+
+// pollURL refresh group every poll interval until ctx done
+func (s *config) pollURL(ctx context.Context, loader *urlLoader, group *layerGroup) {
+	ticker := time.NewTicker(loader.opt.pollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		_, sources, modified, err := s.loadURL(ctx, loader, group.name)
+		if err == nil && !modified {
+			continue
+		}
+		if err == nil {
+			err = s.setLayerGroup(LayerRemote, &layerGroup{
+				name:    group.name,
+				sources: sources,
+				reload:  group.reload,
+			})
+		}
+		if err != nil {
+			log.Shared.Error("refresh settings from url", zap.Error(err), zap.String("url", group.name))
+			continue
+		}
+
+		if loader.opt.watchRemoteCallback != nil {
+			loader.opt.watchRemoteCallback()
+		}
+	}
+}
@@ -0,0 +1,197 @@
+package config
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/Laisky/go-utils/v2/encrypt"
+	"github.com/stretchr/testify/require"
+)
+
+// settingsServer serve settings files with ETag
+type settingsServer struct {
+	mu    sync.Mutex
+	files map[string][]byte
+	// requests, notModified count of requests
+	requests, notModified int64
+}
+
+func (s *settingsServer) set(path string, cnt []byte) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.files[path] = cnt
+}
+
+func (s *settingsServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	atomic.AddInt64(&s.requests, 1)
+	s.mu.Lock()
+	cnt, ok := s.files[r.URL.Path]
+	s.mu.Unlock()
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+
+	sum := sha256.Sum256(cnt)
+	etag := `"` + hex.EncodeToString(sum[:8]) + `"`
+	if r.Header.Get("If-None-Match") == etag {
+		atomic.AddInt64(&s.notModified, 1)
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	w.Header().Set("ETag", etag)
+	_, _ = w.Write(cnt)
+}
+
+func TestConfig_LoadFromURL(t *testing.T) {
+	secret := []byte("secret")
+	encrypted, err := encrypt.EncryptByAes(secret, []byte("db:\n  password: p@ss\n"))
+	require.NoError(t, err)
+
+	common := &settingsServer{files: map[string][]byte{
+		"/common.yml": []byte("name: common\nlog: debug\n"),
+	}}
+	commonTS := httptest.NewServer(common)
+	defer commonTS.Close()
+
+	srv := &settingsServer{files: map[string][]byte{
+		"/app/settings.yml":   []byte("include: base/base.yml\nname: app\n"),
+		"/app/base/base.yml":  []byte("include: ../secret.yml.enc\ndb:\n  host: localhost\n"),
+		"/app/secret.yml.enc": encrypted,
+		// absolute include
+		"/app/chain.yml": []byte("include: " + commonTS.URL + "/common.yml\nname: chain\n"),
+	}}
+	ts := httptest.NewServer(srv)
+	defer ts.Close()
+
+	t.Run("load", func(t *testing.T) {
+		cfg := New()
+		require.NoError(t, cfg.LoadFromURL(context.Background(), ts.URL+"/app/chain.yml"))
+		require.Equal(t, "chain", cfg.GetString("name"))
+		require.Equal(t, "debug", cfg.GetString("log"))
+
+		cfg = New()
+		require.NoError(t, cfg.LoadFromURL(context.Background(), ts.URL+"/app/settings.yml",
+			WithAesEncrypt(secret)))
+		require.Equal(t, "app", cfg.GetString("name"))
+		require.Equal(t, "localhost", cfg.GetString("db.host"))
+		require.Equal(t, "p@ss", cfg.GetString("db.password"))
+
+		exp, err := cfg.Explain("db.host")
+		require.NoError(t, err)
+		require.Equal(t, LayerRemote, exp.Layer)
+		require.Equal(t, ts.URL+"/app/base/base.yml", exp.Source)
+		require.Equal(t, 3, exp.Line)
+	})
+
+	t.Run("refresh", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		var refreshed int64
+		cfg := New()
+		require.NoError(t, cfg.LoadFromURL(ctx, ts.URL+"/app/settings.yml",
+			WithAesEncrypt(secret),
+			WithWatchRemote(func() { atomic.AddInt64(&refreshed, 1) }),
+			WithPollInterval(20*time.Millisecond),
+		))
+
+		// unchanged files are not downloaded again
+		require.Eventually(t, func() bool {
+			return atomic.LoadInt64(&srv.notModified) >= 6
+		}, 3*time.Second, 10*time.Millisecond)
+		require.Equal(t, int64(0), atomic.LoadInt64(&refreshed))
+		rev := cfg.Snapshot()
+
+		srv.set("/app/settings.yml", []byte("include: base/base.yml\nname: refreshed\n"))
+		require.Eventually(t, func() bool {
+			return cfg.GetString("name") == "refreshed"
+		}, 3*time.Second, 10*time.Millisecond)
+		require.Equal(t, "app", rev.GetString("name"))
+		require.Equal(t, "p@ss", cfg.GetString("db.password"))
+		require.Eventually(t, func() bool {
+			return atomic.LoadInt64(&refreshed) == 1
+		}, 3*time.Second, 10*time.Millisecond)
+
+		require.NoError(t, cfg.ReloadLayer(LayerRemote))
+		require.Equal(t, "refreshed", cfg.GetString("name"))
+	})
+
+	t.Run("checksum", func(t *testing.T) {
+		cnt := []byte("name: pinned\n")
+		srv.set("/pinned.yml", cnt)
+		sum := sha256.Sum256(cnt)
+
+		cfg := New()
+		require.NoError(t, cfg.LoadFromURL(context.Background(), ts.URL+"/pinned.yml",
+			WithChecksum(ts.URL+"/pinned.yml", hex.EncodeToString(sum[:]))))
+		require.Equal(t, "pinned", cfg.GetString("name"))
+
+		srv.set("/pinned.yml", []byte("name: tampered\n"))
+		err := cfg.LoadFromURL(context.Background(), ts.URL+"/pinned.yml",
+			WithChecksum(ts.URL+"/pinned.yml", hex.EncodeToString(sum[:])))
+		require.ErrorContains(t, err, "checksum mismatch")
+		require.Equal(t, "pinned", cfg.GetString("name"))
+
+		_, err = new(option).applyOptfs(WithChecksum(ts.URL, "not-hex"))
+		require.Error(t, err)
+	})
+
+	t.Run("file", func(t *testing.T) {
+		dir := t.TempDir()
+		require.NoError(t, os.MkdirAll(filepath.Join(dir, "base"), 0755))
+		require.NoError(t, os.WriteFile(filepath.Join(dir, "settings.yml"),
+			[]byte("include: base/base.yml\nname: file\n"), 0644))
+		require.NoError(t, os.WriteFile(filepath.Join(dir, "base", "base.yml"),
+			[]byte("include: ../common.yml\ndb:\n  host: localhost\n"), 0644))
+		require.NoError(t, os.WriteFile(filepath.Join(dir, "common.yml"),
+			[]byte("name: common\nlog: debug\n"), 0644))
+
+		entry := (&url.URL{Scheme: "file", Path: filepath.ToSlash(filepath.Join(dir, "settings.yml"))}).String()
+		cfg := New()
+		require.NoError(t, cfg.LoadFromURL(context.Background(), entry))
+		require.Equal(t, "file", cfg.GetString("name"))
+		require.Equal(t, "localhost", cfg.GetString("db.host"))
+		require.Equal(t, "debug", cfg.GetString("log"))
+
+		require.ErrorContains(t, cfg.LoadFromURL(context.Background(), entry+".not-exists"), "404")
+	})
+
+	t.Run("include across schemes", func(t *testing.T) {
+		dir := t.TempDir()
+		local := filepath.Join(dir, "local.yml")
+		require.NoError(t, os.WriteFile(local, []byte("include: "+commonTS.URL+"/common.yml\n"), 0644))
+		localURL := (&url.URL{Scheme: "file", Path: filepath.ToSlash(local)}).String()
+
+		// remote settings can not read local files
+		srv.set("/steal.yml", []byte("include: "+localURL+"\nname: steal\n"))
+		cfg := New()
+		require.ErrorContains(t, cfg.LoadFromURL(context.Background(), ts.URL+"/steal.yml"),
+			"scheme `file` not allowed from `http`")
+		require.False(t, cfg.IsSet("name"))
+
+		require.ErrorContains(t, cfg.LoadFromURL(context.Background(), localURL),
+			"scheme `http` not allowed from `file`")
+	})
+
+	t.Run("invalid", func(t *testing.T) {
+		cfg := New()
+		require.ErrorContains(t, cfg.LoadFromURL(context.Background(), ts.URL+"/not-exists.yml"), "404")
+
+		_, err := new(option).applyOptfs(WithPollInterval(0))
+		require.Error(t, err)
+		_, err = new(option).applyOptfs(WithHTTPClient(nil))
+		require.Error(t, err)
+	})
+}